@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/ilyakaznacheev/cleanenv"
 
 	"github.com/taraslis453/shopify-customer-auth/config"
@@ -17,7 +19,18 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed to read env", "err", err)
 	}
-	logger.Info("read config", "config", cfg)
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("invalid config", "err", err)
+	}
+	logger.Info("read config", "config", cfg.Redacted())
+
+	// e.g. app import-customers -shop example.myshopify.com
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(&cfg, os.Args[1:]); err != nil {
+			logger.Fatal("failed to run command", "err", err)
+		}
+		return
+	}
 
 	app.Run(&cfg)
 }
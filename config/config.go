@@ -1,6 +1,16 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// redacted replaces secret values in Config.Redacted.
+const redacted = "[REDACTED]"
+
+// minEncryptionKeyLength is the min length of Auth.EncryptionKey, it's hashed into AES-256 key,
+// so a shorter key would be weaker than the cipher.
+const minEncryptionKeyLength = 32
 
 type (
 	Config struct {
@@ -8,6 +18,13 @@ type (
 		HTTP
 		Log
 		Auth
+		LoginProtection
+		RateLimit
+		CustomerCache
+		CustomerImport
+		Webhook
+		Admin
+		Shopify
 		PostgreSQL
 	}
 
@@ -17,6 +34,9 @@ type (
 
 	HTTP struct {
 		Port string `env:"HTTP_PORT" env-default:"8080"`
+		// TrustedProxies are comma separated IPs or CIDRs of proxies which X-Forwarded-For header is trusted from,
+		// client IP is the remote address if it's empty.
+		TrustedProxies []string `env:"HTTP_TRUSTED_PROXIES" env-separator:","`
 	}
 
 	Log struct {
@@ -28,6 +48,83 @@ type (
 		TokenSecretKey       string        `env:"AUTH_TOKEN_SECRET_KEY"                env-default:"2fg6wuCkkQ4HNjCo"`
 		AccessTokenLifetime  time.Duration `env:"AUTH_ACCESS_TOKEN_LIFETIME"           env-default:"1h"`
 		RefreshTokenLifetime time.Duration `env:"AUTH_REFRESH_TOKEN_LIFETIME"          env-default:"24h"`
+		// EncryptionKey is used to encrypt vendor access tokens stored in DB, it has no default to not share one
+		// between deployments and must be at least minEncryptionKeyLength characters long.
+		EncryptionKey string `env:"AUTH_ENCRYPTION_KEY" env-required:"true"`
+		// VendorTokenRenewInterval is how often vendor access tokens close to expiration are renewed in background.
+		VendorTokenRenewInterval time.Duration `env:"AUTH_VENDOR_TOKEN_RENEW_INTERVAL" env-default:"1h"`
+	}
+
+	LoginProtection struct {
+		MaxFailedAttemptsPerEmail int           `env:"LOGIN_MAX_FAILED_ATTEMPTS_PER_EMAIL" env-default:"5"`
+		MaxFailedAttemptsPerIP    int           `env:"LOGIN_MAX_FAILED_ATTEMPTS_PER_IP"    env-default:"20"`
+		FailedAttemptsWindow      time.Duration `env:"LOGIN_FAILED_ATTEMPTS_WINDOW"        env-default:"15m"`
+		ProgressiveDelay          time.Duration `env:"LOGIN_PROGRESSIVE_DELAY"             env-default:"1s"`
+		LockoutDuration           time.Duration `env:"LOGIN_LOCKOUT_DURATION"              env-default:"15m"`
+	}
+
+	// RateLimit contains default limits of route groups in "<burst>/<period>" format, empty means unlimited.
+	RateLimit struct {
+		// Backend is either "memory" (per replica) or "postgresql" (shared between replicas).
+		Backend  string `env:"RATE_LIMIT_BACKEND"  env-default:"memory"`
+		Login    string `env:"RATE_LIMIT_LOGIN"    env-default:"10/1m"`
+		Customer string `env:"RATE_LIMIT_CUSTOMER" env-default:"60/1m"`
+		Vendor   string `env:"RATE_LIMIT_VENDOR"   env-default:"30/1m"`
+		// CleanupInterval is how often buckets which are full again are deleted.
+		CleanupInterval time.Duration `env:"RATE_LIMIT_CLEANUP_INTERVAL" env-default:"1m"`
+	}
+
+	// CustomerCache configures caching of vendor customer profiles, store CustomerCacheTTL overrides TTL.
+	CustomerCache struct {
+		// Backend is either "memory" (per replica LRU) or "postgresql" (shared between replicas).
+		Backend string        `env:"CUSTOMER_CACHE_BACKEND"      env-default:"memory"`
+		TTL     time.Duration `env:"CUSTOMER_CACHE_TTL"          env-default:"5m"`
+		// NegativeTTL is how long customers missing in vendor are cached.
+		NegativeTTL time.Duration `env:"CUSTOMER_CACHE_NEGATIVE_TTL" env-default:"1m"`
+		// Size is a max number of entries of the memory backend.
+		Size int `env:"CUSTOMER_CACHE_SIZE" env-default:"10000"`
+	}
+
+	// CustomerImport configures import of existing vendor customers.
+	CustomerImport struct {
+		// PollInterval is how often vendor is asked whether the customers export is finished.
+		PollInterval time.Duration `env:"CUSTOMER_IMPORT_POLL_INTERVAL" env-default:"5s"`
+		// BatchSize is how many customers are saved at once, progress is saved after every batch.
+		BatchSize int `env:"CUSTOMER_IMPORT_BATCH_SIZE" env-default:"500"`
+		// Lease is how long an import is claimed by the replica running it, the lease is renewed while it runs.
+		// Unfinished imports are resumed with this interval, e.g. ones left by a stopped replica.
+		Lease time.Duration `env:"CUSTOMER_IMPORT_LEASE" env-default:"5m"`
+	}
+
+	// Webhook configures handling of vendor webhooks, they are acknowledged at once and handled in background.
+	Webhook struct {
+		// MaxAttempts is how many times a webhook is handled before it's marked failed.
+		MaxAttempts int `env:"WEBHOOK_MAX_ATTEMPTS" env-default:"5"`
+		// RetryInterval is a delay before the first retry, it doubles with every next attempt.
+		// Due retries are checked with this interval too.
+		RetryInterval time.Duration `env:"WEBHOOK_RETRY_INTERVAL" env-default:"30s"`
+		// Lease is how long a webhook is claimed by the replica handling it, it's retried by others after that,
+		// so handling is cancelled once the lease is over.
+		Lease time.Duration `env:"WEBHOOK_LEASE" env-default:"5m"`
+		// Retention is how long handled webhooks are kept to skip their redeliveries.
+		Retention time.Duration `env:"WEBHOOK_RETENTION" env-default:"168h"`
+		// DataExportRetention is how long customer data exported for data requests is kept for admins
+		// to retrieve it, merchants have to get it within 30 days.
+		DataExportRetention time.Duration `env:"WEBHOOK_DATA_EXPORT_RETENTION" env-default:"720h"`
+	}
+
+	Admin struct {
+		// APIKey is a bearer token of admin endpoints, they are disabled if it's empty.
+		APIKey string `env:"ADMIN_API_KEY"`
+	}
+
+	// Shopify contains credentials of the public app, they are used by stores without their own credentials.
+	// Public app mode is enabled if they are set, stores are created on their first install then.
+	Shopify struct {
+		APIKey    string `env:"SHOPIFY_API_KEY"`
+		APISecret string `env:"SHOPIFY_API_SECRET"`
+		// Scopes are access scopes requested from stores, store Scopes overrides them.
+		Scopes string `env:"SHOPIFY_SCOPES" env-default:"read_products,unauthenticated_read_content,unauthenticated_read_customer_tags,unauthenticated_read_product_tags,unauthenticated_read_product_listings,unauthenticated_write_checkouts,unauthenticated_read_checkouts,unauthenticated_write_customers,unauthenticated_read_customers,read_customers,write_customers,read_orders"`
 	}
 
 	PostgreSQL struct {
@@ -37,3 +134,29 @@ type (
 		Database string `env:"POSTGRESQL_DATABASE" env-default:"api"`
 	}
 )
+
+// Validate checks config values which can't be checked by env tags.
+func (c *Config) Validate() error {
+	if len(c.Auth.EncryptionKey) < minEncryptionKeyLength {
+		return fmt.Errorf("AUTH_ENCRYPTION_KEY must be at least %d characters long", minEncryptionKeyLength)
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the config with secrets replaced, so it can be logged.
+func (c Config) Redacted() Config {
+	for _, value := range []*string{
+		&c.Auth.TokenSecretKey,
+		&c.Auth.EncryptionKey,
+		&c.Admin.APIKey,
+		&c.Shopify.APISecret,
+		&c.PostgreSQL.Password,
+	} {
+		if *value != "" {
+			*value = redacted
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,101 @@
+package captcha
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+// verifyURLs contains siteverify endpoints of supported providers, all of them share the same protocol.
+var verifyURLs = map[string]string{
+	entity.CaptchaProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	entity.CaptchaProviderReCaptcha: "https://www.google.com/recaptcha/api/siteverify",
+	entity.CaptchaProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// httpVerifier implements the service.CaptchaVerifier interface using provider siteverify HTTP API.
+type httpVerifier struct {
+	http       *resty.Client
+	verifyURLs map[string]string
+	logger     logging.Logger
+}
+
+// Options is used to parameterize httpVerifier using New.
+type Options struct {
+	Logger logging.Logger
+	// VerifyURLs overrides provider endpoints, e.g. for testing.
+	VerifyURLs map[string]string
+}
+
+var _ service.CaptchaVerifier = (*httpVerifier)(nil)
+
+// New is used to create a new httpVerifier instance.
+func New(options *Options) *httpVerifier {
+	urls := make(map[string]string, len(verifyURLs))
+	for provider, url := range verifyURLs {
+		urls[provider] = url
+	}
+	for provider, url := range options.VerifyURLs {
+		urls[provider] = url
+	}
+
+	return &httpVerifier{
+		http:       resty.New().SetTimeout(10 * time.Second),
+		verifyURLs: urls,
+		logger:     options.Logger.Named("CaptchaVerifier"),
+	}
+}
+
+// VerifyCaptcha implements service.CaptchaVerifier.
+func (v *httpVerifier) VerifyCaptcha(ctx context.Context, opts service.VerifyCaptchaOptions) (bool, error) {
+	logger := v.logger.
+		Named("VerifyCaptcha").
+		WithContext(ctx).
+		With("provider", opts.Provider, "remoteIP", opts.RemoteIP)
+
+	verifyURL, ok := v.verifyURLs[opts.Provider]
+	if !ok {
+		logger.Error("unsupported captcha provider")
+		return false, fmt.Errorf("unsupported captcha provider %q", opts.Provider)
+	}
+
+	form := map[string]string{
+		"secret":   opts.Secret,
+		"response": opts.Token,
+	}
+	if opts.RemoteIP != "" {
+		form["remoteip"] = opts.RemoteIP
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	res, err := v.http.R().
+		SetContext(ctx).
+		SetFormData(form).
+		SetResult(&result).
+		Post(verifyURL)
+	if err != nil {
+		logger.Error("failed to send verify request", "err", err)
+		return false, fmt.Errorf("failed to send verify request: %w", err)
+	}
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to verify captcha", "resBody", res.String())
+		return false, fmt.Errorf("failed to verify captcha: http status %d, body %s", res.StatusCode(), res.String())
+	}
+	if !result.Success {
+		logger.Info("captcha is not verified", "errorCodes", result.ErrorCodes)
+		return false, nil
+	}
+
+	logger.Info("captcha successfully verified")
+	return true, nil
+}
@@ -0,0 +1,66 @@
+package captcha
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+func TestVerifyCaptcha(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("secret") == "secret" && r.PostForm.Get("response") == "valid" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	verifier := New(&Options{
+		Logger:     logging.NewZapLogger("error"),
+		VerifyURLs: map[string]string{entity.CaptchaProviderTurnstile: server.URL},
+	})
+
+	testCases := []struct {
+		name          string
+		opts          service.VerifyCaptchaOptions
+		expectedOK    bool
+		expectedError bool
+	}{
+		{
+			name:       "positive: valid token",
+			opts:       service.VerifyCaptchaOptions{Provider: entity.CaptchaProviderTurnstile, Secret: "secret", Token: "valid"},
+			expectedOK: true,
+		},
+		{
+			name:       "negative: invalid token",
+			opts:       service.VerifyCaptchaOptions{Provider: entity.CaptchaProviderTurnstile, Secret: "secret", Token: "invalid"},
+			expectedOK: false,
+		},
+		{
+			name:          "negative: unsupported provider",
+			opts:          service.VerifyCaptchaOptions{Provider: "unknown", Secret: "secret", Token: "valid"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		ok, err := verifier.VerifyCaptcha(context.Background(), tc.opts)
+		if tc.expectedError {
+			assert.Errorf(t, err, tc.name)
+			continue
+		}
+		require.NoErrorf(t, err, tc.name)
+		assert.Equalf(t, tc.expectedOK, ok, tc.name)
+	}
+}
@@ -0,0 +1,25 @@
+package captcha
+
+import (
+	"context"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// Fake implements the service.CaptchaVerifier interface without calling providers, it's used in tests.
+type Fake struct {
+	// ValidToken is the only token accepted by the verifier.
+	ValidToken string
+	// Err is returned by VerifyCaptcha if set.
+	Err error
+}
+
+var _ service.CaptchaVerifier = (*Fake)(nil)
+
+// VerifyCaptcha implements service.CaptchaVerifier.
+func (f *Fake) VerifyCaptcha(ctx context.Context, opts service.VerifyCaptchaOptions) (bool, error) {
+	if f.Err != nil {
+		return false, f.Err
+	}
+	return opts.Token != "" && opts.Token == f.ValidToken, nil
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// jwks contains parsed public keys of a provider.
+type jwks struct {
+	keys      map[string]interface{} // key is kid
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// getKey returns a public key by kid, keys are refetched if expired or kid is unknown.
+func (o *oidcAPI) getKey(ctx context.Context, jwksURL, kid string) (interface{}, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cached, ok := o.jwks[jwksURL]
+	if ok && time.Since(cached.fetchedAt) < jwksLifetime {
+		if key, ok := cached.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(cached.fetchedAt) < jwksMinRefreshInterval {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	fetched, err := o.fetchJWKS(ctx, jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	o.jwks[jwksURL] = fetched
+
+	key, ok := fetched.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	return key, nil
+}
+
+func (o *oidcAPI) fetchJWKS(ctx context.Context, jwksURL string) (*jwks, error) {
+	logger := o.logger.
+		Named("fetchJWKS").
+		WithContext(ctx).
+		With("jwksURL", jwksURL)
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	res, err := o.http.R().
+		SetContext(ctx).
+		SetResult(&set).
+		Get(jwksURL)
+	if err != nil {
+		logger.Error("failed to send jwks request", "err", err)
+		return nil, fmt.Errorf("failed to send jwks request: %w", err)
+	}
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to get jwks", "resBody", res.String())
+		return nil, fmt.Errorf("failed to get jwks: http status %d, body %s", res.StatusCode(), res.String())
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Warn("skipping invalid jwk", "kid", k.Kid, "err", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	logger.Info("successfully fetched jwks", "keys", len(keys))
+	return &jwks{keys: keys, fetchedAt: time.Now()}, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64URLInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBase64URLInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBase64URLInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBase64URLInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBase64URLInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+const (
+	defaultScopes = "openid email profile"
+	// jwksLifetime is how long fetched provider keys are trusted before refetching.
+	jwksLifetime = time.Hour
+	// jwksMinRefreshInterval limits refetching of keys when an unknown key id is met.
+	jwksMinRefreshInterval = time.Minute
+	// clockSkew is a leeway used to validate id_token time claims.
+	clockSkew = time.Minute
+)
+
+// oidcAPI implements the service.OIDCAPI interface.
+type oidcAPI struct {
+	http   *resty.Client
+	logger logging.Logger
+
+	mu   sync.Mutex
+	jwks map[string]*jwks // key is JWKS URL
+}
+
+// Options is used to parameterize oidcAPI using New.
+type Options struct {
+	Logger logging.Logger
+}
+
+var _ service.OIDCAPI = (*oidcAPI)(nil)
+
+// New is used to create a new oidcAPI instance.
+func New(options *Options) *oidcAPI {
+	return &oidcAPI{
+		http:   resty.New().SetTimeout(10 * time.Second),
+		logger: options.Logger.Named("OIDCAPI"),
+		jwks:   make(map[string]*jwks),
+	}
+}
+
+// GetAuthorizationURL implements service.OIDCAPI.
+func (o *oidcAPI) GetAuthorizationURL(provider *entity.OIDCProvider, opts service.GetOIDCAuthorizationURLOptions) (string, error) {
+	logger := o.logger.
+		Named("GetAuthorizationURL").
+		With("provider", provider.Name)
+
+	authorizationURL, err := url.Parse(provider.AuthorizationURL)
+	if err != nil {
+		logger.Error("invalid authorization url", "err", err)
+		return "", fmt.Errorf("invalid authorization url: %w", err)
+	}
+
+	scopes := provider.Scopes
+	if scopes == "" {
+		scopes = defaultScopes
+	}
+
+	values := authorizationURL.Query()
+	values.Set("response_type", "code")
+	values.Set("client_id", provider.ClientID)
+	values.Set("redirect_uri", opts.RedirectURL)
+	values.Set("scope", scopes)
+	values.Set("state", opts.State)
+	values.Set("nonce", opts.Nonce)
+	authorizationURL.RawQuery = values.Encode()
+
+	logger.Info("authorization url successfully created")
+	return authorizationURL.String(), nil
+}
+
+// ExchangeCode implements service.OIDCAPI.
+func (o *oidcAPI) ExchangeCode(ctx context.Context, provider *entity.OIDCProvider, opts service.ExchangeOIDCCodeOptions) (*service.OIDCIDTokenClaims, error) {
+	logger := o.logger.
+		Named("ExchangeCode").
+		WithContext(ctx).
+		With("provider", provider.Name)
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	res, err := o.http.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json").
+		SetFormData(map[string]string{
+			"grant_type":    "authorization_code",
+			"code":          opts.Code,
+			"redirect_uri":  opts.RedirectURL,
+			"client_id":     provider.ClientID,
+			"client_secret": provider.ClientSecret,
+		}).
+		SetResult(&tokens).
+		Post(provider.TokenURL)
+	if err != nil {
+		logger.Error("failed to send token request", "err", err)
+		return nil, fmt.Errorf("failed to send token request: %w", err)
+	}
+	if res.StatusCode() == http.StatusBadRequest || res.StatusCode() == http.StatusUnauthorized {
+		logger.Info("provider rejected authorization code", "resBody", res.String())
+		return nil, service.ErrLoginCustomerWithOIDCInvalidCode
+	}
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to exchange code", "resBody", res.String())
+		return nil, fmt.Errorf("failed to exchange code: http status %d, body %s", res.StatusCode(), res.String())
+	}
+	if tokens.IDToken == "" {
+		logger.Error("id_token is missing in token response")
+		return nil, fmt.Errorf("id_token is missing in token response")
+	}
+
+	claims, err := o.verifyIDToken(ctx, provider, tokens.IDToken, opts.Nonce)
+	if err != nil {
+		logger.Info("invalid id_token", "err", err)
+		return nil, service.ErrLoginCustomerWithOIDCInvalidIDToken
+	}
+	logger = logger.With("subject", claims.Subject)
+
+	logger.Info("successfully exchanged code")
+	return claims, nil
+}
+
+// verifyIDToken validates id_token signature against provider JWKS and its standard claims.
+func (o *oidcAPI) verifyIDToken(ctx context.Context, provider *entity.OIDCProvider, rawIDToken, nonce string) (*service.OIDCIDTokenClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return o.getKey(ctx, provider.JWKSURL, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse id_token: %w", err)
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, fmt.Errorf("id_token has no expiration time")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+
+	email, _ := claims["email"].(string)
+	givenName, _ := claims["given_name"].(string)
+	familyName, _ := claims["family_name"].(string)
+
+	return &service.OIDCIDTokenClaims{
+		Subject:       subject,
+		Email:         strings.ToLower(email),
+		EmailVerified: isTrue(claims["email_verified"]),
+		GivenName:     givenName,
+		FamilyName:    familyName,
+	}, nil
+}
+
+// isTrue parses boolean claim which some providers (e.g. Apple) send as a string.
+func isTrue(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,418 @@
+package shopify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+// storefrontMailingAddressFields is a selection of MailingAddress fields in Storefront API.
+const storefrontMailingAddressFields = `
+	id
+	firstName
+	lastName
+	company
+	address1
+	address2
+	city
+	province
+	provinceCode
+	country
+	countryCodeV2
+	zip
+	phone`
+
+// maxCustomerAddresses is a page size of the customer address book, Shopify doesn't allow to request more at once.
+const maxCustomerAddresses = 250
+
+// RenewCustomerAccessToken is used to extend the customer access token through Storefront customerAccessTokenRenew mutation.
+func (s *shopifyAPI) RenewCustomerAccessToken(ctx context.Context, accessToken string) (*service.VendorCustomerAccessToken, error) {
+	logger := s.logger.
+		Named("RenewCustomerAccessToken").
+		WithContext(ctx)
+
+	query := `
+	mutation CustomerAccessTokenRenew($customerAccessToken: String!) {
+	    customerAccessTokenRenew(customerAccessToken: $customerAccessToken) {
+	        customerAccessToken {
+	            accessToken
+	            expiresAt
+	        }
+	        userErrors {
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		CustomerAccessTokenRenew struct {
+			CustomerAccessToken *struct {
+				AccessToken string    `json:"accessToken"`
+				ExpiresAt   time.Time `json:"expiresAt"`
+			} `json:"customerAccessToken"`
+			UserErrors []customerUserError `json:"userErrors"`
+		} `json:"customerAccessTokenRenew"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": accessToken,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to renew customer access token", "err", err)
+		return nil, fmt.Errorf("failed to renew customer access token: %w", err)
+	}
+
+	// NOTE: expired or revoked tokens can't be renewed, the customer has to login again
+	token := data.CustomerAccessTokenRenew.CustomerAccessToken
+	if token == nil {
+		logger.Info("customer access token can't be renewed", "userErrors", data.CustomerAccessTokenRenew.UserErrors)
+		return nil, service.ErrVendorSessionExpired
+	}
+
+	logger.Info("successfully renewed customer access token")
+	return &service.VendorCustomerAccessToken{
+		AccessToken: token.AccessToken,
+		ExpiresAt:   token.ExpiresAt,
+	}, nil
+}
+
+// DeleteCustomerAccessToken is used to revoke the customer access token through Storefront customerAccessTokenDelete mutation.
+func (s *shopifyAPI) DeleteCustomerAccessToken(ctx context.Context, accessToken string) error {
+	logger := s.logger.
+		Named("DeleteCustomerAccessToken").
+		WithContext(ctx)
+
+	query := `
+	mutation CustomerAccessTokenDelete($customerAccessToken: String!) {
+	    customerAccessTokenDelete(customerAccessToken: $customerAccessToken) {
+	        deletedAccessToken
+	        userErrors {
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		CustomerAccessTokenDelete struct {
+			DeletedAccessToken *string             `json:"deletedAccessToken"`
+			UserErrors         []customerUserError `json:"userErrors"`
+		} `json:"customerAccessTokenDelete"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": accessToken,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to delete customer access token", "err", err)
+		return fmt.Errorf("failed to delete customer access token: %w", err)
+	}
+
+	// NOTE: Shopify reports expired or already deleted tokens as user errors, the token is unusable anyway
+	if data.CustomerAccessTokenDelete.DeletedAccessToken == nil {
+		logger.Info("customer access token wasn't deleted", "userErrors", data.CustomerAccessTokenDelete.UserErrors)
+		return nil
+	}
+
+	logger.Info("successfully deleted customer access token")
+	return nil
+}
+
+// GetCustomerAddresses is used to get the customer address book through Storefront API.
+func (s *shopifyAPI) GetCustomerAddresses(ctx context.Context, accessToken string) ([]entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("GetCustomerAddresses").
+		WithContext(ctx)
+
+	query := fmt.Sprintf(`
+	query GetCustomerAddresses($customerAccessToken: String!, $first: Int!) {
+	    customer(customerAccessToken: $customerAccessToken) {
+	        defaultAddress {
+	            id
+	        }
+	        addresses(first: $first) {
+	            edges {
+	                node {%s
+	                }
+	            }
+	        }
+	    }
+	}`, storefrontMailingAddressFields)
+
+	var data struct {
+		Customer *struct {
+			DefaultAddress *struct {
+				ID string `json:"id"`
+			} `json:"defaultAddress"`
+			Addresses struct {
+				Edges []struct {
+					Node mailingAddress `json:"node"`
+				} `json:"edges"`
+			} `json:"addresses"`
+		} `json:"customer"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": accessToken,
+		"first":               maxCustomerAddresses,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to get customer addresses", "err", err)
+		return nil, fmt.Errorf("failed to get customer addresses: %w", err)
+	}
+	if data.Customer == nil {
+		logger.Info("customer access token is invalid")
+		return nil, service.ErrVendorSessionExpired
+	}
+
+	var defaultAddressID string
+	if data.Customer.DefaultAddress != nil {
+		defaultAddressID = fromGID(data.Customer.DefaultAddress.ID)
+	}
+	addresses := make([]entity.CustomerAddress, 0, len(data.Customer.Addresses.Edges))
+	for _, edge := range data.Customer.Addresses.Edges {
+		address := edge.Node.toEntity()
+		address.Default = address.ID == defaultAddressID
+		addresses = append(addresses, *address)
+	}
+
+	logger.Info("successfully got customer addresses", "count", len(addresses))
+	return addresses, nil
+}
+
+// CreateCustomerAddress is used to add customer address through Storefront customerAddressCreate mutation.
+func (s *shopifyAPI) CreateCustomerAddress(ctx context.Context, opts service.CreateVendorCustomerAddressOptions) (*entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("CreateCustomerAddress").
+		WithContext(ctx)
+
+	query := fmt.Sprintf(`
+	mutation CustomerAddressCreate($customerAccessToken: String!, $address: MailingAddressInput!) {
+	    customerAddressCreate(customerAccessToken: $customerAccessToken, address: $address) {
+	        customerAddress {%s
+	        }
+	        customerUserErrors {
+	            code
+	            field
+	            message
+	        }
+	    }
+	}`, storefrontMailingAddressFields)
+
+	var data struct {
+		CustomerAddressCreate struct {
+			CustomerAddress    *mailingAddress     `json:"customerAddress"`
+			CustomerUserErrors []customerUserError `json:"customerUserErrors"`
+		} `json:"customerAddressCreate"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": opts.AccessToken,
+		"address":             toMailingAddressInput(opts.Address),
+	}, &data)
+	if err != nil {
+		logger.Error("failed to create customer address", "err", err)
+		return nil, fmt.Errorf("failed to create customer address: %w", err)
+	}
+	if err := checkCustomerUserErrors(data.CustomerAddressCreate.CustomerUserErrors, service.ErrCustomerAddressInvalidFields); err != nil {
+		logger.Info(err.Error(), "userErrors", data.CustomerAddressCreate.CustomerUserErrors)
+		return nil, err
+	}
+	if data.CustomerAddressCreate.CustomerAddress == nil {
+		logger.Error("customer address is missing in response")
+		return nil, fmt.Errorf("customer address is missing in response")
+	}
+
+	logger.Info("successfully created customer address")
+	return data.CustomerAddressCreate.CustomerAddress.toEntity(), nil
+}
+
+// UpdateCustomerAddress is used to update customer address through Storefront customerAddressUpdate mutation.
+func (s *shopifyAPI) UpdateCustomerAddress(ctx context.Context, opts service.UpdateVendorCustomerAddressOptions) (*entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("UpdateCustomerAddress").
+		WithContext(ctx).
+		With("addressID", opts.AddressID)
+
+	query := fmt.Sprintf(`
+	mutation CustomerAddressUpdate($customerAccessToken: String!, $id: ID!, $address: MailingAddressInput!) {
+	    customerAddressUpdate(customerAccessToken: $customerAccessToken, id: $id, address: $address) {
+	        customerAddress {%s
+	        }
+	        customerUserErrors {
+	            code
+	            field
+	            message
+	        }
+	    }
+	}`, storefrontMailingAddressFields)
+
+	var data struct {
+		CustomerAddressUpdate struct {
+			CustomerAddress    *mailingAddress     `json:"customerAddress"`
+			CustomerUserErrors []customerUserError `json:"customerUserErrors"`
+		} `json:"customerAddressUpdate"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": opts.AccessToken,
+		"id":                  toMailingAddressGID(opts.AddressID, opts.AccessToken),
+		"address":             toMailingAddressInput(opts.Address),
+	}, &data)
+	if err != nil {
+		logger.Error("failed to update customer address", "err", err)
+		return nil, fmt.Errorf("failed to update customer address: %w", err)
+	}
+	if err := checkCustomerUserErrors(data.CustomerAddressUpdate.CustomerUserErrors, service.ErrCustomerAddressInvalidFields); err != nil {
+		logger.Info(err.Error(), "userErrors", data.CustomerAddressUpdate.CustomerUserErrors)
+		return nil, err
+	}
+	if data.CustomerAddressUpdate.CustomerAddress == nil {
+		logger.Info("customer address not found")
+		return nil, service.ErrCustomerAddressNotFound
+	}
+
+	logger.Info("successfully updated customer address")
+	return data.CustomerAddressUpdate.CustomerAddress.toEntity(), nil
+}
+
+// DeleteCustomerAddress is used to delete customer address through Storefront customerAddressDelete mutation.
+func (s *shopifyAPI) DeleteCustomerAddress(ctx context.Context, opts service.DeleteVendorCustomerAddressOptions) error {
+	logger := s.logger.
+		Named("DeleteCustomerAddress").
+		WithContext(ctx).
+		With("addressID", opts.AddressID)
+
+	query := `
+	mutation CustomerAddressDelete($customerAccessToken: String!, $id: ID!) {
+	    customerAddressDelete(customerAccessToken: $customerAccessToken, id: $id) {
+	        deletedCustomerAddressId
+	        customerUserErrors {
+	            code
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		CustomerAddressDelete struct {
+			DeletedCustomerAddressID *string             `json:"deletedCustomerAddressId"`
+			CustomerUserErrors       []customerUserError `json:"customerUserErrors"`
+		} `json:"customerAddressDelete"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": opts.AccessToken,
+		"id":                  toMailingAddressGID(opts.AddressID, opts.AccessToken),
+	}, &data)
+	if err != nil {
+		logger.Error("failed to delete customer address", "err", err)
+		return fmt.Errorf("failed to delete customer address: %w", err)
+	}
+	if err := checkCustomerUserErrors(data.CustomerAddressDelete.CustomerUserErrors, service.ErrCustomerAddressNotFound); err != nil {
+		logger.Info(err.Error(), "userErrors", data.CustomerAddressDelete.CustomerUserErrors)
+		return err
+	}
+	if data.CustomerAddressDelete.DeletedCustomerAddressID == nil {
+		logger.Info("customer address not found")
+		return service.ErrCustomerAddressNotFound
+	}
+
+	logger.Info("successfully deleted customer address")
+	return nil
+}
+
+// SetDefaultCustomerAddress is used to set default customer address through Storefront customerDefaultAddressUpdate mutation.
+func (s *shopifyAPI) SetDefaultCustomerAddress(ctx context.Context, opts service.SetDefaultVendorCustomerAddressOptions) error {
+	logger := s.logger.
+		Named("SetDefaultCustomerAddress").
+		WithContext(ctx).
+		With("addressID", opts.AddressID)
+
+	query := `
+	mutation CustomerDefaultAddressUpdate($customerAccessToken: String!, $addressId: ID!) {
+	    customerDefaultAddressUpdate(customerAccessToken: $customerAccessToken, addressId: $addressId) {
+	        customer {
+	            id
+	        }
+	        customerUserErrors {
+	            code
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		CustomerDefaultAddressUpdate struct {
+			Customer *struct {
+				ID string `json:"id"`
+			} `json:"customer"`
+			CustomerUserErrors []customerUserError `json:"customerUserErrors"`
+		} `json:"customerDefaultAddressUpdate"`
+	}
+	err := s.storefrontGraphQLRequest(ctx, query, map[string]interface{}{
+		"customerAccessToken": opts.AccessToken,
+		"addressId":           toMailingAddressGID(opts.AddressID, opts.AccessToken),
+	}, &data)
+	if err != nil {
+		logger.Error("failed to set default customer address", "err", err)
+		return fmt.Errorf("failed to set default customer address: %w", err)
+	}
+	if err := checkCustomerUserErrors(data.CustomerDefaultAddressUpdate.CustomerUserErrors, service.ErrCustomerAddressNotFound); err != nil {
+		logger.Info(err.Error(), "userErrors", data.CustomerDefaultAddressUpdate.CustomerUserErrors)
+		return err
+	}
+	if data.CustomerDefaultAddressUpdate.Customer == nil {
+		logger.Info("customer address not found")
+		return service.ErrCustomerAddressNotFound
+	}
+
+	logger.Info("successfully set default customer address")
+	return nil
+}
+
+// toMailingAddressGID converts a numeric address id to a Storefront global id,
+// Storefront API resolves customer addresses only with the customer access token in the id.
+func toMailingAddressGID(id, accessToken string) string {
+	return toGID("MailingAddress", id) + "?model_name=CustomerAddress&customer_access_token=" + url.QueryEscape(accessToken)
+}
+
+// toMailingAddressInput converts address to Storefront MailingAddressInput, codes are preferred over names.
+func toMailingAddressInput(address entity.CustomerAddress) map[string]interface{} {
+	country := address.Country
+	if address.CountryCode != "" {
+		country = address.CountryCode
+	}
+	province := address.Province
+	if address.ProvinceCode != "" {
+		province = address.ProvinceCode
+	}
+	return map[string]interface{}{
+		"firstName": address.FirstName,
+		"lastName":  address.LastName,
+		"company":   address.Company,
+		"address1":  address.Address1,
+		"address2":  address.Address2,
+		"city":      address.City,
+		"province":  province,
+		"country":   country,
+		"zip":       address.Zip,
+		"phone":     address.Phone,
+	}
+}
+
+// checkCustomerUserErrors converts Storefront customer user errors to ErrVendorSessionExpired
+// when customer access token is invalid and to given error with []service.FieldError details otherwise.
+func checkCustomerUserErrors(userErrors []customerUserError, invalidErr error) error {
+	if len(userErrors) == 0 {
+		return nil
+	}
+	for _, e := range userErrors {
+		if e.Code == "TOKEN_INVALID" || e.Code == "UNIDENTIFIED_CUSTOMER" {
+			return service.ErrVendorSessionExpired
+		}
+	}
+	return errs.WithDetails(invalidErr, toFieldErrors(userErrors))
+}
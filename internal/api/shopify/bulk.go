@@ -0,0 +1,188 @@
+package shopify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// customersBulkQuery selects ids of all store customers, it's run by a bulk operation.
+const customersBulkQuery = `
+{
+    customers {
+        edges {
+            node {
+                id
+            }
+        }
+    }
+}`
+
+// StartCustomersExport is used to start a bulk operation exporting all store customers through Admin GraphQL API.
+// NOTE: Shopify runs only one bulk query operation per app and store at a time.
+func (v *shopifyAPI) StartCustomersExport(ctx context.Context) (string, error) {
+	logger := v.logger.
+		Named("StartCustomersExport").
+		WithContext(ctx)
+
+	query := `
+	mutation BulkOperationRunQuery($query: String!) {
+	    bulkOperationRunQuery(query: $query) {
+	        bulkOperation {
+	            id
+	        }
+	        userErrors {
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		BulkOperationRunQuery struct {
+			BulkOperation *struct {
+				ID string `json:"id"`
+			} `json:"bulkOperation"`
+			UserErrors []struct {
+				Field   []string `json:"field"`
+				Message string   `json:"message"`
+			} `json:"userErrors"`
+		} `json:"bulkOperationRunQuery"`
+	}
+	err := v.adminGraphQLRequest(ctx, query, map[string]interface{}{
+		"query": customersBulkQuery,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to start bulk operation", "err", err)
+		return "", fmt.Errorf("failed to start bulk operation: %w", err)
+	}
+	if data.BulkOperationRunQuery.BulkOperation == nil {
+		logger.Error("bulk operation wasn't started", "userErrors", data.BulkOperationRunQuery.UserErrors)
+		return "", fmt.Errorf("bulk operation wasn't started: %v", data.BulkOperationRunQuery.UserErrors)
+	}
+
+	id := data.BulkOperationRunQuery.BulkOperation.ID
+	logger.Info("successfully started bulk operation", "id", id)
+	return id, nil
+}
+
+// GetCustomersExport is used to get the state of customers export bulk operation through Admin GraphQL API.
+func (v *shopifyAPI) GetCustomersExport(ctx context.Context, id string) (*service.VendorCustomersExport, error) {
+	logger := v.logger.
+		Named("GetCustomersExport").
+		WithContext(ctx).
+		With("id", id)
+
+	query := `
+	query GetBulkOperation($id: ID!) {
+	    node(id: $id) {
+	        ... on BulkOperation {
+	            id
+	            status
+	            errorCode
+	            objectCount
+	            url
+	        }
+	    }
+	}`
+
+	var data struct {
+		Node *struct {
+			ID        string  `json:"id"`
+			Status    string  `json:"status"`
+			ErrorCode *string `json:"errorCode"`
+			// ObjectCount is UnsignedInt64 which is serialized as a string
+			ObjectCount string  `json:"objectCount"`
+			URL         *string `json:"url"`
+		} `json:"node"`
+	}
+	err := v.adminGraphQLRequest(ctx, query, map[string]interface{}{
+		"id": id,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to get bulk operation", "err", err)
+		return nil, fmt.Errorf("failed to get bulk operation: %w", err)
+	}
+	if data.Node == nil || data.Node.ID == "" {
+		logger.Info("bulk operation not found")
+		return nil, nil
+	}
+
+	export := &service.VendorCustomersExport{
+		ID: data.Node.ID,
+	}
+	export.ObjectCount, _ = strconv.Atoi(data.Node.ObjectCount)
+	if data.Node.URL != nil {
+		export.ResultURL = *data.Node.URL
+	}
+	switch data.Node.Status {
+	case "CREATED", "RUNNING":
+		export.Status = service.VendorExportStatusRunning
+	case "COMPLETED":
+		export.Status = service.VendorExportStatusCompleted
+	default:
+		// CANCELING, CANCELED, EXPIRED and FAILED operations never complete
+		export.Status = service.VendorExportStatusFailed
+		export.Error = data.Node.Status
+		if data.Node.ErrorCode != nil {
+			export.Error = fmt.Sprintf("%s: %s", data.Node.Status, *data.Node.ErrorCode)
+		}
+	}
+
+	logger.Info("successfully got bulk operation", "status", data.Node.Status)
+	return export, nil
+}
+
+// ReadExportedCustomers is used to stream the JSONL result of customers export bulk operation,
+// each line is a customer, e.g. {"id":"gid://shopify/Customer/1"}.
+func (v *shopifyAPI) ReadExportedCustomers(ctx context.Context, resultURL string, fn func(vendorCustomerID string) error) error {
+	logger := v.logger.
+		Named("ReadExportedCustomers").
+		WithContext(ctx)
+
+	// the result is a signed storage URL, so it's requested without store credentials
+	res, err := resty.New().R().
+		SetContext(ctx).
+		SetDoNotParseResponse(true).
+		Get(resultURL)
+	if err != nil {
+		logger.Error("failed to get bulk operation result", "err", err)
+		return fmt.Errorf("failed to get bulk operation result: %w", err)
+	}
+	body := res.RawBody()
+	defer body.Close()
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to get bulk operation result", "status", res.StatusCode())
+		return fmt.Errorf("failed to get bulk operation result: http status %d", res.StatusCode())
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		var line struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			logger.Error("failed to decode bulk operation result line", "err", err, "line", count+1)
+			return fmt.Errorf("failed to decode bulk operation result line %d: %w", count+1, err)
+		}
+		if err := fn(fromGID(line.ID)); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("failed to read bulk operation result", "err", err)
+		return fmt.Errorf("failed to read bulk operation result: %w", err)
+	}
+
+	logger.Info("successfully read bulk operation result", "count", count)
+	return nil
+}
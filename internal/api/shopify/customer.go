@@ -2,15 +2,19 @@ package shopify
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
 )
 
-func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.LoginCustomerOptions) (string, error) {
+func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.LoginCustomerOptions) (*service.LoggedInVendorCustomer, error) {
 	logger := s.logger.Named("GetLoggedInCustomerID").With("email", opt.Email)
 
 	query := `
@@ -24,6 +28,7 @@ func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.Logi
 	    }) {
 	        customerAccessToken {
             accessToken
+            expiresAt
 	        }
 	        customerUserErrors {
 	            code
@@ -40,8 +45,9 @@ func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.Logi
 	var customerLoginData struct {
 		Data struct {
 			CustomerAccessTokenCreate struct {
-				CustomerAccessToken struct {
-					AccessToken string `json:"accessToken"`
+				CustomerAccessToken *struct {
+					AccessToken string    `json:"accessToken"`
+					ExpiresAt   time.Time `json:"expiresAt"`
 				} `json:"customerAccessToken"`
 				CustomerUserErrors []struct {
 					Code    string `json:"code"`
@@ -60,15 +66,25 @@ func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.Logi
 		Post("")
 	if err != nil {
 		logger.Error("failed to login customer", "err", err)
-		return "", err
+		return nil, err
+	}
+	if retryAfter := getThrottleRetryAfter(resp); retryAfter > 0 {
+		logger.Info("request throttled", "retryAfter", retryAfter)
+		return nil, errs.WithDetails(service.ErrLoginCustomerVendorThrottled, service.NewRetryAfterDetails(retryAfter))
 	}
 	if resp.StatusCode() != http.StatusOK {
 		logger.Error("failed to login customer", "response", resp.String())
-		return "", fmt.Errorf("failed to login customer: http status %d, body %s", resp.StatusCode(), resp.String())
+		return nil, fmt.Errorf("failed to login customer: http status %d, body %s", resp.StatusCode(), resp.String())
+	}
+	// login fails closed: any user error (e.g. UNIDENTIFIED_CUSTOMER or CUSTOMER_DISABLED) rejects the credentials
+	if userErrors := customerLoginData.Data.CustomerAccessTokenCreate.CustomerUserErrors; len(userErrors) > 0 {
+		logger.Info("invalid email or password", "code", userErrors[0].Code)
+		return nil, service.ErrLoginCustomerInvalidEmailOrPassword
 	}
-	if len(customerLoginData.Data.CustomerAccessTokenCreate.CustomerUserErrors) > 0 && customerLoginData.Data.CustomerAccessTokenCreate.CustomerUserErrors[0].Code == "UNIDENTIFIED_CUSTOMER" {
-		logger.Info("invalid email or password")
-		return "", service.ErrLoginCustomerInvalidEmailOrPassword
+	customerAccessToken := customerLoginData.Data.CustomerAccessTokenCreate.CustomerAccessToken
+	if customerAccessToken == nil || customerAccessToken.AccessToken == "" {
+		logger.Error("customer access token is missing", "response", resp.String())
+		return nil, fmt.Errorf("customer access token is missing")
 	}
 
 	query = `
@@ -79,12 +95,12 @@ func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.Logi
   }`
 
 	variables = map[string]interface{}{
-		"accessToken": customerLoginData.Data.CustomerAccessTokenCreate.CustomerAccessToken.AccessToken,
+		"accessToken": customerAccessToken.AccessToken,
 	}
 
 	var customerData struct {
 		Data struct {
-			Customer struct {
+			Customer *struct {
 				ID string `json:"id"`
 			} `json:"customer"`
 		} `json:"data"`
@@ -99,52 +115,451 @@ func (s *shopifyAPI) GetLoggedInCustomerID(ctx context.Context, opt service.Logi
 		Post("")
 	if err != nil {
 		logger.Error("failed to get customer by access token", "err", err)
-		return "", err
+		return nil, err
+	}
+	if retryAfter := getThrottleRetryAfter(resp); retryAfter > 0 {
+		logger.Info("request throttled", "retryAfter", retryAfter)
+		return nil, errs.WithDetails(service.ErrLoginCustomerVendorThrottled, service.NewRetryAfterDetails(retryAfter))
 	}
 	if resp.StatusCode() != http.StatusOK {
 		logger.Error("failed to get customer by access token", "response", resp.String())
-		return "", fmt.Errorf("failed to get customer by access token: http status %d, body %s", resp.StatusCode(), resp.String())
+		return nil, fmt.Errorf("failed to get customer by access token: http status %d, body %s", resp.StatusCode(), resp.String())
 	}
 
+	if customerData.Data.Customer == nil || customerData.Data.Customer.ID == "" {
+		logger.Error("customer of access token is missing", "response", resp.String())
+		return nil, fmt.Errorf("customer of access token is missing")
+	}
 	customerID := strings.Replace(customerData.Data.Customer.ID, "gid://shopify/Customer/", "", 1)
 
 	logger.Info("successfully logged in customer")
-	return customerID, nil
+	return &service.LoggedInVendorCustomer{
+		ID:                   customerID,
+		AccessToken:          customerAccessToken.AccessToken,
+		AccessTokenExpiresAt: customerAccessToken.ExpiresAt,
+	}, nil
+}
+
+// adminCustomerFields is a selection of customer fields in Admin GraphQL API.
+const adminCustomerFields = `
+	id
+	firstName
+	lastName
+	email
+	phone
+	tags
+	state
+	verifiedEmail
+	note
+	emailMarketingConsent {
+		marketingState
+	}
+	defaultAddress {
+		id
+		firstName
+		lastName
+		company
+		address1
+		address2
+		city
+		province
+		provinceCode
+		country
+		countryCodeV2
+		zip
+		phone
+	}`
+
+// adminCustomer is a customer in Admin GraphQL API.
+type adminCustomer struct {
+	ID                    string   `json:"id"`
+	FirstName             string   `json:"firstName"`
+	LastName              string   `json:"lastName"`
+	Email                 string   `json:"email"`
+	Phone                 string   `json:"phone"`
+	Tags                  []string `json:"tags"`
+	State                 string   `json:"state"`
+	VerifiedEmail         bool     `json:"verifiedEmail"`
+	Note                  string   `json:"note"`
+	EmailMarketingConsent *struct {
+		MarketingState string `json:"marketingState"`
+	} `json:"emailMarketingConsent"`
+	DefaultAddress *mailingAddress `json:"defaultAddress"`
 }
 
-// ShopifyCustomer contains information about customer.
-type ShopifyCustomer struct {
-	FirstName string `json:"first_name,omitempty"`
+// mailingAddress is an address in both Admin and Storefront GraphQL APIs.
+type mailingAddress struct {
+	ID            string `json:"id"`
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	Company       string `json:"company"`
+	Address1      string `json:"address1"`
+	Address2      string `json:"address2"`
+	City          string `json:"city"`
+	Province      string `json:"province"`
+	ProvinceCode  string `json:"provinceCode"`
+	Country       string `json:"country"`
+	CountryCodeV2 string `json:"countryCodeV2"`
+	Zip           string `json:"zip"`
+	Phone         string `json:"phone"`
 }
 
-// GetCustomerByVendorID is used to get customer by given vendor id.
+type adminMetafield struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+}
+
+func (c adminCustomer) toEntity() *entity.Customer {
+	customer := &entity.Customer{
+		VendorCustomerID: fromGID(c.ID),
+		FirstName:        c.FirstName,
+		LastName:         c.LastName,
+		Email:            c.Email,
+		Phone:            c.Phone,
+		Tags:             c.Tags,
+		State:            c.State,
+		VerifiedEmail:    c.VerifiedEmail,
+		Note:             c.Note,
+		AcceptsMarketing: c.EmailMarketingConsent != nil && c.EmailMarketingConsent.MarketingState == "SUBSCRIBED",
+	}
+	if c.DefaultAddress != nil {
+		customer.DefaultAddress = c.DefaultAddress.toEntity()
+		customer.DefaultAddress.Default = true
+	}
+	return customer
+}
+
+func (a mailingAddress) toEntity() *entity.CustomerAddress {
+	return &entity.CustomerAddress{
+		ID:           fromGID(a.ID),
+		FirstName:    a.FirstName,
+		LastName:     a.LastName,
+		Company:      a.Company,
+		Address1:     a.Address1,
+		Address2:     a.Address2,
+		City:         a.City,
+		Province:     a.Province,
+		ProvinceCode: a.ProvinceCode,
+		Country:      a.Country,
+		CountryCode:  a.CountryCodeV2,
+		Zip:          a.Zip,
+		Phone:        a.Phone,
+	}
+}
+
+// GetCustomerByVendorID is used to get customer profile with store metafields by given vendor id in a single Admin GraphQL query.
 func (v *shopifyAPI) GetCustomerByVendorID(ctx context.Context, id string) (*entity.Customer, error) {
 	logger := v.logger.
 		Named("GetCustomerByID").
 		WithContext(ctx).
 		With("id", id)
 
-	url := fmt.Sprintf("/admin/api/2023-01/customers/%s.json", id)
+	// every metafield is selected by an alias, namespaces and keys are passed as variables
+	variables := map[string]interface{}{
+		"id": toGID("Customer", id),
+	}
+	var params []string
+	var metafields []string
+	for i, metafield := range parseMetafieldKeys(v.store.CustomerMetafields) {
+		params = append(params, fmt.Sprintf("$mf%[1]dNamespace: String!, $mf%[1]dKey: String!", i))
+		metafields = append(metafields, fmt.Sprintf("mf%[1]d: metafield(namespace: $mf%[1]dNamespace, key: $mf%[1]dKey) { namespace key type value }", i))
+		variables[fmt.Sprintf("mf%dNamespace", i)] = metafield[0]
+		variables[fmt.Sprintf("mf%dKey", i)] = metafield[1]
+	}
+
+	query := fmt.Sprintf(`
+	query GetCustomer($id: ID!%s) {
+		customer(id: $id) {
+			%s
+			%s
+		}
+	}`, prefixJoin(", ", params), adminCustomerFields, strings.Join(metafields, "\n"))
+
+	var data struct {
+		Customer json.RawMessage `json:"customer"`
+	}
+	err := v.adminGraphQLRequest(ctx, query, variables, &data)
+	if err != nil {
+		logger.Error("failed to get shopify customer", "err", err)
+		return nil, fmt.Errorf("failed to get shopify customer: %w", err)
+	}
+	if len(data.Customer) == 0 || string(data.Customer) == "null" {
+		logger.Info("shopify customer not found")
+		return nil, nil
+	}
+
+	var shopifyCustomer adminCustomer
+	if err := json.Unmarshal(data.Customer, &shopifyCustomer); err != nil {
+		logger.Error("failed to decode shopify customer", "err", err)
+		return nil, fmt.Errorf("failed to decode shopify customer: %w", err)
+	}
+	customer := shopifyCustomer.toEntity()
+
+	// metafields are decoded separately since their aliases are dynamic
+	var aliases map[string]json.RawMessage
+	if err := json.Unmarshal(data.Customer, &aliases); err != nil {
+		logger.Error("failed to decode shopify customer metafields", "err", err)
+		return nil, fmt.Errorf("failed to decode shopify customer metafields: %w", err)
+	}
+	for i := range metafields {
+		raw, ok := aliases[fmt.Sprintf("mf%d", i)]
+		if !ok {
+			continue
+		}
+		var metafield *adminMetafield
+		if err := json.Unmarshal(raw, &metafield); err != nil {
+			logger.Error("failed to decode shopify customer metafield", "err", err)
+			return nil, fmt.Errorf("failed to decode shopify customer metafield: %w", err)
+		}
+		if metafield == nil {
+			continue
+		}
+		customer.Metafields = append(customer.Metafields, entity.CustomerMetafield{
+			Namespace: metafield.Namespace,
+			Key:       metafield.Key,
+			Type:      metafield.Type,
+			Value:     metafield.Value,
+		})
+	}
+
+	logger.Info("successfully got shopify customer")
+	return customer, nil
+}
+
+// parseMetafieldKeys parses comma separated "namespace.key" list, invalid items are skipped.
+func parseMetafieldKeys(list string) [][2]string {
+	var keys [][2]string
+	for _, item := range strings.Split(list, ",") {
+		namespace, key, found := strings.Cut(strings.TrimSpace(item), ".")
+		if !found || namespace == "" || key == "" {
+			continue
+		}
+		keys = append(keys, [2]string{namespace, key})
+	}
+	return keys
+}
+
+// prefixJoin joins elements and prefixes the result with separator if it's not empty.
+func prefixJoin(sep string, elems []string) string {
+	if len(elems) == 0 {
+		return ""
+	}
+	return sep + strings.Join(elems, sep)
+}
+
+// GetCustomerIDByEmail is used to get customer vendor id by given email.
+func (v *shopifyAPI) GetCustomerIDByEmail(ctx context.Context, email string) (string, error) {
+	logger := v.logger.
+		Named("GetCustomerIDByEmail").
+		WithContext(ctx).
+		With("email", email)
+
+	var customers struct {
+		Customers []struct {
+			ID    int64  `json:"id"`
+			Email string `json:"email"`
+		} `json:"customers"`
+	}
+
+	res, err := v.http.R().
+		SetQueryParams(map[string]string{
+			"query":  fmt.Sprintf("email:%q", email),
+			"fields": "id,email",
+		}).
+		SetResult(&customers).
+		Get("/admin/api/2023-01/customers/search.json")
+	if err != nil {
+		logger.Error("failed to send search shopify customers request", "err", err)
+		return "", fmt.Errorf("failed to send search shopify customers request: %w", err)
+	}
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to search shopify customers", "resBody", res.String())
+		return "", fmt.Errorf("failed to search shopify customers: http status %d, body %s", res.StatusCode(), res.String())
+	}
+
+	// NOTE: search is fuzzy so we have to make sure that email is exactly the same
+	for _, customer := range customers.Customers {
+		if strings.EqualFold(customer.Email, email) {
+			logger.Info("successfully found shopify customer", "id", customer.ID)
+			return strconv.FormatInt(customer.ID, 10), nil
+		}
+	}
+
+	logger.Info("shopify customer not found")
+	return "", nil
+}
+
+// CreateCustomer is used to create a new customer with verified email.
+func (v *shopifyAPI) CreateCustomer(ctx context.Context, opts service.CreateVendorCustomerOptions) (string, error) {
+	logger := v.logger.
+		Named("CreateCustomer").
+		WithContext(ctx).
+		With("email", opts.Email)
 
 	var customer struct {
-		Customer ShopifyCustomer `json:"customer"`
+		Customer struct {
+			ID int64 `json:"id"`
+		} `json:"customer"`
 	}
 
 	res, err := v.http.R().
+		SetBody(map[string]interface{}{
+			"customer": map[string]interface{}{
+				"email":          opts.Email,
+				"first_name":     opts.FirstName,
+				"last_name":      opts.LastName,
+				"verified_email": true,
+			},
+		}).
 		SetResult(&customer).
-		Get(url)
+		Post("/admin/api/2023-01/customers.json")
+	if err != nil {
+		logger.Error("failed to send create shopify customer request", "err", err)
+		return "", fmt.Errorf("failed to send create shopify customer request: %w", err)
+	}
+	if res.StatusCode() != http.StatusCreated {
+		logger.Error("failed to create shopify customer", "resBody", res.String())
+		return "", fmt.Errorf("failed to create shopify customer: http status %d, body %s", res.StatusCode(), res.String())
+	}
+	id := strconv.FormatInt(customer.Customer.ID, 10)
+	logger = logger.With("id", id)
+
+	logger.Info("successfully created shopify customer")
+	return id, nil
+}
+
+// customerUserError is a field level error returned by Storefront customer mutations.
+type customerUserError struct {
+	Code    string   `json:"code"`
+	Field   []string `json:"field"`
+	Message string   `json:"message"`
+}
+
+// UpdateCustomer is used to update customer through Storefront customerUpdate mutation.
+func (s *shopifyAPI) UpdateCustomer(ctx context.Context, opts service.UpdateVendorCustomerOptions) (*service.UpdateVendorCustomerOutput, error) {
+	logger := s.logger.
+		Named("UpdateCustomer").
+		WithContext(ctx)
+
+	query := `
+	mutation CustomerUpdate($customerAccessToken: String!, $customer: CustomerUpdateInput!) {
+	    customerUpdate(customerAccessToken: $customerAccessToken, customer: $customer) {
+	        customer {
+	            firstName
+	            lastName
+	            phone
+	            acceptsMarketing
+	        }
+	        customerAccessToken {
+	            accessToken
+	            expiresAt
+	        }
+	        customerUserErrors {
+	            code
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	input := map[string]interface{}{}
+	if opts.FirstName != nil {
+		input["firstName"] = *opts.FirstName
+	}
+	if opts.LastName != nil {
+		input["lastName"] = *opts.LastName
+	}
+	if opts.Phone != nil {
+		input["phone"] = *opts.Phone
+	}
+	if opts.AcceptsMarketing != nil {
+		input["acceptsMarketing"] = *opts.AcceptsMarketing
+	}
+	if opts.Password != nil {
+		input["password"] = *opts.Password
+	}
+
+	var updateData struct {
+		Data struct {
+			CustomerUpdate struct {
+				Customer *struct {
+					FirstName        string `json:"firstName"`
+					LastName         string `json:"lastName"`
+					Phone            string `json:"phone"`
+					AcceptsMarketing bool   `json:"acceptsMarketing"`
+				} `json:"customer"`
+				CustomerAccessToken *struct {
+					AccessToken string    `json:"accessToken"`
+					ExpiresAt   time.Time `json:"expiresAt"`
+				} `json:"customerAccessToken"`
+				CustomerUserErrors []customerUserError `json:"customerUserErrors"`
+			} `json:"customerUpdate"`
+		} `json:"data"`
+	}
+
+	res, err := s.graphQL.R().
+		SetBody(map[string]interface{}{
+			"query": query,
+			"variables": map[string]interface{}{
+				"customerAccessToken": opts.AccessToken,
+				"customer":            input,
+			},
+		}).
+		SetResult(&updateData).
+		Post("")
 	if err != nil {
-		logger.Error("failed to send get shopify customer request", "err", err)
-		return nil, fmt.Errorf("failed to send get shopify customer request: %w", err)
+		logger.Error("failed to send update customer request", "err", err)
+		return nil, fmt.Errorf("failed to send update customer request: %w", err)
 	}
 	if res.StatusCode() != http.StatusOK {
-		logger.Error("failed to get shopify customer", "resBody", res.String())
-		return nil, fmt.Errorf("failed to get shopify customer: http status %d, body %s", res.StatusCode(), res.String())
+		logger.Error("failed to update customer", "resBody", res.String())
+		return nil, fmt.Errorf("failed to update customer: http status %d, body %s", res.StatusCode(), res.String())
 	}
-	logger = logger.With("resBody", res.String())
 
-	logger.Info("successfully got shopify customer")
-	return &entity.Customer{
-		FirstName: customer.Customer.FirstName,
-	}, nil
+	userErrors := updateData.Data.CustomerUpdate.CustomerUserErrors
+	if err := checkCustomerUserErrors(userErrors, service.ErrUpdateCustomerInvalidFields); err != nil {
+		logger.Info(err.Error(), "userErrors", userErrors)
+		return nil, err
+	}
+	if updateData.Data.CustomerUpdate.Customer == nil {
+		logger.Error("customer is missing in response", "resBody", res.String())
+		return nil, fmt.Errorf("customer is missing in response: body %s", res.String())
+	}
+
+	updated := updateData.Data.CustomerUpdate.Customer
+	output := &service.UpdateVendorCustomerOutput{
+		Customer: &entity.Customer{
+			FirstName:        updated.FirstName,
+			LastName:         updated.LastName,
+			Phone:            updated.Phone,
+			AcceptsMarketing: updated.AcceptsMarketing,
+		},
+	}
+	// NOTE: Shopify returns a new access token when password is changed, old one is revoked
+	if token := updateData.Data.CustomerUpdate.CustomerAccessToken; token != nil {
+		output.AccessToken = token.AccessToken
+		output.AccessTokenExpiresAt = token.ExpiresAt
+	}
+
+	logger.Info("successfully updated customer")
+	return output, nil
+}
+
+// toFieldErrors converts Storefront customer user errors, e.g. field ["customer", "phone"] becomes "phone".
+func toFieldErrors(userErrors []customerUserError) []service.FieldError {
+	fieldErrors := make([]service.FieldError, 0, len(userErrors))
+	for _, e := range userErrors {
+		var field string
+		if len(e.Field) > 0 {
+			field = e.Field[len(e.Field)-1]
+		}
+		fieldErrors = append(fieldErrors, service.FieldError{
+			Field:   field,
+			Code:    strings.ToLower(e.Code),
+			Message: e.Message,
+		})
+	}
+	return fieldErrors
 }
@@ -0,0 +1,98 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+func TestGetLoggedInCustomerID(t *testing.T) {
+	testCases := []struct {
+		name          string
+		loginResBody  string
+		customerBody  string
+		expectedID    string
+		expectedError error
+	}{
+		{
+			name:         "positive: customer logged in",
+			loginResBody: `{"data": {"customerAccessTokenCreate": {"customerAccessToken": {"accessToken": "customer-token", "expiresAt": "2030-01-01T00:00:00Z"}, "customerUserErrors": []}}}`,
+			customerBody: `{"data": {"customer": {"id": "gid://shopify/Customer/1001"}}}`,
+			expectedID:   "1001",
+		},
+		{
+			name:          "negative: unidentified customer",
+			loginResBody:  `{"data": {"customerAccessTokenCreate": {"customerAccessToken": null, "customerUserErrors": [{"code": "UNIDENTIFIED_CUSTOMER"}]}}}`,
+			expectedError: service.ErrLoginCustomerInvalidEmailOrPassword,
+		},
+		{
+			name:          "negative: another user error",
+			loginResBody:  `{"data": {"customerAccessTokenCreate": {"customerAccessToken": null, "customerUserErrors": [{"code": "CUSTOMER_DISABLED"}]}}}`,
+			expectedError: service.ErrLoginCustomerInvalidEmailOrPassword,
+		},
+		{
+			name:         "negative: access token is missing",
+			loginResBody: `{"data": {"customerAccessTokenCreate": {"customerAccessToken": null, "customerUserErrors": []}}}`,
+		},
+		{
+			name:         "negative: customer of access token is missing",
+			loginResBody: `{"data": {"customerAccessTokenCreate": {"customerAccessToken": {"accessToken": "customer-token"}, "customerUserErrors": []}}}`,
+			customerBody: `{"data": {"customer": null}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newStubAPI(t, &entity.Store{VendorID: "test.myshopify.com"}, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					Query     string                 `json:"query"`
+					Variables map[string]interface{} `json:"variables"`
+				}
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+				w.Header().Set("Content-Type", "application/json")
+				if strings.Contains(body.Query, "customerAccessTokenCreate") {
+					_, _ = w.Write([]byte(tc.loginResBody))
+					return
+				}
+				// customer is never queried without the access token
+				assert.Equal(t, "customer-token", body.Variables["accessToken"])
+				_, _ = w.Write([]byte(tc.customerBody))
+			})
+
+			customer, err := api.GetLoggedInCustomerID(context.Background(), service.LoginCustomerOptions{
+				Email:    "customer@example.com",
+				Password: "password",
+			})
+			if tc.expectedID == "" {
+				assert.Error(t, err)
+				if tc.expectedError != nil {
+					assert.Equal(t, tc.expectedError, err)
+				}
+				assert.Nil(t, customer)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedID, customer.ID)
+			assert.Equal(t, "customer-token", customer.AccessToken)
+		})
+	}
+}
+
+func TestGetCustomerOrdersEmptyCustomerID(t *testing.T) {
+	api := newStubAPI(t, &entity.Store{VendorID: "test.myshopify.com"}, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL.Path)
+	})
+
+	page, err := api.GetCustomerOrders(context.Background(), service.GetVendorCustomerOrdersOptions{First: 10})
+	assert.Error(t, err)
+	assert.Nil(t, page)
+}
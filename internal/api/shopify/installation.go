@@ -1,20 +1,32 @@
 package shopify
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
 )
 
+// redirectTimestampSkew is the max difference between the install or redirect timestamp and the current time.
+const redirectTimestampSkew = 5 * time.Minute
+
 // HandleInstall handles an oauth2 installation call.
-func (v *shopifyAPI) HandleInstall(c *gin.Context, redirectURL string) (*entity.Store, string, error) {
+func (v *shopifyAPI) HandleInstall(c *gin.Context, opts service.VendorInstallOptions) (*entity.Store, string, error) {
 	logger := v.logger.
 		Named("HandleInstall").
-		With("redirectURL", redirectURL)
+		With("redirectURL", opts.RedirectURL, "scopes", opts.Scopes)
 
 	if v.store == nil {
 		logger.Error("missing store vendor config")
@@ -22,20 +34,60 @@ func (v *shopifyAPI) HandleInstall(c *gin.Context, redirectURL string) (*entity.
 	}
 
 	values := url.Values{
-		"client_id":       {v.store.ClientID},
-		"scope":           {"read_products,write_products,unauthenticated_read_content,unauthenticated_read_customer_tags,unauthenticated_read_product_tags,unauthenticated_read_product_listings,unauthenticated_write_checkouts,unauthenticated_read_checkouts,unauthenticated_write_customers,unauthenticated_read_customers,read_customers"},
-		"redirect_uri":    {redirectURL},
-		"state":           {""},        // nonce
+		"client_id":       {v.clientID()},
+		"scope":           {strings.Join(opts.Scopes, ",")},
+		"redirect_uri":    {opts.RedirectURL},
+		"state":           {opts.State},
 		"grant_options[]": {"offline"}, // https://shopify.dev/concepts/about-apis/authentication#api-access-modes
 	}
 	logger = logger.With("values", values.Encode())
 
 	logger.Info("installation link successfully created")
-	return v.store, fmt.Sprintf(
-		"https://%s/admin/oauth/authorize?%s",
-		v.store.VendorID,
-		values.Encode(),
-	), nil
+	return v.store, v.domain.URL("/admin/oauth/authorize?" + values.Encode()), nil
+}
+
+type shopifyInstallQuery struct {
+	HMAC      string `form:"hmac" json:"hmac" binding:"required"`
+	Shop      string `form:"shop" json:"shop" binding:"required"`
+	Timestamp string `form:"timestamp" json:"timestamp" binding:"required"`
+}
+
+// VerifyInstallRequest verifies an oauth2 installation call is signed by Shopify for the store.
+func (v *shopifyAPI) VerifyInstallRequest(c *gin.Context) error {
+	logger := v.logger.Named("VerifyInstallRequest").WithContext(c)
+
+	if v.store == nil {
+		logger.Error("missing store vendor config")
+		return fmt.Errorf("missing store vendor config")
+	}
+
+	var query shopifyInstallQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Info("invalid request query", "err", err)
+		return service.ErrHandleInstallInvalidRequest
+	}
+	logger = logger.With("shop", query.Shop, "timestamp", query.Timestamp)
+
+	if shop, err := shopdomain.Parse(query.Shop); err != nil || shop != v.domain {
+		logger.Info("shop doesn't match the store")
+		return service.ErrHandleInstallInvalidRequest
+	}
+	if !verifyQueryHMAC(c.Request.URL.Query(), v.clientSecret()) {
+		logger.Info("invalid hmac")
+		return service.ErrHandleInstallInvalidHMAC
+	}
+	skew, err := getQueryTimestampSkew(query.Timestamp)
+	if err != nil {
+		logger.Info("invalid timestamp", "err", err)
+		return service.ErrHandleInstallInvalidRequest
+	}
+	if skew > redirectTimestampSkew || skew < -redirectTimestampSkew {
+		logger.Info("timestamp is outside of allowed skew", "skew", skew)
+		return service.ErrHandleInstallTimestampExpired
+	}
+
+	logger.Debug("install request verified")
+	return nil
 }
 
 type shopifyRedirectQuery struct {
@@ -58,22 +110,41 @@ func (v *shopifyAPI) HandleRedirect(c *gin.Context) (*entity.Store, error) {
 
 	var query shopifyRedirectQuery
 	if err := c.ShouldBindQuery(&query); err != nil {
-		logger.Error("invalid request query", "err", err)
-		return nil, fmt.Errorf("invalid request query: %w", err)
+		logger.Info("invalid request query", "err", err)
+		return nil, service.ErrHandleRedirectInvalidRequest
 	}
-	logger = logger.With("query", query)
+	logger = logger.With("shop", query.Shop, "timestamp", query.Timestamp)
 	logger.Debug("request query parsed")
 
+	// the code is exchanged with the store domain, so the redirect must come from the same store
+	if shop, err := shopdomain.Parse(query.Shop); err != nil || shop != v.domain {
+		logger.Info("shop doesn't match the store")
+		return nil, service.ErrHandleRedirectInvalidRequest
+	}
+	if !verifyQueryHMAC(c.Request.URL.Query(), v.clientSecret()) {
+		logger.Info("invalid hmac")
+		return nil, service.ErrHandleRedirectInvalidHMAC
+	}
+	skew, err := getQueryTimestampSkew(query.Timestamp)
+	if err != nil {
+		logger.Info("invalid timestamp", "err", err)
+		return nil, service.ErrHandleRedirectInvalidRequest
+	}
+	if skew > redirectTimestampSkew || skew < -redirectTimestampSkew {
+		logger.Info("timestamp is outside of allowed skew", "skew", skew)
+		return nil, service.ErrHandleRedirectTimestampExpired
+	}
+
 	// get access token
 	var credentials map[string]string
 	res, err := v.http.R().
 		SetQueryParams(map[string]string{
-			"client_id":     v.store.ClientID,
-			"client_secret": v.store.ClientSecret,
+			"client_id":     v.clientID(),
+			"client_secret": v.clientSecret(),
 			"code":          query.Code,
 		}).
 		SetResult(&credentials).
-		Post(fmt.Sprintf("https://%s/admin/oauth/access_token", v.store.VendorID))
+		Post(v.domain.URL("/admin/oauth/access_token"))
 	if err != nil {
 		logger.Error("failed to get shopify access token", "err", err)
 		return nil, fmt.Errorf("failed to get shopify access token: %w", err)
@@ -100,6 +171,37 @@ func (v *shopifyAPI) HandleRedirect(c *gin.Context) (*entity.Store, error) {
 	return v.store, nil
 }
 
+// verifyQueryHMAC checks hmac parameter of the query signed by Shopify with the store client secret,
+// the message is the rest of the query parameters sorted by name and joined as "name=value" pairs with "&".
+func verifyQueryHMAC(query url.Values, secret string) bool {
+	signature, err := hex.DecodeString(query.Get("hmac"))
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		if name == "hmac" || name == "signature" {
+			continue
+		}
+		params = append(params, name+"="+strings.Join(values, ","))
+	}
+	sort.Strings(params)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(params, "&")))
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+// getQueryTimestampSkew returns how long ago the unix timestamp parameter of the query was.
+func getQueryTimestampSkew(timestamp string) (time.Duration, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(time.Unix(seconds, 0)), nil
+}
+
 // getStoreFrontAccessToken gets a StoreFront access token for the store.
 func (v *shopifyAPI) getStoreFrontAccessToken() (string, error) {
 	logger := v.logger.Named("GetStoreFrontAccessToken")
@@ -118,7 +220,7 @@ func (v *shopifyAPI) getStoreFrontAccessToken() (string, error) {
 			},
 		}).
 		SetResult(&credentials).
-		Post(fmt.Sprintf("https://%s/admin/api/2023-04/storefront_access_tokens.json", v.store.VendorID))
+		Post(v.domain.URL("/admin/api/2023-04/storefront_access_tokens.json"))
 	if err != nil {
 		logger.Error("failed to send get StoreFront access token request", "err", err)
 		return "", fmt.Errorf("failed to send get StoreFront access token request: %w", err)
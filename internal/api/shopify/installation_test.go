@@ -0,0 +1,153 @@
+package shopify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+func TestVerifyQueryHMAC(t *testing.T) {
+	message := "code=0907a61c0c8d55e99db179b68161bc00&shop=test.myshopify.com&state=nonce&timestamp=1337178173"
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(message))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	query := func(signature string) url.Values {
+		return url.Values{
+			"timestamp": {"1337178173"},
+			"shop":      {"test.myshopify.com"},
+			"state":     {"nonce"},
+			"code":      {"0907a61c0c8d55e99db179b68161bc00"},
+			"hmac":      {signature},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		query    url.Values
+		secret   string
+		expected bool
+	}{
+		{
+			name:     "positive: valid hmac",
+			query:    query(signature),
+			secret:   "secret",
+			expected: true,
+		},
+		{
+			name: "negative: modified parameter",
+			query: func() url.Values {
+				q := query(signature)
+				q.Set("shop", "other.myshopify.com")
+				return q
+			}(),
+			secret: "secret",
+		},
+		{
+			name:   "negative: another secret",
+			query:  query(signature),
+			secret: "another",
+		},
+		{
+			name:   "negative: missing hmac",
+			query:  query(""),
+			secret: "secret",
+		},
+		{
+			name:   "negative: malformed hmac",
+			query:  query("not hex"),
+			secret: "secret",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, verifyQueryHMAC(tc.query, tc.secret))
+		})
+	}
+}
+
+func TestVerifyInstallRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api := New(&Options{Logger: logging.NewZapLogger("error")}).WithStore(&entity.Store{
+		VendorID:     "test.myshopify.com",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+
+	sign := func(query url.Values) string {
+		params := make([]string, 0, len(query))
+		for name, values := range query {
+			params = append(params, name+"="+strings.Join(values, ","))
+		}
+		sort.Strings(params)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(strings.Join(params, "&")))
+		query.Set("hmac", hex.EncodeToString(mac.Sum(nil)))
+		return query.Encode()
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	testCases := []struct {
+		name          string
+		query         string
+		expectedError error
+	}{
+		{
+			name:  "positive: signed install",
+			query: sign(url.Values{"shop": {"test.myshopify.com"}, "host": {"host"}, "timestamp": {now}}),
+		},
+		{
+			name:          "negative: missing hmac",
+			query:         url.Values{"shop": {"test.myshopify.com"}, "timestamp": {now}}.Encode(),
+			expectedError: service.ErrHandleInstallInvalidRequest,
+		},
+		{
+			name: "negative: modified parameter",
+			query: func() string {
+				query, _ := url.ParseQuery(sign(url.Values{"shop": {"test.myshopify.com"}, "host": {"host"}, "timestamp": {now}}))
+				query.Set("host", "another")
+				return query.Encode()
+			}(),
+			expectedError: service.ErrHandleInstallInvalidHMAC,
+		},
+		{
+			name:          "negative: another store",
+			query:         sign(url.Values{"shop": {"another.myshopify.com"}, "timestamp": {now}}),
+			expectedError: service.ErrHandleInstallInvalidRequest,
+		},
+		{
+			name: "negative: expired timestamp",
+			query: sign(url.Values{
+				"shop":      {"test.myshopify.com"},
+				"timestamp": {strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)},
+			}),
+			expectedError: service.ErrHandleInstallTimestampExpired,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/vendors/install?"+tc.query, nil)
+
+			assert.Equal(t, tc.expectedError, api.VerifyInstallRequest(c))
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package shopify
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// Line items page sizes, list is limited more to keep the query cost low.
+const (
+	listOrderLineItemsPageSize = 20
+	getOrderLineItemsPageSize  = 250
+)
+
+// adminOrderFields is a selection of Order fields in Admin GraphQL API, line items page size is passed as $lineItemsFirst.
+const adminOrderFields = `
+	id
+	name
+	processedAt
+	displayFinancialStatus
+	displayFulfillmentStatus
+	customer {
+	    id
+	}
+	subtotalPriceSet { shopMoney { amount currencyCode } }
+	totalShippingPriceSet { shopMoney { amount currencyCode } }
+	totalTaxSet { shopMoney { amount currencyCode } }
+	totalPriceSet { shopMoney { amount currencyCode } }
+	lineItems(first: $lineItemsFirst) {
+	    edges {
+	        node {
+	            id
+	            title
+	            variantTitle
+	            sku
+	            quantity
+	            originalUnitPriceSet { shopMoney { amount currencyCode } }
+	            originalTotalSet { shopMoney { amount currencyCode } }
+	            fulfillmentStatus
+	            image {
+	                url
+	            }
+	        }
+	    }
+	}`
+
+type adminOrder struct {
+	ID                       string    `json:"id"`
+	Name                     string    `json:"name"`
+	ProcessedAt              time.Time `json:"processedAt"`
+	DisplayFinancialStatus   string    `json:"displayFinancialStatus"`
+	DisplayFulfillmentStatus string    `json:"displayFulfillmentStatus"`
+	Customer                 *struct {
+		ID string `json:"id"`
+	} `json:"customer"`
+	SubtotalPriceSet      moneyBag `json:"subtotalPriceSet"`
+	TotalShippingPriceSet moneyBag `json:"totalShippingPriceSet"`
+	TotalTaxSet           moneyBag `json:"totalTaxSet"`
+	TotalPriceSet         moneyBag `json:"totalPriceSet"`
+	LineItems             struct {
+		Edges []struct {
+			Node adminLineItem `json:"node"`
+		} `json:"edges"`
+	} `json:"lineItems"`
+}
+
+type adminLineItem struct {
+	ID                   string   `json:"id"`
+	Title                string   `json:"title"`
+	VariantTitle         string   `json:"variantTitle"`
+	SKU                  string   `json:"sku"`
+	Quantity             int      `json:"quantity"`
+	OriginalUnitPriceSet moneyBag `json:"originalUnitPriceSet"`
+	OriginalTotalSet     moneyBag `json:"originalTotalSet"`
+	FulfillmentStatus    string   `json:"fulfillmentStatus"`
+	Image                *struct {
+		URL string `json:"url"`
+	} `json:"image"`
+}
+
+// moneyBag is an amount in shop and presentment currencies, only shop currency is used.
+type moneyBag struct {
+	ShopMoney struct {
+		Amount       string `json:"amount"`
+		CurrencyCode string `json:"currencyCode"`
+	} `json:"shopMoney"`
+}
+
+func (m moneyBag) toEntity() entity.Money {
+	return entity.Money{
+		Amount:       m.ShopMoney.Amount,
+		CurrencyCode: m.ShopMoney.CurrencyCode,
+	}
+}
+
+func (o adminOrder) toEntity() entity.Order {
+	order := entity.Order{
+		ID:                fromGID(o.ID),
+		Name:              o.Name,
+		ProcessedAt:       o.ProcessedAt,
+		FinancialStatus:   o.DisplayFinancialStatus,
+		FulfillmentStatus: o.DisplayFulfillmentStatus,
+		SubtotalPrice:     o.SubtotalPriceSet.toEntity(),
+		TotalShipping:     o.TotalShippingPriceSet.toEntity(),
+		TotalTax:          o.TotalTaxSet.toEntity(),
+		TotalPrice:        o.TotalPriceSet.toEntity(),
+		LineItems:         make([]entity.OrderLineItem, 0, len(o.LineItems.Edges)),
+	}
+	if o.Customer != nil {
+		order.CustomerID = fromGID(o.Customer.ID)
+	}
+	for _, edge := range o.LineItems.Edges {
+		item := entity.OrderLineItem{
+			ID:                fromGID(edge.Node.ID),
+			Title:             edge.Node.Title,
+			VariantTitle:      edge.Node.VariantTitle,
+			SKU:               edge.Node.SKU,
+			Quantity:          edge.Node.Quantity,
+			UnitPrice:         edge.Node.OriginalUnitPriceSet.toEntity(),
+			TotalPrice:        edge.Node.OriginalTotalSet.toEntity(),
+			FulfillmentStatus: edge.Node.FulfillmentStatus,
+		}
+		if edge.Node.Image != nil {
+			item.ImageURL = edge.Node.Image.URL
+		}
+		order.LineItems = append(order.LineItems, item)
+	}
+	return order
+}
+
+// GetCustomerOrders is used to get a page of customer orders through Admin GraphQL API.
+// NOTE: Shopify returns only orders of the last 60 days unless the app has read_all_orders scope.
+func (v *shopifyAPI) GetCustomerOrders(ctx context.Context, opts service.GetVendorCustomerOrdersOptions) (*service.OrdersPage, error) {
+	logger := v.logger.
+		Named("GetCustomerOrders").
+		WithContext(ctx).
+		With("opts", opts)
+
+	// an empty customer id would make the search query match orders of every customer
+	if opts.VendorCustomerID == "" {
+		logger.Error("vendor customer id is empty")
+		return nil, fmt.Errorf("vendor customer id is empty")
+	}
+
+	query := fmt.Sprintf(`
+	query GetCustomerOrders($query: String!, $first: Int!, $after: String, $lineItemsFirst: Int!) {
+	    orders(first: $first, after: $after, query: $query, sortKey: PROCESSED_AT, reverse: true) {
+	        edges {
+	            node {%s
+	            }
+	        }
+	        pageInfo {
+	            hasNextPage
+	            endCursor
+	        }
+	    }
+	}`, adminOrderFields)
+
+	variables := map[string]interface{}{
+		"query":          fmt.Sprintf("customer_id:%s", opts.VendorCustomerID),
+		"first":          opts.First,
+		"lineItemsFirst": listOrderLineItemsPageSize,
+	}
+	if opts.After != "" {
+		variables["after"] = opts.After
+	}
+
+	var data struct {
+		Orders struct {
+			Edges []struct {
+				Node adminOrder `json:"node"`
+			} `json:"edges"`
+			PageInfo struct {
+				HasNextPage bool    `json:"hasNextPage"`
+				EndCursor   *string `json:"endCursor"`
+			} `json:"pageInfo"`
+		} `json:"orders"`
+	}
+	if err := v.adminGraphQLRequest(ctx, query, variables, &data); err != nil {
+		logger.Error("failed to get customer orders", "err", err)
+		return nil, fmt.Errorf("failed to get customer orders: %w", err)
+	}
+
+	page := &service.OrdersPage{
+		Orders:      make([]entity.Order, 0, len(data.Orders.Edges)),
+		HasNextPage: data.Orders.PageInfo.HasNextPage,
+	}
+	if data.Orders.PageInfo.EndCursor != nil {
+		page.EndCursor = *data.Orders.PageInfo.EndCursor
+	}
+	for _, edge := range data.Orders.Edges {
+		page.Orders = append(page.Orders, edge.Node.toEntity())
+	}
+
+	logger.Info("successfully got customer orders", "count", len(page.Orders))
+	return page, nil
+}
+
+// GetOrder is used to get an order by id through Admin GraphQL API.
+func (v *shopifyAPI) GetOrder(ctx context.Context, orderID string) (*entity.Order, error) {
+	logger := v.logger.
+		Named("GetOrder").
+		WithContext(ctx).
+		With("orderID", orderID)
+
+	// Shopify rejects the whole query for malformed ids, such order just doesn't exist
+	if _, err := strconv.ParseUint(orderID, 10, 64); err != nil {
+		logger.Info("invalid order id")
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+	query GetOrder($id: ID!, $lineItemsFirst: Int!) {
+	    order(id: $id) {%s
+	    }
+	}`, adminOrderFields)
+
+	var data struct {
+		Order *adminOrder `json:"order"`
+	}
+	err := v.adminGraphQLRequest(ctx, query, map[string]interface{}{
+		"id":             toGID("Order", orderID),
+		"lineItemsFirst": getOrderLineItemsPageSize,
+	}, &data)
+	if err != nil {
+		logger.Error("failed to get order", "err", err)
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	if data.Order == nil {
+		logger.Info("order not found")
+		return nil, nil
+	}
+
+	order := data.Order.toEntity()
+
+	logger.Info("successfully got order")
+	return &order, nil
+}
@@ -0,0 +1,97 @@
+package shopify
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
+	"github.com/taraslis453/shopify-customer-auth/pkg/token"
+)
+
+// sessionTokenLeeway tolerates clock skew between Shopify and us, session tokens live for a minute only.
+const sessionTokenLeeway = 5 * time.Second
+
+// sessionTokenClaims are claims of App Bridge session tokens,
+// see https://shopify.dev/docs/apps/auth/oauth/session-tokens#anatomy-of-a-session-token.
+type sessionTokenClaims struct {
+	// Dest is the store URL, e.g. https://example.myshopify.com.
+	Dest string `json:"dest"`
+	jwt.RegisteredClaims
+}
+
+// ParseSessionToken is used to read the store of App Bridge session token, its signature isn't verified.
+func (v *shopifyAPI) ParseSessionToken(sessionToken string) (*service.VendorSessionToken, error) {
+	logger := v.logger.Named("ParseSessionToken")
+
+	var claims sessionTokenClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(sessionToken, &claims); err != nil {
+		logger.Info("failed to parse session token", "err", err)
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+	domain, err := parseSessionTokenDest(claims.Dest)
+	if err != nil {
+		logger.Info("invalid session token dest", "dest", claims.Dest, "err", err)
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+
+	return &service.VendorSessionToken{
+		StoreVendorID: domain.String(),
+		UserID:        claims.Subject,
+	}, nil
+}
+
+// VerifySessionToken is used to check App Bridge session token signature with the store client secret,
+// the token has to be issued for the client id and the store.
+func (v *shopifyAPI) VerifySessionToken(sessionToken string) (*service.VendorSessionToken, error) {
+	logger := v.logger.
+		Named("VerifySessionToken").
+		With("vendorID", v.store.VendorID)
+
+	// any token would be signed with an empty secret
+	if v.clientSecret() == "" {
+		logger.Error("missing store client secret")
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+
+	var claims sessionTokenClaims
+	err := token.ParseJWTToken(token.ParseJWTTokenOptions{
+		Token:    sessionToken,
+		Secret:   v.clientSecret(),
+		Audience: v.clientID(),
+		Leeway:   sessionTokenLeeway,
+	}, &claims)
+	if err != nil {
+		logger.Info("invalid session token", "err", err)
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+
+	domain, err := parseSessionTokenDest(claims.Dest)
+	if err != nil || domain != v.domain || claims.Issuer != v.domain.URL("/admin") {
+		logger.Info("session token is issued for another store", "dest", claims.Dest, "iss", claims.Issuer)
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+	if claims.Subject == "" {
+		logger.Info("session token has no user")
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+
+	return &service.VendorSessionToken{
+		StoreVendorID: domain.String(),
+		UserID:        claims.Subject,
+	}, nil
+}
+
+// parseSessionTokenDest returns the store domain of dest claim.
+func parseSessionTokenDest(dest string) (shopdomain.Domain, error) {
+	destURL, err := url.Parse(dest)
+	if err != nil {
+		return "", err
+	}
+	if destURL.Scheme != "https" {
+		return "", shopdomain.ErrInvalid
+	}
+	return shopdomain.Parse(destURL.Host)
+}
@@ -0,0 +1,119 @@
+package shopify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+func TestVerifySessionToken(t *testing.T) {
+	api := New(&Options{Logger: logging.NewZapLogger("error")}).WithStore(&entity.Store{
+		VendorID:     "test.myshopify.com",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+
+	now := time.Now()
+	claims := func(modify func(claims *sessionTokenClaims)) *sessionTokenClaims {
+		claims := &sessionTokenClaims{
+			Dest: "https://test.myshopify.com",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "https://test.myshopify.com/admin",
+				Subject:   "42",
+				Audience:  jwt.ClaimStrings{"client"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+				NotBefore: jwt.NewNumericDate(now.Add(-time.Second)),
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Second)),
+			},
+		}
+		if modify != nil {
+			modify(claims)
+		}
+		return claims
+	}
+	sign := func(method jwt.SigningMethod, claims *sessionTokenClaims, secret string) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+		require.NoError(t, err)
+		return token
+	}
+
+	testCases := []struct {
+		name          string
+		sessionToken  string
+		expected      *service.VendorSessionToken
+		expectedError error
+	}{
+		{
+			name:         "positive: valid token",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(nil), "secret"),
+			expected:     &service.VendorSessionToken{StoreVendorID: "test.myshopify.com", UserID: "42"},
+		},
+		{
+			name:          "negative: another secret",
+			sessionToken:  sign(jwt.SigningMethodHS256, claims(nil), "another"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name:          "negative: another signing method",
+			sessionToken:  sign(jwt.SigningMethodHS512, claims(nil), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: another audience",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.Audience = jwt.ClaimStrings{"another"}
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: another store dest",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.Dest = "https://another.myshopify.com"
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: another store issuer",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.Issuer = "https://another.myshopify.com/admin"
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: expired",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: without expiration",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.ExpiresAt = nil
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name: "negative: not valid yet",
+			sessionToken: sign(jwt.SigningMethodHS256, claims(func(claims *sessionTokenClaims) {
+				claims.NotBefore = jwt.NewNumericDate(now.Add(time.Minute))
+			}), "secret"),
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sessionToken, err := api.VerifySessionToken(tc.sessionToken)
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expected, sessionToken)
+		})
+	}
+}
@@ -1,23 +1,33 @@
 package shopify
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/taraslis453/shopify-customer-auth/config"
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 	"github.com/taraslis453/shopify-customer-auth/internal/service"
 	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
 )
 
 // shopifyAPI implements the service.VendorAPI interface.
 type shopifyAPI struct {
-	http    *resty.Client
-	graphQL *resty.Client
-	store   *entity.Store
-	logger  logging.Logger
-	cfg     *config.Config
+	http *resty.Client
+	// graphQL is a Storefront API client.
+	graphQL      *resty.Client
+	adminGraphQL *resty.Client
+	store        *entity.Store
+	// domain is the validated domain of the store, all store requests are sent to it.
+	domain shopdomain.Domain
+	logger logging.Logger
+	cfg    *config.Config
 }
 
 // Options is used to parameterize VendorShopify using New.
@@ -40,24 +50,146 @@ func New(options *Options) *shopifyAPI {
 func (v *shopifyAPI) WithStore(store *entity.Store) service.VendorAPI {
 	var h *resty.Client
 	var g *resty.Client
+	var a *resty.Client
 
-	shopName := strings.Split(store.VendorID, ".")[0]
+	domain, err := shopdomain.Parse(store.VendorID)
+	if err != nil {
+		// stores are validated on creation, requests of a store with invalid domain fail since its URLs have no host
+		v.logger.Named("WithStore").Error("invalid store vendor id", "vendorID", store.VendorID)
+	}
 
 	h = resty.New().
-		SetBaseURL(fmt.Sprintf(`https://%s.myshopify.com`, shopName)).
+		SetBaseURL(domain.URL("")).
 		SetHeader("X-Shopify-Access-Token", store.AccessToken).
 		SetHeader("Content-Type", "application/json")
 
 	g = resty.New().
-		SetBaseURL(fmt.Sprintf(`https://%s.myshopify.com/api/2023-01/graphql.json`, shopName)).
+		SetBaseURL(domain.URL("/api/2023-01/graphql.json")).
 		SetHeader("X-Shopify-Storefront-Access-Token", store.StoreFrontAccessToken).
 		SetHeader("Content-Type", "application/json")
 
+	a = resty.New().
+		SetBaseURL(domain.URL("/admin/api/2023-01/graphql.json")).
+		SetHeader("X-Shopify-Access-Token", store.AccessToken).
+		SetHeader("Content-Type", "application/json")
+
 	return &shopifyAPI{
-		store:   store,
-		http:    h,
-		graphQL: g,
-		logger:  v.logger,
-		cfg:     v.cfg,
+		store:        store,
+		domain:       domain,
+		http:         h,
+		graphQL:      g,
+		adminGraphQL: a,
+		logger:       v.logger,
+		cfg:          v.cfg,
+	}
+}
+
+// clientID returns the app client id of the store, stores of the public app use the app credentials from config.
+func (v *shopifyAPI) clientID() string {
+	if v.store.ClientID != "" {
+		return v.store.ClientID
+	}
+	return v.cfg.Shopify.APIKey
+}
+
+// clientSecret returns the app client secret of the store, stores of the public app use the app credentials from config.
+func (v *shopifyAPI) clientSecret() string {
+	if v.store.ClientSecret != "" {
+		return v.store.ClientSecret
+	}
+	return v.cfg.Shopify.APISecret
+}
+
+// defaultThrottleRetryAfter is used when Shopify doesn't tell how long to wait.
+const defaultThrottleRetryAfter = time.Second
+
+// graphQLErrors contains top level errors of a GraphQL response.
+type graphQLErrors struct {
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// getThrottleRetryAfter returns how long to wait if Shopify throttled the request and zero otherwise.
+func getThrottleRetryAfter(res *resty.Response) time.Duration {
+	if res.StatusCode() == http.StatusTooManyRequests {
+		seconds, err := strconv.ParseFloat(res.Header().Get("Retry-After"), 64)
+		if err != nil || seconds <= 0 {
+			return defaultThrottleRetryAfter
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	var body graphQLErrors
+	if err := json.Unmarshal(res.Body(), &body); err != nil {
+		return 0
+	}
+	for _, e := range body.Errors {
+		if e.Extensions.Code == "THROTTLED" {
+			return defaultThrottleRetryAfter
+		}
+	}
+
+	return 0
+}
+
+// adminGraphQLRequest sends a query to Admin GraphQL API and decodes response data into given value,
+// top level GraphQL errors are returned as an error.
+func (v *shopifyAPI) adminGraphQLRequest(ctx context.Context, query string, variables map[string]interface{}, data interface{}) error {
+	return graphQLRequest(ctx, v.adminGraphQL, query, variables, data)
+}
+
+// storefrontGraphQLRequest sends a query to Storefront GraphQL API and decodes response data into given value,
+// top level GraphQL errors are returned as an error.
+func (v *shopifyAPI) storefrontGraphQLRequest(ctx context.Context, query string, variables map[string]interface{}, data interface{}) error {
+	return graphQLRequest(ctx, v.graphQL, query, variables, data)
+}
+
+func graphQLRequest(ctx context.Context, client *resty.Client, query string, variables map[string]interface{}, data interface{}) error {
+	var body struct {
+		Data json.RawMessage `json:"data"`
+		graphQLErrors
+	}
+
+	res, err := client.R().
+		SetContext(ctx).
+		SetBody(map[string]interface{}{
+			"query":     query,
+			"variables": variables,
+		}).
+		SetResult(&body).
+		Post("")
+	if err != nil {
+		return fmt.Errorf("failed to send graphql request: %w", err)
+	}
+	if res.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to send graphql request: http status %d, body %s", res.StatusCode(), res.String())
+	}
+	if len(body.Errors) > 0 {
+		return fmt.Errorf("graphql request failed: body %s", res.String())
+	}
+
+	if err := json.Unmarshal(body.Data, data); err != nil {
+		return fmt.Errorf("failed to decode graphql response: %w", err)
+	}
+
+	return nil
+}
+
+// toGID converts a numeric resource id to Shopify global id, e.g. 1 => gid://shopify/Customer/1.
+func toGID(resource, id string) string {
+	return fmt.Sprintf("gid://shopify/%s/%s", resource, id)
+}
+
+// fromGID converts Shopify global id to a numeric resource id, e.g. gid://shopify/Customer/1 => 1.
+func fromGID(gid string) string {
+	id := gid[strings.LastIndex(gid, "/")+1:]
+	// some ids have query params, e.g. gid://shopify/MailingAddress/1?model_name=CustomerAddress
+	if i := strings.Index(id, "?"); i >= 0 {
+		id = id[:i]
 	}
+	return id
 }
@@ -0,0 +1,121 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// Token exchange parameters, see https://shopify.dev/docs/apps/auth/get-access-tokens/token-exchange.
+const (
+	tokenExchangeGrantType        = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenExchangeSubjectTokenType = "urn:ietf:params:oauth:token-type:id_token"
+)
+
+// tokenExchangeRequestedTokenTypes maps access modes to requested token types.
+var tokenExchangeRequestedTokenTypes = map[string]string{
+	service.VendorAccessModeOffline: "urn:shopify:params:oauth:token-type:offline-access-token",
+	service.VendorAccessModeOnline:  "urn:shopify:params:oauth:token-type:online-access-token",
+}
+
+// HandleTokenExchange exchanges a session token for an offline access token and gets StoreFront access token,
+// the store is installed the same way as by HandleRedirect.
+func (v *shopifyAPI) HandleTokenExchange(ctx context.Context, sessionToken string) (*entity.Store, error) {
+	logger := v.logger.Named("HandleTokenExchange").WithContext(ctx)
+
+	if v.store == nil {
+		logger.Error("missing store vendor config")
+		return nil, fmt.Errorf("missing store vendor config")
+	}
+
+	accessToken, err := v.ExchangeSessionToken(ctx, service.ExchangeVendorSessionTokenOptions{
+		SessionToken: sessionToken,
+		AccessMode:   service.VendorAccessModeOffline,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// update config
+	v.store.AccessToken = accessToken.AccessToken
+	v.store.Scope = accessToken.Scope
+
+	storeFrontAccessToken, err := v.getStoreFrontAccessToken()
+	if err != nil {
+		logger.Error("failed to get StoreFront access token", "err", err)
+		return nil, fmt.Errorf("failed to get StoreFront access token: %w", err)
+	}
+	v.store.StoreFrontAccessToken = storeFrontAccessToken
+
+	logger.Info("successfully got credentials")
+	return v.store, nil
+}
+
+// ExchangeSessionToken is used to exchange App Bridge session token for an access token through token exchange.
+func (v *shopifyAPI) ExchangeSessionToken(ctx context.Context, opts service.ExchangeVendorSessionTokenOptions) (*service.VendorAccessToken, error) {
+	logger := v.logger.
+		Named("ExchangeSessionToken").
+		WithContext(ctx).
+		With("accessMode", opts.AccessMode)
+
+	requestedTokenType, ok := tokenExchangeRequestedTokenTypes[opts.AccessMode]
+	if !ok {
+		logger.Error("unknown access mode")
+		return nil, fmt.Errorf("unknown access mode %q", opts.AccessMode)
+	}
+
+	var credentials struct {
+		AccessToken string `json:"access_token"`
+		Scope       string `json:"scope"`
+		// ExpiresIn and AssociatedUser are set for online tokens.
+		ExpiresIn      int `json:"expires_in"`
+		AssociatedUser *struct {
+			ID json.Number `json:"id"`
+		} `json:"associated_user"`
+	}
+	res, err := v.http.R().
+		SetContext(ctx).
+		SetBody(map[string]string{
+			"client_id":            v.clientID(),
+			"client_secret":        v.clientSecret(),
+			"grant_type":           tokenExchangeGrantType,
+			"subject_token":        opts.SessionToken,
+			"subject_token_type":   tokenExchangeSubjectTokenType,
+			"requested_token_type": requestedTokenType,
+		}).
+		SetResult(&credentials).
+		Post(v.domain.URL("/admin/oauth/access_token"))
+	if err != nil {
+		logger.Error("failed to exchange session token", "err", err)
+		return nil, fmt.Errorf("failed to exchange session token: %w", err)
+	}
+	// e.g. the session token is expired or issued for another app
+	if res.StatusCode() == http.StatusBadRequest || res.StatusCode() == http.StatusUnauthorized {
+		logger.Info("session token is rejected", "resBody", res.String())
+		return nil, service.ErrVerifySessionTokenInvalid
+	}
+	if res.StatusCode() != http.StatusOK {
+		logger.Error("failed to exchange session token", "resBody", res.String())
+		return nil, fmt.Errorf("failed to exchange session token: http status %d, body %s", res.StatusCode(), res.String())
+	}
+
+	accessToken := &service.VendorAccessToken{
+		AccessToken: credentials.AccessToken,
+		Scope:       credentials.Scope,
+	}
+	if credentials.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(credentials.ExpiresIn) * time.Second)
+		accessToken.ExpiresAt = &expiresAt
+	}
+	if credentials.AssociatedUser != nil {
+		accessToken.UserID = credentials.AssociatedUser.ID.String()
+	}
+
+	logger.Info("successfully exchanged session token", "scope", accessToken.Scope)
+	return accessToken, nil
+}
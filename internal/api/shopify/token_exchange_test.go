@@ -0,0 +1,184 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+// stubTransport sends store requests to the stub server, the store domain is kept in the Host header.
+type stubTransport struct {
+	server *httptest.Server
+}
+
+func (t stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	serverURL, err := url.Parse(t.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = serverURL.Scheme
+	req.URL.Host = serverURL.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newStubAPI returns the API of the store with requests sent to the stub server handler.
+func newStubAPI(t *testing.T, store *entity.Store, handler http.HandlerFunc) *shopifyAPI {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Shopify.APIKey = "app-client"
+	cfg.Shopify.APISecret = "app-secret"
+
+	api := New(&Options{Logger: logging.NewZapLogger("error"), Config: cfg}).WithStore(store).(*shopifyAPI)
+	for _, client := range []*resty.Client{api.http, api.graphQL, api.adminGraphQL} {
+		client.SetTransport(stubTransport{server: server})
+	}
+	return api
+}
+
+func TestExchangeSessionToken(t *testing.T) {
+	testCases := []struct {
+		name          string
+		store         *entity.Store
+		accessMode    string
+		status        int
+		resBody       string
+		expectedBody  map[string]string
+		expected      *service.VendorAccessToken
+		expectedError error
+	}{
+		{
+			name:       "positive: offline token",
+			store:      &entity.Store{VendorID: "test.myshopify.com", ClientID: "client", ClientSecret: "secret"},
+			accessMode: service.VendorAccessModeOffline,
+			status:     http.StatusOK,
+			resBody:    `{"access_token": "offline-token", "scope": "read_customers"}`,
+			expectedBody: map[string]string{
+				"client_id":            "client",
+				"client_secret":        "secret",
+				"grant_type":           tokenExchangeGrantType,
+				"subject_token":        "session-token",
+				"subject_token_type":   tokenExchangeSubjectTokenType,
+				"requested_token_type": tokenExchangeRequestedTokenTypes[service.VendorAccessModeOffline],
+			},
+			expected: &service.VendorAccessToken{AccessToken: "offline-token", Scope: "read_customers"},
+		},
+		{
+			name:       "positive: online token of the public app",
+			store:      &entity.Store{VendorID: "test.myshopify.com"},
+			accessMode: service.VendorAccessModeOnline,
+			status:     http.StatusOK,
+			resBody:    `{"access_token": "online-token", "scope": "read_customers", "expires_in": 3600, "associated_user": {"id": 42}}`,
+			expectedBody: map[string]string{
+				"client_id":            "app-client",
+				"client_secret":        "app-secret",
+				"grant_type":           tokenExchangeGrantType,
+				"subject_token":        "session-token",
+				"subject_token_type":   tokenExchangeSubjectTokenType,
+				"requested_token_type": tokenExchangeRequestedTokenTypes[service.VendorAccessModeOnline],
+			},
+			expected: &service.VendorAccessToken{AccessToken: "online-token", Scope: "read_customers", UserID: "42"},
+		},
+		{
+			name:          "negative: session token is rejected",
+			store:         &entity.Store{VendorID: "test.myshopify.com", ClientID: "client", ClientSecret: "secret"},
+			accessMode:    service.VendorAccessModeOffline,
+			status:        http.StatusBadRequest,
+			resBody:       `{"error": "invalid_subject_token"}`,
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+		{
+			name:          "negative: app credentials are rejected",
+			store:         &entity.Store{VendorID: "test.myshopify.com", ClientID: "client", ClientSecret: "another"},
+			accessMode:    service.VendorAccessModeOffline,
+			status:        http.StatusUnauthorized,
+			resBody:       `{"error": "invalid_client"}`,
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var body map[string]string
+			api := newStubAPI(t, tc.store, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "test.myshopify.com", r.Host)
+				assert.Equal(t, "/admin/oauth/access_token", r.URL.Path)
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.resBody))
+			})
+
+			accessToken, err := api.ExchangeSessionToken(context.Background(), service.ExchangeVendorSessionTokenOptions{
+				SessionToken: "session-token",
+				AccessMode:   tc.accessMode,
+			})
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				assert.Nil(t, accessToken)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedBody, body)
+			if tc.expected.UserID != "" {
+				require.NotNil(t, accessToken.ExpiresAt)
+				accessToken.ExpiresAt = nil
+			}
+			assert.Equal(t, tc.expected, accessToken)
+		})
+	}
+}
+
+func TestExchangeSessionTokenServerError(t *testing.T) {
+	api := newStubAPI(t, &entity.Store{VendorID: "test.myshopify.com"}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	_, err := api.ExchangeSessionToken(context.Background(), service.ExchangeVendorSessionTokenOptions{
+		SessionToken: "session-token",
+		AccessMode:   service.VendorAccessModeOffline,
+	})
+	assert.Error(t, err)
+	assert.NotEqual(t, service.ErrVerifySessionTokenInvalid, err)
+}
+
+func TestHandleTokenExchange(t *testing.T) {
+	api := newStubAPI(t, &entity.Store{ID: "store", VendorID: "test.myshopify.com"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/admin/oauth/access_token":
+			_, _ = w.Write([]byte(`{"access_token": "offline-token", "scope": "read_customers,write_customers"}`))
+		case "/admin/api/2023-04/storefront_access_tokens.json":
+			// StoreFront access token is created with the exchanged access token
+			assert.Equal(t, "offline-token", r.Header.Get("X-Shopify-Access-Token"))
+			_, _ = w.Write([]byte(`{"storefront_access_token": {"access_token": "storefront-token"}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	store, err := api.HandleTokenExchange(context.Background(), "session-token")
+	require.NoError(t, err)
+	assert.Equal(t, "store", store.ID)
+	assert.Equal(t, "offline-token", store.AccessToken)
+	assert.Equal(t, "read_customers,write_customers", store.Scope)
+	assert.Equal(t, "storefront-token", store.StoreFrontAccessToken)
+}
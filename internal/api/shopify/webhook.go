@@ -0,0 +1,153 @@
+package shopify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// maxWebhookBodySize limits webhook payloads, Shopify payloads are much smaller.
+const maxWebhookBodySize = 1 << 20
+
+// webhookPayload contains fields of webhook payloads used by the service.
+type webhookPayload struct {
+	// ID and Email are set for customers/* topics, the payload is the customer itself.
+	ID    json.Number `json:"id"`
+	Email string      `json:"email"`
+	// State is lowercase, e.g. "disabled", while Admin GraphQL API returns it uppercase.
+	State string `json:"state"`
+	// Customer is set for customers/data_request and customers/redact topics.
+	Customer *struct {
+		ID    json.Number `json:"id"`
+		Email string      `json:"email"`
+	} `json:"customer"`
+}
+
+// ParseWebhook is used to read Shopify webhook headers and payload.
+func (v *shopifyAPI) ParseWebhook(c *gin.Context) (*service.VendorWebhook, error) {
+	logger := v.logger.
+		Named("ParseWebhook").
+		WithContext(c)
+
+	webhook := &service.VendorWebhook{
+		ID:            c.GetHeader("X-Shopify-Webhook-Id"),
+		Topic:         c.GetHeader("X-Shopify-Topic"),
+		StoreVendorID: c.GetHeader("X-Shopify-Shop-Domain"),
+		Signature:     c.GetHeader("X-Shopify-Hmac-Sha256"),
+	}
+	logger = logger.With("id", webhook.ID, "topic", webhook.Topic, "storeVendorID", webhook.StoreVendorID)
+	if webhook.ID == "" || webhook.Topic == "" || webhook.StoreVendorID == "" || webhook.Signature == "" {
+		logger.Info("webhook headers are missing")
+		return nil, service.ErrHandleWebhookInvalidRequest
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		logger.Info("failed to read webhook body", "err", err)
+		return nil, service.ErrHandleWebhookInvalidRequest
+	}
+	webhook.Body = body
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		logger.Info("failed to decode webhook body", "err", err)
+		return nil, service.ErrHandleWebhookInvalidRequest
+	}
+	switch {
+	case payload.Customer != nil:
+		webhook.VendorCustomerID = payload.Customer.ID.String()
+		webhook.CustomerEmail = payload.Customer.Email
+	case strings.HasPrefix(webhook.Topic, "customers/"):
+		webhook.VendorCustomerID = payload.ID.String()
+		webhook.CustomerEmail = payload.Email
+		webhook.CustomerState = strings.ToUpper(payload.State)
+	}
+
+	logger.Info("successfully parsed webhook")
+	return webhook, nil
+}
+
+// VerifyWebhook is used to check X-Shopify-Hmac-Sha256 signature with the store client secret.
+func (v *shopifyAPI) VerifyWebhook(webhook *service.VendorWebhook) bool {
+	signature, err := base64.StdEncoding.DecodeString(webhook.Signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(v.clientSecret()))
+	mac.Write(webhook.Body)
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+// RegisterWebhook is used to create a webhook subscription through Admin GraphQL API.
+func (v *shopifyAPI) RegisterWebhook(ctx context.Context, opts service.RegisterVendorWebhookOptions) error {
+	logger := v.logger.
+		Named("RegisterWebhook").
+		WithContext(ctx).
+		With("topic", opts.Topic, "callbackURL", opts.CallbackURL)
+
+	query := `
+	mutation WebhookSubscriptionCreate($topic: WebhookSubscriptionTopic!, $webhookSubscription: WebhookSubscriptionInput!) {
+	    webhookSubscriptionCreate(topic: $topic, webhookSubscription: $webhookSubscription) {
+	        webhookSubscription {
+	            id
+	        }
+	        userErrors {
+	            field
+	            message
+	        }
+	    }
+	}`
+
+	var data struct {
+		WebhookSubscriptionCreate struct {
+			WebhookSubscription *struct {
+				ID string `json:"id"`
+			} `json:"webhookSubscription"`
+			UserErrors []struct {
+				Field   []string `json:"field"`
+				Message string   `json:"message"`
+			} `json:"userErrors"`
+		} `json:"webhookSubscriptionCreate"`
+	}
+	err := v.adminGraphQLRequest(ctx, query, map[string]interface{}{
+		"topic": toWebhookSubscriptionTopic(opts.Topic),
+		"webhookSubscription": map[string]interface{}{
+			"callbackUrl": opts.CallbackURL,
+			"format":      "JSON",
+		},
+	}, &data)
+	if err != nil {
+		logger.Error("failed to create webhook subscription", "err", err)
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	if data.WebhookSubscriptionCreate.WebhookSubscription == nil {
+		for _, userErr := range data.WebhookSubscriptionCreate.UserErrors {
+			// the subscription of the topic with the same callback URL is reported as taken address
+			if strings.Contains(userErr.Message, "already been taken") {
+				logger.Info("webhook subscription already exists")
+				return nil
+			}
+		}
+		logger.Error("webhook subscription wasn't created", "userErrors", data.WebhookSubscriptionCreate.UserErrors)
+		return fmt.Errorf("webhook subscription wasn't created: %v", data.WebhookSubscriptionCreate.UserErrors)
+	}
+
+	logger.Info("successfully registered webhook", "id", data.WebhookSubscriptionCreate.WebhookSubscription.ID)
+	return nil
+}
+
+// toWebhookSubscriptionTopic converts a webhook topic to Admin GraphQL API enum, e.g. app/uninstalled => APP_UNINSTALLED.
+func toWebhookSubscriptionTopic(topic string) string {
+	return strings.ToUpper(strings.ReplaceAll(topic, "/", "_"))
+}
@@ -0,0 +1,52 @@
+package shopify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"shop_domain":"test.myshopify.com","customer":{"id":1,"email":"john@example.com"}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	api := New(&Options{Logger: logging.NewZapLogger("error")}).WithStore(&entity.Store{
+		VendorID:     "test.myshopify.com",
+		ClientSecret: "secret",
+	})
+
+	testCases := []struct {
+		name     string
+		webhook  *service.VendorWebhook
+		expected bool
+	}{
+		{
+			name:     "positive: valid signature",
+			webhook:  &service.VendorWebhook{Signature: signature, Body: body},
+			expected: true,
+		},
+		{
+			name:    "negative: modified body",
+			webhook: &service.VendorWebhook{Signature: signature, Body: append([]byte(" "), body...)},
+		},
+		{
+			name:    "negative: malformed signature",
+			webhook: &service.VendorWebhook{Signature: "not base64", Body: body},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, api.VerifyWebhook(tc.webhook))
+		})
+	}
+}
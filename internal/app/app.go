@@ -1,19 +1,24 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
 	"github.com/taraslis453/shopify-customer-auth/pkg/httpserver"
 	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
 	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
 
+	"github.com/taraslis453/shopify-customer-auth/internal/api/captcha"
+	"github.com/taraslis453/shopify-customer-auth/internal/api/oidc"
 	"github.com/taraslis453/shopify-customer-auth/internal/api/shopify"
 	"github.com/taraslis453/shopify-customer-auth/internal/storage"
 
@@ -26,6 +31,79 @@ import (
 func Run(cfg *config.Config) {
 	logger := logging.NewZapLogger(cfg.Log.Level)
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	backgroundTasks := background.New(backgroundCtx)
+
+	services := newServices(cfg, logger, backgroundTasks)
+
+	backgroundTasks.Go(func(ctx context.Context) {
+		runVendorTokenRenewer(ctx, services.Customer, cfg.Auth.VendorTokenRenewInterval, logger)
+	})
+	backgroundTasks.Go(func(ctx context.Context) {
+		runWebhookProcessor(ctx, services.Webhook, cfg.Webhook.RetryInterval, logger)
+	})
+	backgroundTasks.Go(func(ctx context.Context) {
+		runRateLimitCleaner(ctx, services.RateLimit, cfg.RateLimit.CleanupInterval, logger)
+	})
+	backgroundTasks.Go(func(ctx context.Context) {
+		runCustomerImportResumer(ctx, services.CustomerImport, cfg.CustomerImport.Lease, logger)
+	})
+
+	httpHandler := gin.New()
+	// client IP identifies clients of rate limits and login lockouts, so it's read from trusted proxies only
+	var trustedProxies []string
+	for _, proxy := range cfg.HTTP.TrustedProxies {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := httpHandler.SetTrustedProxies(trustedProxies); err != nil {
+		logger.Fatal("app - Run - SetTrustedProxies", "err", err)
+	}
+
+	httpController.New(httpController.Options{
+		Handler:    httpHandler,
+		Services:   services,
+		Logger:     logger,
+		Config:     cfg,
+		Background: backgroundTasks,
+	})
+
+	httpServer := httpserver.New(
+		httpHandler,
+		httpserver.Port(cfg.HTTP.Port),
+		httpserver.ReadTimeout(time.Second*60),
+		httpserver.WriteTimeout(time.Second*60),
+		httpserver.ShutdownTimeout(time.Second*30),
+	)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	var err error
+	select {
+	case s := <-interrupt:
+		logger.Info("app - Run - signal: " + s.String())
+
+	case err = <-httpServer.Notify():
+		logger.Error("app - Run - httpServer.Notify", "err", err)
+	}
+
+	err = httpServer.Shutdown()
+	if err != nil {
+		logger.Error("app - Run - httpServer.Shutdown", "err", err)
+	}
+
+	// no new tasks are started once the server is shut down, running ones are cancelled and waited for,
+	// interrupted webhooks and customer imports are resumed on the next start
+	stopBackground()
+	backgroundTasks.Wait()
+}
+
+// newServices connects to the database, migrates it and initializes services with their dependencies,
+// tasks outliving requests are run by backgroundTasks.
+func newServices(cfg *config.Config, logger logging.Logger, backgroundTasks *background.Group) service.Services {
 	postgresql, err := postgresql.NewPostgreSQLGorm(postgresql.Config{
 		User:     cfg.PostgreSQL.User,
 		Password: cfg.PostgreSQL.Password,
@@ -39,14 +117,57 @@ func Run(cfg *config.Config) {
 	err = postgresql.DB.AutoMigrate(
 		&entity.Store{},
 		&entity.Customer{},
+		&entity.OIDCProvider{},
+		&entity.CustomerIdentity{},
+		&entity.LoginAttempt{},
+		&entity.RateLimitBucket{},
+		&entity.ComplianceLog{},
+		&entity.CustomerDataExport{},
+		&entity.CustomerCacheEntry{},
+		&entity.CustomerImport{},
+		&entity.WebhookEvent{},
 	)
 	if err != nil {
 		log.Fatal(fmt.Errorf("automigration failed: %w", err))
 	}
+	if err := storage.BackfillCustomerStores(postgresql); err != nil {
+		log.Fatal(fmt.Errorf("failed to backfill customer stores: %w", err))
+	}
+	unbound, err := storage.RequireCustomerStores(postgresql)
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to require customer stores: %w", err))
+	}
+	if unbound > 0 {
+		logger.Warn("app - newServices - customers are not bound to stores, bind them by POST /admin/stores/:storeId/bind-unbound-customers", "count", unbound)
+	}
+	if err := storage.DropComplianceLogData(postgresql); err != nil {
+		log.Fatal(fmt.Errorf("failed to drop compliance log data: %w", err))
+	}
+	if err := storage.CanonicalizeStoreVendorIDs(postgresql); err != nil {
+		log.Fatal(fmt.Errorf("failed to canonicalize store vendor ids: %w", err))
+	}
+	if err := storage.BackfillStoreDisabledAt(postgresql); err != nil {
+		log.Fatal(fmt.Errorf("failed to backfill store disabled at: %w", err))
+	}
 
 	storages := service.Storages{
-		Customer: storage.NewCustomerStorage(postgresql),
-		Store:    storage.NewStoreStorage(postgresql),
+		Customer:           storage.NewCustomerStorage(postgresql),
+		CustomerIdentity:   storage.NewCustomerIdentityStorage(postgresql),
+		Store:              storage.NewStoreStorage(postgresql),
+		OIDCProvider:       storage.NewOIDCProviderStorage(postgresql),
+		LoginAttempt:       storage.NewLoginAttemptStorage(postgresql),
+		ComplianceLog:      storage.NewComplianceLogStorage(postgresql),
+		CustomerDataExport: storage.NewCustomerDataExportStorage(postgresql),
+		RateLimit:          storage.NewMemoryRateLimitStorage(),
+		CustomerCache:      storage.NewMemoryCustomerCacheStorage(cfg.CustomerCache.Size),
+		CustomerImport:     storage.NewCustomerImportStorage(postgresql),
+		WebhookEvent:       storage.NewWebhookEventStorage(postgresql),
+	}
+	if cfg.RateLimit.Backend == "postgresql" {
+		storages.RateLimit = storage.NewRateLimitStorage(postgresql)
+	}
+	if cfg.CustomerCache.Backend == "postgresql" {
+		storages.CustomerCache = storage.NewCustomerCacheStorage(postgresql)
 	}
 
 	apis := service.APIs{
@@ -54,50 +175,111 @@ func Run(cfg *config.Config) {
 			Logger: logger,
 			Config: cfg,
 		}),
+		OIDC: oidc.New(&oidc.Options{
+			Logger: logger,
+		}),
+		Captcha: captcha.New(&captcha.Options{
+			Logger: logger,
+		}),
 	}
 
 	serviceOptions := service.Options{
-		APIs:     apis,
-		Storages: storages,
-		Config:   cfg,
-		Logger:   logger,
+		APIs:       apis,
+		Storages:   storages,
+		Config:     cfg,
+		Logger:     logger,
+		Background: backgroundTasks,
 	}
 
-	services := service.Services{
-		Customer: service.NewCustomerService(serviceOptions),
-		Vendor:   service.NewVendorService(serviceOptions),
+	return service.Services{
+		Customer:       service.NewCustomerService(serviceOptions),
+		Vendor:         service.NewVendorService(serviceOptions),
+		RateLimit:      service.NewRateLimitService(serviceOptions),
+		Webhook:        service.NewWebhookService(serviceOptions),
+		CustomerImport: service.NewCustomerImportService(serviceOptions),
+		Store:          service.NewStoreService(serviceOptions),
 	}
+}
 
-	httpHandler := gin.New()
+// runVendorTokenRenewer renews vendor access tokens close to expiration and deletes expired cached customers,
+// customer sessions and login attempts with given interval until ctx is canceled.
+func runVendorTokenRenewer(ctx context.Context, customerService service.CustomerService, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	httpController.New(httpController.Options{
-		Handler:  httpHandler,
-		Services: services,
-		Logger:   logger,
-		Config:   cfg,
-	})
+	for {
+		if err := customerService.RenewVendorAccessTokens(ctx); err != nil {
+			logger.Error("app - runVendorTokenRenewer - RenewVendorAccessTokens", "err", err)
+		}
+		if err := customerService.DeleteExpiredCachedCustomers(ctx); err != nil {
+			logger.Error("app - runVendorTokenRenewer - DeleteExpiredCachedCustomers", "err", err)
+		}
+		if err := customerService.ClearExpiredCustomerSessions(ctx); err != nil {
+			logger.Error("app - runVendorTokenRenewer - ClearExpiredCustomerSessions", "err", err)
+		}
+		if err := customerService.DeleteExpiredLoginAttempts(ctx); err != nil {
+			logger.Error("app - runVendorTokenRenewer - DeleteExpiredLoginAttempts", "err", err)
+		}
 
-	httpServer := httpserver.New(
-		httpHandler,
-		httpserver.Port(cfg.HTTP.Port),
-		httpserver.ReadTimeout(time.Second*60),
-		httpserver.WriteTimeout(time.Second*60),
-		httpserver.ShutdownTimeout(time.Second*30),
-	)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+// runWebhookProcessor retries due webhooks and deletes expired ones with given interval until ctx is canceled.
+func runWebhookProcessor(ctx context.Context, webhookService service.WebhookService, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	select {
-	case s := <-interrupt:
-		logger.Info("app - Run - signal: " + s.String())
+	for {
+		if err := webhookService.ProcessWebhooks(ctx); err != nil {
+			logger.Error("app - runWebhookProcessor - ProcessWebhooks", "err", err)
+		}
 
-	case err = <-httpServer.Notify():
-		logger.Error("app - Run - httpServer.Notify", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	err = httpServer.Shutdown()
-	if err != nil {
-		logger.Error("app - Run - httpServer.Shutdown", "err", err)
+// runRateLimitCleaner deletes rate limit buckets which are full again with given interval until ctx is canceled.
+func runRateLimitCleaner(ctx context.Context, rateLimitService service.RateLimitService, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := rateLimitService.DeleteFullRateLimitBuckets(ctx); err != nil {
+			logger.Error("app - runRateLimitCleaner - DeleteFullRateLimitBuckets", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runCustomerImportResumer runs unfinished customer imports which aren't run by other replicas with given interval
+// until ctx is canceled.
+func runCustomerImportResumer(ctx context.Context, customerImportService service.CustomerImportService, interval time.Duration, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := customerImportService.ResumeCustomerImports(ctx); err != nil {
+			logger.Error("app - runCustomerImportResumer - ResumeCustomerImports", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
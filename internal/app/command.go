@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// RunCommand - runs a CLI subcommand given by args, e.g. import-customers -shop example.myshopify.com.
+func RunCommand(cfg *config.Config, args []string) error {
+	logger := logging.NewZapLogger(cfg.Log.Level)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "import-customers":
+		return importCustomersCommand(ctx, cfg, logger, args[1:])
+	case "stores":
+		return storesCommand(ctx, cfg, logger, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, available commands: import-customers, stores", args[0])
+	}
+}
+
+// importCustomersCommand imports existing vendor customers of the store and waits until it's finished,
+// an interrupted import is resumed by running the command again.
+func importCustomersCommand(ctx context.Context, cfg *config.Config, logger logging.Logger, args []string) error {
+	flags := flag.NewFlagSet("import-customers", flag.ContinueOnError)
+	shop := flags.String("shop", "", "vendor id of the store, e.g. example.myshopify.com")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *shop == "" {
+		return fmt.Errorf("-shop is required")
+	}
+
+	services := newServices(cfg, logger, background.New(ctx))
+
+	customerImport, err := services.CustomerImport.StartCustomerImport(ctx, service.StartCustomerImportOptions{
+		StoreVendorID: *shop,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start customer import: %w", err)
+	}
+	logger.Info("app - importCustomersCommand - running customer import", "customerImportID", customerImport.ID)
+
+	customerImport, err = services.CustomerImport.RunCustomerImport(ctx, customerImport.ID)
+	if err != nil {
+		return fmt.Errorf("failed to run customer import: %w", err)
+	}
+	if customerImport.Status != entity.CustomerImportStatusCompleted {
+		return fmt.Errorf("customer import %s is %s: %s", customerImport.ID, customerImport.Status, customerImport.Error)
+	}
+
+	logger.Info("app - importCustomersCommand - customer import completed",
+		"customerImportID", customerImport.ID, "importedCount", customerImport.ImportedCount)
+	return nil
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// storeSettingFlags are flags of optional store fields shared by create and update subcommands.
+var storeSettingFlags = []struct {
+	name  string
+	usage string
+}{
+	{"rate-limits", `rate limits of route groups, e.g. "login=5/1m,customer=120/1m"`},
+	{"captcha-provider", "CAPTCHA provider, one of hcaptcha, recaptcha, turnstile"},
+	{"captcha-secret-key", "CAPTCHA provider secret key"},
+	{"captcha-endpoints", "comma separated endpoints protected by CAPTCHA, e.g. login"},
+	{"customer-metafields", `comma separated "namespace.key" customer metafields exposed to customers`},
+	{"customer-tag-claims", `customer tags to token claims rules, e.g. "vip-*=role:vip"`},
+	{"customer-cache-ttl", `TTL of cached customer profiles, e.g. "10m"`},
+	{"scopes", "comma separated access scopes requested on install, empty to request SHOPIFY_SCOPES"},
+}
+
+// storesCommand manages stores, e.g. stores create -vendor-id example.myshopify.com -client-id X -client-secret Y.
+// Stores are printed as JSON with masked secrets.
+func storesCommand(ctx context.Context, cfg *config.Config, logger logging.Logger, args []string) error {
+	usage := "usage: stores list|get|create|update|disable|enable|delete|install-link [flags]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "list", "get", "create", "update", "disable", "enable", "delete", "install-link":
+	default:
+		return fmt.Errorf("unknown stores command %q, %s", args[0], usage)
+	}
+
+	flags := flag.NewFlagSet("stores "+args[0], flag.ContinueOnError)
+	var (
+		id           = flags.String("id", "", "store id")
+		withDisabled = flags.Bool("with-disabled", false, "list disabled stores too")
+		vendorID     = flags.String("vendor-id", "", "vendor id of the store, e.g. example.myshopify.com")
+		clientID     = flags.String("client-id", "", "custom app client id, empty for stores of the public app")
+		clientSecret = flags.String("client-secret", "", "custom app client secret, empty for stores of the public app")
+		settings     = map[string]*string{}
+	)
+	for _, f := range storeSettingFlags {
+		settings[f.name] = flags.String(f.name, "", f.usage)
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if args[0] != "list" && args[0] != "create" && *id == "" {
+		return fmt.Errorf("-id is required")
+	}
+
+	stores := newServices(cfg, logger, background.New(ctx)).Store
+
+	var result interface{}
+	var err error
+	switch args[0] {
+	case "list":
+		result, err = stores.ListStores(ctx, service.ListStoresOptions{WithDisabled: *withDisabled})
+	case "get":
+		result, err = stores.GetStore(ctx, *id)
+	case "create":
+		if *vendorID == "" {
+			return fmt.Errorf("-vendor-id is required")
+		}
+		result, err = stores.CreateStore(ctx, service.CreateStoreOptions{
+			VendorID:     *vendorID,
+			ClientID:     *clientID,
+			ClientSecret: *clientSecret,
+			StoreSettings: service.StoreSettings{
+				RateLimits:         *settings["rate-limits"],
+				CaptchaProvider:    *settings["captcha-provider"],
+				CaptchaSecretKey:   *settings["captcha-secret-key"],
+				CaptchaEndpoints:   *settings["captcha-endpoints"],
+				CustomerMetafields: *settings["customer-metafields"],
+				CustomerTagClaims:  *settings["customer-tag-claims"],
+				CustomerCacheTTL:   *settings["customer-cache-ttl"],
+				Scopes:             *settings["scopes"],
+			},
+		})
+	case "update":
+		// only flags which are passed are updated, so a field can be cleared with an empty value
+		set := map[string]*string{}
+		flags.Visit(func(f *flag.Flag) {
+			value := f.Value.String()
+			set[f.Name] = &value
+		})
+		result, err = stores.UpdateStore(ctx, service.UpdateStoreOptions{
+			ID:                 *id,
+			ClientID:           set["client-id"],
+			ClientSecret:       set["client-secret"],
+			RateLimits:         set["rate-limits"],
+			CaptchaProvider:    set["captcha-provider"],
+			CaptchaSecretKey:   set["captcha-secret-key"],
+			CaptchaEndpoints:   set["captcha-endpoints"],
+			CustomerMetafields: set["customer-metafields"],
+			CustomerTagClaims:  set["customer-tag-claims"],
+			CustomerCacheTTL:   set["customer-cache-ttl"],
+			Scopes:             set["scopes"],
+		})
+	case "disable":
+		result, err = stores.DisableStore(ctx, *id)
+	case "enable":
+		result, err = stores.EnableStore(ctx, *id)
+	case "delete":
+		err = stores.DeleteStore(ctx, *id)
+		result = map[string]string{"message": "store deleted"}
+	case "install-link":
+		var installURL string
+		installURL, err = stores.GetStoreInstallURL(ctx, *id)
+		result = map[string]string{"installUrl": installURL}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run stores %s: %w", args[0], err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
@@ -0,0 +1,144 @@
+package httpcontroller
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+// adminRouter represents admin tooling router.
+type adminRouter struct {
+	routerContext
+	background *background.Group
+}
+
+// newAdminRoutes is used to setup admin routes, they are protected by the admin API key.
+func newAdminRoutes(options RouterOptions) {
+	r := &adminRouter{
+		routerContext{
+			services: options.Services,
+			logger:   options.Logger.Named("adminRoutes"),
+			cfg:      options.Config,
+		},
+		options.Background,
+	}
+
+	p := options.Handler.Group("/admin", newAdminAuthMiddleware(options))
+	{
+		p.POST("/customer-imports", errorHandler(options, r.startCustomerImport))
+		p.GET("/customer-imports/:importId", errorHandler(options, r.getCustomerImport))
+
+		p.POST("/stores", errorHandler(options, r.createStore))
+		p.GET("/stores", errorHandler(options, r.listStores))
+		p.GET("/stores/:storeId", errorHandler(options, r.getStore))
+		p.PATCH("/stores/:storeId", errorHandler(options, r.updateStore))
+		p.POST("/stores/:storeId/disable", errorHandler(options, r.disableStore))
+		p.POST("/stores/:storeId/enable", errorHandler(options, r.enableStore))
+		p.DELETE("/stores/:storeId", errorHandler(options, r.deleteStore))
+		p.GET("/stores/:storeId/install-link", errorHandler(options, r.getStoreInstallLink))
+		p.POST("/stores/:storeId/bind-unbound-customers", errorHandler(options, r.bindUnboundCustomers))
+		p.GET("/stores/:storeId/customer-data-exports", errorHandler(options, r.listCustomerDataExports))
+		p.GET("/stores/:storeId/customer-data-exports/:exportId", errorHandler(options, r.getCustomerDataExport))
+	}
+}
+
+// newAdminAuthMiddleware is used to check the admin API key passed as a bearer token.
+func newAdminAuthMiddleware(options RouterOptions) gin.HandlerFunc {
+	logger := options.Logger.Named("adminAuthMiddleware")
+
+	return errorHandler(options, func(c *gin.Context) (interface{}, *httpErr) {
+		apiKey := options.Config.Admin.APIKey
+		if apiKey == "" {
+			logger.Info("admin api is disabled")
+			return nil, &httpErr{Type: httpErrTypeClient, Status: http.StatusNotFound, Message: "admin api is disabled"}
+		}
+
+		token, err := getAuthToken(c.GetHeader("Authorization"))
+		if err != nil {
+			logger.Info(err.Error())
+			return nil, &httpErr{Type: httpErrTypeClient, Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			logger.Info("invalid admin api key")
+			return nil, &httpErr{Type: httpErrTypeClient, Status: http.StatusUnauthorized, Code: fmt.Sprint(http.StatusUnauthorized), Message: "invalid admin api key"}
+		}
+
+		return nil, nil
+	})
+}
+
+type startCustomerImportRequestBody struct {
+	Shop string `json:"shop" binding:"required"`
+}
+
+func (r *adminRouter) startCustomerImport(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("startCustomerImport").WithContext(c)
+
+	var body startCustomerImportRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+	logger = logger.With("body", body)
+
+	customerImport, err := r.services.CustomerImport.StartCustomerImport(c, service.StartCustomerImportOptions{
+		StoreVendorID: body.Shop,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to start customer import", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to start customer import", Details: err}
+	}
+
+	// the import outlives the request, its progress is polled by GET /admin/customer-imports/:importId
+	r.background.Go(func(ctx context.Context) {
+		if _, err := r.services.CustomerImport.RunCustomerImport(ctx, customerImport.ID); err != nil {
+			logger.Error("failed to run customer import", "err", err, "customerImportID", customerImport.ID)
+		}
+	})
+
+	logger.Info("successfully started customer import", "customerImportID", customerImport.ID)
+	c.JSON(http.StatusAccepted, customerImport)
+	return nil, nil
+}
+
+func (r *adminRouter) getCustomerImport(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getCustomerImport").WithContext(c)
+
+	importID := c.Param("importId")
+	logger = logger.With("importID", importID)
+
+	// ids are uuids in storage, malformed id can't belong to any import
+	if _, err := uuid.Parse(importID); err != nil {
+		logger.Info("malformed import id")
+		clientErr := newClientErr(c, service.ErrCustomerImportNotFound)
+		clientErr.Status = http.StatusNotFound
+		return nil, clientErr
+	}
+
+	customerImport, err := r.services.CustomerImport.GetCustomerImport(c, importID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			clientErr := newClientErr(c, err)
+			clientErr.Status = http.StatusNotFound
+			return nil, clientErr
+		}
+		logger.Error("failed to get customer import", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to get customer import", Details: err}
+	}
+
+	logger.Info("successfully got customer import")
+	return customerImport, nil
+}
@@ -0,0 +1,342 @@
+package httpcontroller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+)
+
+// NOTE: request bodies contain store secrets, so they aren't logged.
+
+type createStoreRequestBody struct {
+	VendorID           string `json:"vendorId" binding:"required"`
+	ClientID           string `json:"clientId"`
+	ClientSecret       string `json:"clientSecret"`
+	RateLimits         string `json:"rateLimits"`
+	CaptchaProvider    string `json:"captchaProvider"`
+	CaptchaSecretKey   string `json:"captchaSecretKey"`
+	CaptchaEndpoints   string `json:"captchaEndpoints"`
+	CustomerMetafields string `json:"customerMetafields"`
+	CustomerTagClaims  string `json:"customerTagClaims"`
+	CustomerCacheTTL   string `json:"customerCacheTtl"`
+	Scopes             string `json:"scopes"`
+}
+
+func (r *adminRouter) createStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("createStore").WithContext(c)
+
+	var body createStoreRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+	logger = logger.With("vendorID", body.VendorID)
+
+	store, err := r.services.Store.CreateStore(c, service.CreateStoreOptions{
+		VendorID:     body.VendorID,
+		ClientID:     body.ClientID,
+		ClientSecret: body.ClientSecret,
+		StoreSettings: service.StoreSettings{
+			RateLimits:         body.RateLimits,
+			CaptchaProvider:    body.CaptchaProvider,
+			CaptchaSecretKey:   body.CaptchaSecretKey,
+			CaptchaEndpoints:   body.CaptchaEndpoints,
+			CustomerMetafields: body.CustomerMetafields,
+			CustomerTagClaims:  body.CustomerTagClaims,
+			CustomerCacheTTL:   body.CustomerCacheTTL,
+			Scopes:             body.Scopes,
+		},
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			clientErr := newClientErr(c, err)
+			if errs.GetCode(err) == errs.GetCode(service.ErrCreateStoreAlreadyExists) {
+				clientErr.Status = http.StatusConflict
+			}
+			return nil, clientErr
+		}
+		logger.Error("failed to create store", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to create store", Details: err}
+	}
+
+	logger.Info("successfully created store", "storeID", store.ID)
+	c.JSON(http.StatusCreated, store)
+	return nil, nil
+}
+
+type listStoresRequestQuery struct {
+	WithDisabled bool `form:"withDisabled"`
+}
+
+func (r *adminRouter) listStores(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("listStores").WithContext(c)
+
+	var query listStoresRequestQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Info("failed to parse request query", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request query", Details: err}
+	}
+	logger = logger.With("query", query)
+
+	stores, err := r.services.Store.ListStores(c, service.ListStoresOptions{
+		WithDisabled: query.WithDisabled,
+	})
+	if err != nil {
+		logger.Error("failed to list stores", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to list stores", Details: err}
+	}
+
+	logger.Info("successfully listed stores")
+	return stores, nil
+}
+
+func (r *adminRouter) getStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getStore").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	store, err := r.services.Store.GetStore(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to get store", err)
+	}
+
+	logger.Info("successfully got store")
+	return store, nil
+}
+
+type updateStoreRequestBody struct {
+	ClientID           *string `json:"clientId"`
+	ClientSecret       *string `json:"clientSecret"`
+	RateLimits         *string `json:"rateLimits"`
+	CaptchaProvider    *string `json:"captchaProvider"`
+	CaptchaSecretKey   *string `json:"captchaSecretKey"`
+	CaptchaEndpoints   *string `json:"captchaEndpoints"`
+	CustomerMetafields *string `json:"customerMetafields"`
+	CustomerTagClaims  *string `json:"customerTagClaims"`
+	CustomerCacheTTL   *string `json:"customerCacheTtl"`
+	Scopes             *string `json:"scopes"`
+}
+
+func (r *adminRouter) updateStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("updateStore").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	var body updateStoreRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+
+	store, err := r.services.Store.UpdateStore(c, service.UpdateStoreOptions{
+		ID:                 storeID,
+		ClientID:           body.ClientID,
+		ClientSecret:       body.ClientSecret,
+		RateLimits:         body.RateLimits,
+		CaptchaProvider:    body.CaptchaProvider,
+		CaptchaSecretKey:   body.CaptchaSecretKey,
+		CaptchaEndpoints:   body.CaptchaEndpoints,
+		CustomerMetafields: body.CustomerMetafields,
+		CustomerTagClaims:  body.CustomerTagClaims,
+		CustomerCacheTTL:   body.CustomerCacheTTL,
+		Scopes:             body.Scopes,
+	})
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to update store", err)
+	}
+
+	logger.Info("successfully updated store")
+	return store, nil
+}
+
+func (r *adminRouter) disableStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("disableStore").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	store, err := r.services.Store.DisableStore(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to disable store", err)
+	}
+
+	logger.Info("successfully disabled store")
+	return store, nil
+}
+
+func (r *adminRouter) enableStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("enableStore").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	store, err := r.services.Store.EnableStore(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to enable store", err)
+	}
+
+	logger.Info("successfully enabled store")
+	return store, nil
+}
+
+func (r *adminRouter) deleteStore(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("deleteStore").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	if err := r.services.Store.DeleteStore(c, storeID); err != nil {
+		return nil, r.storeErr(c, logger, "failed to delete store", err)
+	}
+
+	logger.Info("successfully deleted store")
+	c.Status(http.StatusNoContent)
+	return nil, nil
+}
+
+type getStoreInstallLinkResponseBody struct {
+	InstallURL string `json:"installUrl"`
+}
+
+func (r *adminRouter) getStoreInstallLink(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getStoreInstallLink").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	installURL, err := r.services.Store.GetStoreInstallURL(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to get store install link", err)
+	}
+
+	logger.Info("successfully got store install link")
+	return getStoreInstallLinkResponseBody{InstallURL: installURL}, nil
+}
+
+func (r *adminRouter) bindUnboundCustomers(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("bindUnboundCustomers").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	output, err := r.services.Store.BindUnboundCustomers(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to bind unbound customers", err)
+	}
+
+	logger.Info("successfully bound unbound customers")
+	return output, nil
+}
+
+func (r *adminRouter) listCustomerDataExports(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("listCustomerDataExports").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	logger = logger.With("storeID", storeID)
+
+	exports, err := r.services.Store.ListCustomerDataExports(c, storeID)
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to list customer data exports", err)
+	}
+
+	logger.Info("successfully listed customer data exports")
+	return exports, nil
+}
+
+func (r *adminRouter) getCustomerDataExport(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getCustomerDataExport").WithContext(c)
+
+	storeID, clientErr := getStoreIDParam(c)
+	if clientErr != nil {
+		logger.Info("malformed store id")
+		return nil, clientErr
+	}
+	exportID := c.Param("exportId")
+	logger = logger.With("storeID", storeID, "exportID", exportID)
+
+	// ids are uuids in storage, malformed id can't belong to any export
+	if _, err := uuid.Parse(exportID); err != nil {
+		logger.Info("malformed export id")
+		clientErr := newClientErr(c, service.ErrCustomerDataExportNotFound)
+		clientErr.Status = http.StatusNotFound
+		return nil, clientErr
+	}
+
+	export, err := r.services.Store.GetCustomerDataExport(c, service.GetCustomerDataExportOptions{
+		StoreID: storeID,
+		ID:      exportID,
+	})
+	if err != nil {
+		return nil, r.storeErr(c, logger, "failed to get customer data export", err)
+	}
+
+	logger.Info("successfully got customer data export")
+	return export, nil
+}
+
+// storeErr converts an error of store service to httpErr, missing stores and exports are returned with not found status.
+func (r *adminRouter) storeErr(c *gin.Context, logger logging.Logger, message string, err error) *httpErr {
+	if errs.IsExpected(err) {
+		logger.Info(err.Error())
+		clientErr := newClientErr(c, err)
+		switch errs.GetCode(err) {
+		case errs.GetCode(service.ErrStoreNotFound), errs.GetCode(service.ErrCustomerDataExportNotFound):
+			clientErr.Status = http.StatusNotFound
+		}
+		return clientErr
+	}
+	logger.Error(message, "err", err)
+	return &httpErr{Type: httpErrTypeServer, Message: message, Details: err}
+}
+
+// getStoreIDParam returns storeId path parameter, malformed ids are reported as missing stores
+// since ids are uuids in storage.
+func getStoreIDParam(c *gin.Context) (string, *httpErr) {
+	storeID := c.Param("storeId")
+	if _, err := uuid.Parse(storeID); err != nil {
+		clientErr := newClientErr(c, service.ErrStoreNotFound)
+		clientErr.Status = http.StatusNotFound
+		return "", clientErr
+	}
+	return storeID, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	// third party
@@ -13,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/taraslis453/shopify-customer-auth/config"
 	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
 	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
 	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
 )
@@ -26,10 +28,11 @@ type routerContext struct {
 
 // RouterOptions provides shared options for all routers.
 type RouterOptions struct {
-	Handler  *gin.RouterGroup
-	Services service.Services
-	Logger   logging.Logger
-	Config   *config.Config
+	Handler    *gin.RouterGroup
+	Services   service.Services
+	Logger     logging.Logger
+	Config     *config.Config
+	Background *background.Group
 }
 
 // Options is used to parameterize http controller via New.
@@ -38,6 +41,8 @@ type Options struct {
 	Services service.Services
 	Logger   logging.Logger
 	Config   *config.Config
+	// Background runs tasks which outlive requests, e.g. customer imports.
+	Background *background.Group
 }
 
 // New is used to create new http controller.
@@ -46,22 +51,28 @@ func New(options Options) {
 	options.Handler.Use(gin.Logger(), gin.Recovery(), requestIDMiddleware, corsMiddleware)
 
 	routerOptions := RouterOptions{
-		Handler:  options.Handler.Group(""),
-		Services: options.Services,
-		Logger:   options.Logger.Named("HTTPController"),
-		Config:   options.Config,
+		Handler:    options.Handler.Group(""),
+		Services:   options.Services,
+		Logger:     options.Logger.Named("HTTPController"),
+		Config:     options.Config,
+		Background: options.Background,
 	}
 
 	options.Handler.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
 	{
 		newCustomerRoutes(routerOptions)
 		newVendorRoutes(routerOptions)
+		newWebhookRoutes(routerOptions)
+		newAdminRoutes(routerOptions)
+		newEmbeddedRoutes(routerOptions)
 	}
 }
 
 // httpErr provides a base error type for all http controller errors
 type httpErr struct {
-	Type    httpErrType `json:"-"`
+	Type httpErrType `json:"-"`
+	// Status overrides default http status of the error type
+	Status  int         `json:"-"`
 	Code    string      `json:"code,omitempty"`
 	Message string      `json:"message"`
 	Details interface{} `json:"details,omitempty"`
@@ -120,8 +131,12 @@ func errorHandler(options RouterOptions, handler func(c *gin.Context) (interface
 				logger.Error("internal server error")
 				c.AbortWithStatusJSON(http.StatusInternalServerError, err)
 			} else {
+				status := http.StatusUnprocessableEntity
+				if err.Status != 0 {
+					status = err.Status
+				}
 				logger.Info("client error")
-				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, err)
+				c.AbortWithStatusJSON(status, err)
 			}
 			return
 		}
@@ -131,6 +146,19 @@ func errorHandler(options RouterOptions, handler func(c *gin.Context) (interface
 	}
 }
 
+// newClientErr converts an expected service error with its details to httpErr. Errors with service.RetryAfterDetails
+// are returned with too many requests status and Retry-After header.
+func newClientErr(c *gin.Context, err error) *httpErr {
+	clientErr := &httpErr{Type: httpErrTypeClient, Message: err.Error(), Code: errs.GetCode(err), Details: errs.GetDetails(err)}
+
+	if details, ok := errs.GetDetails(err).(service.RetryAfterDetails); ok {
+		c.Header("Retry-After", strconv.Itoa(details.RetryAfter))
+		clientErr.Status = http.StatusTooManyRequests
+	}
+
+	return clientErr
+}
+
 // corsMiddleware - used to allow incoming cross-origin requests.
 func corsMiddleware(c *gin.Context) {
 	c.Header("Access-Control-Allow-Origin", "*")
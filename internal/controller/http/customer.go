@@ -1,8 +1,14 @@
 package httpcontroller
 
 import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 	"github.com/taraslis453/shopify-customer-auth/internal/service"
 	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
 )
@@ -22,15 +28,33 @@ func newCustomerRoutes(options RouterOptions) {
 
 	p := options.Handler.Group("/customers")
 	{
-		p.POST("/login", errorHandler(options, r.loginCustomer))
-		p.POST("/refresh-token", errorHandler(options, r.refreshToken))
-		p.GET("/me", newAuthMiddleware(options), errorHandler(options, r.getCustomer))
+		loginRateLimit := newRateLimitMiddleware(options, service.RateLimitGroupLogin, rateLimitByIP)
+		customerRateLimit := newRateLimitMiddleware(options, service.RateLimitGroupCustomer, rateLimitByCustomer)
+
+		p.POST("/login", loginRateLimit, errorHandler(options, r.loginCustomer))
+		p.POST("/refresh-token", loginRateLimit, errorHandler(options, r.refreshToken))
+		p.GET("/me", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.getCustomer))
+		p.PATCH("/me", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.updateCustomer))
+		p.POST("/me/password", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.changeCustomerPassword))
+		p.GET("/me/addresses", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.listCustomerAddresses))
+		p.POST("/me/addresses", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.createCustomerAddress))
+		p.PUT("/me/addresses/:addressId", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.updateCustomerAddress))
+		p.DELETE("/me/addresses/:addressId", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.deleteCustomerAddress))
+		p.POST("/me/addresses/:addressId/default", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.setDefaultCustomerAddress))
+		p.GET("/me/orders", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.listCustomerOrders))
+		p.GET("/me/orders/:orderId", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.getCustomerOrder))
+		p.GET("/me/storefront-token", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.getStorefrontAccessToken))
+		p.POST("/me/logout", newAuthMiddleware(options), customerRateLimit, errorHandler(options, r.logoutCustomer))
+		p.GET("/oidc/:provider/authorize", loginRateLimit, errorHandler(options, r.startOIDCLogin))
+		p.GET("/oidc/:provider/callback", loginRateLimit, errorHandler(options, r.oidcCallback))
 	}
 }
 
 type loginCustomerRequestBody struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// CaptchaToken is a CAPTCHA widget response, required if store protects login with CAPTCHA.
+	CaptchaToken string `json:"captchaToken"`
 }
 
 type loginCustomerResponse struct {
@@ -52,11 +76,13 @@ func (r *customerRoutes) loginCustomer(c *gin.Context) (interface{}, *httpErr) {
 		Email:         body.Email,
 		Password:      body.Password,
 		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		ClientIP:      c.ClientIP(),
+		CaptchaToken:  body.CaptchaToken,
 	})
 	if err != nil {
 		if errs.IsExpected(err) {
 			logger.Info(err.Error())
-			return nil, &httpErr{Type: httpErrTypeClient, Message: err.Error(), Code: errs.GetCode(err)}
+			return nil, newClientErr(c, err)
 		}
 
 		logger.Error("failed to login user", "err", err)
@@ -82,7 +108,10 @@ func (r *customerRoutes) refreshToken(c *gin.Context) (interface{}, *httpErr) {
 		return nil, &httpErr{Type: httpErrTypeClient, Message: err.Error()}
 	}
 
-	refreshedToken, err := r.services.Customer.RefreshCustomerAccessToken(c, token)
+	refreshedToken, err := r.services.Customer.RefreshCustomerAccessToken(c, service.RefreshCustomerAccessTokenOptions{
+		Token:         token,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+	})
 	if err != nil {
 		if errs.IsExpected(err) {
 			logger.Info(err.Error())
@@ -98,9 +127,57 @@ func (r *customerRoutes) refreshToken(c *gin.Context) (interface{}, *httpErr) {
 	}, nil
 }
 
-type getCustomerResponseBody struct {
-	ID        string `json:"id"`
-	FirstName string `json:"firstName"`
+// getCustomerResponseBody contains selected customer profile fields.
+type getCustomerResponseBody map[string]interface{}
+
+// newGetCustomerResponseBody builds response body with given service.CustomerProfileFields, all fields are used if it's empty.
+func newGetCustomerResponseBody(customer *entity.Customer, fields []string) getCustomerResponseBody {
+	if len(fields) == 0 {
+		fields = service.CustomerProfileFields
+	}
+
+	body := make(getCustomerResponseBody, len(fields))
+	for _, field := range fields {
+		switch field {
+		case service.CustomerProfileFieldID:
+			body[field] = customer.ID
+		case service.CustomerProfileFieldFirstName:
+			body[field] = customer.FirstName
+		case service.CustomerProfileFieldLastName:
+			body[field] = customer.LastName
+		case service.CustomerProfileFieldEmail:
+			body[field] = customer.Email
+		case service.CustomerProfileFieldPhone:
+			body[field] = customer.Phone
+		case service.CustomerProfileFieldAcceptsMarketing:
+			body[field] = customer.AcceptsMarketing
+		case service.CustomerProfileFieldTags:
+			body[field] = customer.Tags
+		case service.CustomerProfileFieldState:
+			body[field] = customer.State
+		case service.CustomerProfileFieldVerifiedEmail:
+			body[field] = customer.VerifiedEmail
+		case service.CustomerProfileFieldDefaultAddress:
+			body[field] = customer.DefaultAddress
+		case service.CustomerProfileFieldNote:
+			body[field] = customer.Note
+		case service.CustomerProfileFieldMetafields:
+			body[field] = customer.Metafields
+		}
+	}
+
+	return body
+}
+
+// parseFieldsQuery parses comma separated ?fields= query.
+func parseFieldsQuery(c *gin.Context) []string {
+	var fields []string
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
 }
 
 func (r *customerRoutes) getCustomer(c *gin.Context) (interface{}, *httpErr) {
@@ -109,27 +186,261 @@ func (r *customerRoutes) getCustomer(c *gin.Context) (interface{}, *httpErr) {
 	customerID := c.GetString("userID")
 	logger = logger.With("customerID", customerID)
 
+	fields := parseFieldsQuery(c)
+	logger = logger.With("fields", fields)
+
 	customer, err := r.services.Customer.GetCustomer(c, service.GetCustomerOptions{
 		ID:            customerID,
 		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		Fields:        fields,
 	})
 	if err != nil {
 		if errs.IsExpected(err) {
 			logger.Info(err.Error())
-			return nil, &httpErr{Type: httpErrTypeClient, Message: err.Error(), Code: errs.GetCode(err)}
+			return nil, newClientErr(c, err)
 		}
 		logger.Error("failed to get customer", "err", err)
 		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to get customer", Details: err}
 	}
 
 	logger.Info("successfully got customer")
-	return getCustomerResponseBody{
-		ID:        customer.ID,
-		FirstName: customer.FirstName,
+	return newGetCustomerResponseBody(customer, fields), nil
+}
+
+type updateCustomerRequestBody struct {
+	FirstName        *string `json:"firstName"`
+	LastName         *string `json:"lastName"`
+	Phone            *string `json:"phone"`
+	AcceptsMarketing *bool   `json:"acceptsMarketing"`
+}
+
+func (r *customerRoutes) updateCustomer(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("updateCustomer").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	var body updateCustomerRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+	logger = logger.With("body", body)
+
+	customer, err := r.services.Customer.UpdateCustomer(c, service.UpdateCustomerOptions{
+		ID:               customerID,
+		StoreVendorID:    getStoreVendorID(c.GetHeader("Origin")),
+		FirstName:        body.FirstName,
+		LastName:         body.LastName,
+		Phone:            body.Phone,
+		AcceptsMarketing: body.AcceptsMarketing,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to update customer", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to update customer", Details: err}
+	}
+
+	logger.Info("successfully updated customer")
+	return newGetCustomerResponseBody(customer, []string{
+		service.CustomerProfileFieldID,
+		service.CustomerProfileFieldFirstName,
+		service.CustomerProfileFieldLastName,
+		service.CustomerProfileFieldPhone,
+		service.CustomerProfileFieldAcceptsMarketing,
+	}), nil
+}
+
+type changeCustomerPasswordRequestBody struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required"`
+}
+
+type changeCustomerPasswordResponseBody struct {
+	AccessToken string `json:"accessToken"`
+}
+
+func (r *customerRoutes) changeCustomerPassword(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("changeCustomerPassword").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	var body changeCustomerPasswordRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+
+	accessToken, err := r.services.Customer.ChangeCustomerPassword(c, service.ChangeCustomerPasswordOptions{
+		ID:              customerID,
+		StoreVendorID:   getStoreVendorID(c.GetHeader("Origin")),
+		CurrentPassword: body.CurrentPassword,
+		Password:        body.Password,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			clientErr := newClientErr(c, err)
+			if errs.GetCode(err) == errs.GetCode(service.ErrChangeCustomerPasswordInvalidCurrentPassword) {
+				clientErr.Status = http.StatusForbidden
+			}
+			return nil, clientErr
+		}
+		logger.Error("failed to change customer password", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to change customer password", Details: err}
+	}
+
+	logger.Info("successfully changed customer password")
+	return changeCustomerPasswordResponseBody{
+		AccessToken: accessToken,
+	}, nil
+}
+
+type getStorefrontAccessTokenResponseBody struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func (r *customerRoutes) getStorefrontAccessToken(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getStorefrontAccessToken").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	token, err := r.services.Customer.GetStorefrontAccessToken(c, service.GetStorefrontAccessTokenOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to get storefront access token", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to get storefront access token", Details: err}
+	}
+
+	logger.Info("successfully got storefront access token")
+	return getStorefrontAccessTokenResponseBody{
+		AccessToken: token.AccessToken,
+		ExpiresAt:   token.ExpiresAt,
+	}, nil
+}
+
+func (r *customerRoutes) logoutCustomer(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("logoutCustomer").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	err := r.services.Customer.LogoutCustomer(c, service.LogoutCustomerOptions{
+		ID: customerID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to logout customer", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to logout customer", Details: err}
+	}
+
+	logger.Info("successfully logged out customer")
+	c.Status(http.StatusNoContent)
+	return nil, nil
+}
+
+type startOIDCLoginRequestQuery struct {
+	Shop      string `form:"shop" binding:"required"`
+	ReturnURL string `form:"returnUrl"`
+	// CaptchaToken is a CAPTCHA widget response, required if store protects login with CAPTCHA.
+	CaptchaToken string `form:"captchaToken"`
+}
+
+func (r *customerRoutes) startOIDCLogin(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("startOIDCLogin").WithContext(c)
+
+	var query startOIDCLoginRequestQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Info("failed to parse request query", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request query", Details: err}
+	}
+	logger = logger.With("query", query)
+
+	authorizationURL, err := r.services.Customer.StartOIDCLogin(c, service.StartOIDCLoginOptions{
+		StoreVendorID: query.Shop,
+		ProviderName:  c.Param("provider"),
+		ReturnURL:     query.ReturnURL,
+		CaptchaToken:  query.CaptchaToken,
+		ClientIP:      c.ClientIP(),
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to start oidc login", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to start oidc login", Details: err}
+	}
+
+	logger.Info("redirecting to oidc provider")
+	c.Redirect(http.StatusFound, authorizationURL)
+	return nil, nil
+}
+
+type oidcCallbackRequestQuery struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+func (r *customerRoutes) oidcCallback(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("oidcCallback").WithContext(c)
+
+	var query oidcCallbackRequestQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Info("failed to parse request query", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request query", Details: err}
+	}
+	if query.Error != "" {
+		logger.Info("oidc provider returned an error", "error", query.Error, "errorDescription", query.ErrorDescription)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "oidc login failed", Code: query.Error, Details: query.ErrorDescription}
+	}
+
+	output, err := r.services.Customer.LoginCustomerWithOIDC(c, service.LoginCustomerWithOIDCOptions{
+		ProviderName: c.Param("provider"),
+		Code:         query.Code,
+		State:        query.State,
+		ClientIP:     c.ClientIP(),
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to login customer with oidc", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to login customer with oidc", Details: err}
+	}
+
+	if output.ReturnURL != "" {
+		// NOTE: token is passed in fragment so it doesn't reach store server logs
+		logger.Info("successfully logged in user, redirecting to return url")
+		c.Redirect(http.StatusFound, output.ReturnURL+"#"+url.Values{"accessToken": {output.AccessToken}}.Encode())
+		return nil, nil
+	}
+
+	logger.Info("successfully logged in user")
+	return loginCustomerResponse{
+		AccessToken: output.AccessToken,
 	}, nil
 }
 
 func getStoreVendorID(origin string) string {
 	// https://taras-store88.myshopify.com => taras-store88.myshopify.com
-	return origin[8:]
+	return strings.TrimPrefix(origin, "https://")
 }
@@ -0,0 +1,194 @@
+package httpcontroller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+type customerAddressRequestBody struct {
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Company      string `json:"company"`
+	Address1     string `json:"address1"`
+	Address2     string `json:"address2"`
+	City         string `json:"city"`
+	Province     string `json:"province"`
+	ProvinceCode string `json:"provinceCode"`
+	Country      string `json:"country"`
+	CountryCode  string `json:"countryCode"`
+	Zip          string `json:"zip"`
+	Phone        string `json:"phone"`
+}
+
+func (b customerAddressRequestBody) toEntity() entity.CustomerAddress {
+	return entity.CustomerAddress{
+		FirstName:    b.FirstName,
+		LastName:     b.LastName,
+		Company:      b.Company,
+		Address1:     b.Address1,
+		Address2:     b.Address2,
+		City:         b.City,
+		Province:     b.Province,
+		ProvinceCode: b.ProvinceCode,
+		Country:      b.Country,
+		CountryCode:  b.CountryCode,
+		Zip:          b.Zip,
+		Phone:        b.Phone,
+	}
+}
+
+type listCustomerAddressesResponseBody struct {
+	Addresses []entity.CustomerAddress `json:"addresses"`
+}
+
+func (r *customerRoutes) listCustomerAddresses(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("listCustomerAddresses").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	addresses, err := r.services.Customer.ListCustomerAddresses(c, service.ListCustomerAddressesOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to list customer addresses", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to list customer addresses", Details: err}
+	}
+
+	logger.Info("successfully listed customer addresses")
+	return listCustomerAddressesResponseBody{
+		Addresses: addresses,
+	}, nil
+}
+
+type createCustomerAddressRequestBody struct {
+	customerAddressRequestBody
+	Default bool `json:"default"`
+}
+
+func (r *customerRoutes) createCustomerAddress(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("createCustomerAddress").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	var body createCustomerAddressRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+	logger = logger.With("body", body)
+
+	address, err := r.services.Customer.CreateCustomerAddress(c, service.CreateCustomerAddressOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		Address:       body.toEntity(),
+		Default:       body.Default,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to create customer address", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to create customer address", Details: err}
+	}
+
+	logger.Info("successfully created customer address")
+	return address, nil
+}
+
+func (r *customerRoutes) updateCustomerAddress(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("updateCustomerAddress").WithContext(c)
+
+	customerID := c.GetString("userID")
+	addressID := c.Param("addressId")
+	logger = logger.With("customerID", customerID, "addressID", addressID)
+
+	var body customerAddressRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		logger.Info("failed to parse request body", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request body", Details: err}
+	}
+	logger = logger.With("body", body)
+
+	address, err := r.services.Customer.UpdateCustomerAddress(c, service.UpdateCustomerAddressOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		AddressID:     addressID,
+		Address:       body.toEntity(),
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to update customer address", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to update customer address", Details: err}
+	}
+
+	logger.Info("successfully updated customer address")
+	return address, nil
+}
+
+func (r *customerRoutes) deleteCustomerAddress(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("deleteCustomerAddress").WithContext(c)
+
+	customerID := c.GetString("userID")
+	addressID := c.Param("addressId")
+	logger = logger.With("customerID", customerID, "addressID", addressID)
+
+	err := r.services.Customer.DeleteCustomerAddress(c, service.DeleteCustomerAddressOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		AddressID:     addressID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to delete customer address", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to delete customer address", Details: err}
+	}
+
+	logger.Info("successfully deleted customer address")
+	c.Status(http.StatusNoContent)
+	return nil, nil
+}
+
+func (r *customerRoutes) setDefaultCustomerAddress(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("setDefaultCustomerAddress").WithContext(c)
+
+	customerID := c.GetString("userID")
+	addressID := c.Param("addressId")
+	logger = logger.With("customerID", customerID, "addressID", addressID)
+
+	err := r.services.Customer.SetDefaultCustomerAddress(c, service.SetDefaultCustomerAddressOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		AddressID:     addressID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to set default customer address", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to set default customer address", Details: err}
+	}
+
+	logger.Info("successfully set default customer address")
+	c.Status(http.StatusNoContent)
+	return nil, nil
+}
@@ -0,0 +1,88 @@
+package httpcontroller
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+type listCustomerOrdersRequestQuery struct {
+	First int    `form:"first" binding:"omitempty,min=1,max=50"`
+	After string `form:"after"`
+}
+
+type listCustomerOrdersResponseBody struct {
+	Orders   []entity.Order `json:"orders"`
+	PageInfo pageInfo       `json:"pageInfo"`
+}
+
+// pageInfo describes a cursor paginated list, EndCursor is passed as ?after= to get the next page.
+type pageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+func (r *customerRoutes) listCustomerOrders(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("listCustomerOrders").WithContext(c)
+
+	customerID := c.GetString("userID")
+	logger = logger.With("customerID", customerID)
+
+	var query listCustomerOrdersRequestQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		logger.Info("failed to parse request query", "err", err)
+		return nil, &httpErr{Type: httpErrTypeClient, Message: "invalid request query", Details: err}
+	}
+	logger = logger.With("query", query)
+
+	page, err := r.services.Customer.ListCustomerOrders(c, service.ListCustomerOrdersOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		First:         query.First,
+		After:         query.After,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to list customer orders", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to list customer orders", Details: err}
+	}
+
+	logger.Info("successfully listed customer orders")
+	return listCustomerOrdersResponseBody{
+		Orders: page.Orders,
+		PageInfo: pageInfo{
+			HasNextPage: page.HasNextPage,
+			EndCursor:   page.EndCursor,
+		},
+	}, nil
+}
+
+func (r *customerRoutes) getCustomerOrder(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("getCustomerOrder").WithContext(c)
+
+	customerID := c.GetString("userID")
+	orderID := c.Param("orderId")
+	logger = logger.With("customerID", customerID, "orderID", orderID)
+
+	order, err := r.services.Customer.GetCustomerOrder(c, service.GetCustomerOrderOptions{
+		ID:            customerID,
+		StoreVendorID: getStoreVendorID(c.GetHeader("Origin")),
+		OrderID:       orderID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, newClientErr(c, err)
+		}
+		logger.Error("failed to get customer order", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to get customer order", Details: err}
+	}
+
+	logger.Info("successfully got customer order")
+	return order, nil
+}
@@ -0,0 +1,79 @@
+package httpcontroller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+// embeddedRouter represents router of the app embedded into vendor admin.
+type embeddedRouter struct {
+	routerContext
+}
+
+// newEmbeddedRoutes is used to setup routes of the embedded app, they are protected by vendor session tokens.
+func newEmbeddedRoutes(options RouterOptions) {
+	r := &embeddedRouter{
+		routerContext{
+			services: options.Services,
+			logger:   options.Logger.Named("embeddedRoutes"),
+			cfg:      options.Config,
+		},
+	}
+
+	rateLimit := newRateLimitMiddleware(options, service.RateLimitGroupVendor, rateLimitByIP)
+	p := options.Handler.Group("/embedded", rateLimit, newSessionTokenMiddleware(options))
+	{
+		p.GET("/store", errorHandler(options, r.getStore))
+	}
+}
+
+// newSessionTokenMiddleware is used to verify vendor session token passed as a bearer token.
+// The store of the session is set as "store" and the staff user id as "vendorUserID".
+func newSessionTokenMiddleware(options RouterOptions) gin.HandlerFunc {
+	logger := options.Logger.Named("sessionTokenMiddleware")
+
+	return errorHandler(options, func(c *gin.Context) (interface{}, *httpErr) {
+		sessionToken, err := getAuthToken(c.GetHeader("Authorization"))
+		if err != nil {
+			logger.Info(err.Error())
+			return nil, &httpErr{Type: httpErrTypeClient, Status: http.StatusUnauthorized, Message: err.Error()}
+		}
+
+		session, err := options.Services.Vendor.VerifySessionToken(c, sessionToken)
+		if err != nil {
+			if errs.IsExpected(err) {
+				logger.Info(err.Error())
+				clientErr := newClientErr(c, err)
+				clientErr.Status = http.StatusUnauthorized
+				return nil, clientErr
+			}
+			logger.Error("failed to verify session token", "err", err)
+			return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to verify session token", Details: err}
+		}
+
+		c.Set("store", session.Store)
+		c.Set("vendorUserID", session.UserID)
+
+		logger.Info("successfully verified session token", "storeID", session.Store.ID, "vendorUserID", session.UserID)
+		return nil, nil
+	})
+}
+
+func (r *embeddedRouter) getStore(c *gin.Context) (interface{}, *httpErr) {
+	store := c.MustGet("store").(*entity.Store)
+	logger := r.logger.Named("getStore").WithContext(c).With("storeID", store.ID, "vendorUserID", c.GetString("vendorUserID"))
+
+	store, err := r.services.Store.GetStore(c, store.ID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to get store", Details: err}
+	}
+
+	logger.Info("successfully got store")
+	return store, nil
+}
@@ -0,0 +1,87 @@
+package httpcontroller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+)
+
+// rateLimitKey defines what a client is identified by.
+type rateLimitKey string
+
+const (
+	rateLimitByIP rateLimitKey = "ip"
+	// rateLimitByCustomer requires newAuthMiddleware to be called before.
+	rateLimitByCustomer rateLimitKey = "customer"
+)
+
+// newRateLimitMiddleware is used to limit requests of a route group per store by given client keys.
+// Request is rejected if any of the keys is out of tokens.
+func newRateLimitMiddleware(options RouterOptions, group string, keys ...rateLimitKey) gin.HandlerFunc {
+	logger := options.Logger.Named("rateLimitMiddleware").With("group", group)
+
+	return errorHandler(options, func(c *gin.Context) (interface{}, *httpErr) {
+		storeVendorID := getStoreVendorID(c.GetHeader("Origin"))
+		if storeVendorID == "" {
+			storeVendorID = c.Query("shop")
+		}
+
+		var state *ratelimit.Result
+		for _, key := range keys {
+			var value string
+			switch key {
+			case rateLimitByIP:
+				value = c.ClientIP()
+			case rateLimitByCustomer:
+				value = c.GetString("userID")
+			}
+
+			result, err := options.Services.RateLimit.TakeRateLimitToken(c, service.TakeRateLimitTokenOptions{
+				Group:         group,
+				StoreVendorID: storeVendorID,
+				Key:           string(key) + ":" + value,
+			})
+			if err != nil {
+				logger.Error("failed to take rate limit token", "err", err)
+				return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to check rate limit", Details: err}
+			}
+			if !result.Allowed {
+				setRateLimitHeaders(c, result)
+				c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				logger.Info("rate limit exceeded", "key", key)
+				return nil, &httpErr{
+					Type:    httpErrTypeClient,
+					Status:  http.StatusTooManyRequests,
+					Code:    "rate_limit_exceeded",
+					Message: "too many requests, try again later",
+					Details: service.NewRetryAfterDetails(result.RetryAfter),
+				}
+			}
+			if result.Limit != 0 && (state == nil || result.Remaining < state.Remaining) {
+				state = &result
+			}
+		}
+		if state != nil {
+			setRateLimitHeaders(c, *state)
+		}
+
+		return nil, nil
+	})
+}
+
+// setRateLimitHeaders sets RateLimit-* headers as described in IETF draft "RateLimit header fields for HTTP".
+func setRateLimitHeaders(c *gin.Context, result ratelimit.Result) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
 	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
 )
 
@@ -25,8 +26,11 @@ func newVendorRoutes(options RouterOptions) {
 
 	p := options.Handler.Group("/vendors")
 	{
-		p.GET("/install", errorHandler(options, r.installHandler))
-		p.GET("/redirect", errorHandler(options, r.redirectHandler))
+		rateLimit := newRateLimitMiddleware(options, service.RateLimitGroupVendor, rateLimitByIP)
+
+		p.GET("/install", rateLimit, errorHandler(options, r.installHandler))
+		p.GET("/redirect", rateLimit, errorHandler(options, r.redirectHandler))
+		p.POST("/token-exchange", rateLimit, errorHandler(options, r.tokenExchangeHandler))
 	}
 }
 
@@ -56,7 +60,15 @@ func (r *vendorRouter) redirectHandler(c *gin.Context) (interface{}, *httpErr) {
 	if err != nil {
 		if errs.IsExpected(err) {
 			logger.Info(fmt.Sprintf("didn't handle vendor redirect: %s", err.Error()))
-			return nil, &httpErr{Message: err.Error(), Code: errs.GetCode(err)}
+			clientErr := newClientErr(c, err)
+			switch errs.GetCode(err) {
+			case errs.GetCode(service.ErrHandleRedirectInvalidState),
+				errs.GetCode(service.ErrHandleRedirectInvalidHMAC),
+				errs.GetCode(service.ErrHandleRedirectTimestampExpired),
+				errs.GetCode(service.ErrHandleRedirectReauthorizationRequired):
+				clientErr.Status = http.StatusForbidden
+			}
+			return nil, clientErr
 		}
 		logger.Error("failed to handle vendor redirect", "err", err)
 		return nil, &httpErr{Message: "failed to handle vendor redirect", Details: err}
@@ -73,3 +85,37 @@ func (r *vendorRouter) redirectHandler(c *gin.Context) (interface{}, *httpErr) {
 		"message": "successfully installed the app",
 	}, nil
 }
+
+// tokenExchangeHandler installs the embedded app by its session token passed as a bearer token,
+// the embedded app calls it when vendor installed the app without redirects.
+func (r *vendorRouter) tokenExchangeHandler(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("tokenExchangeHandler").WithContext(c)
+
+	sessionToken, err := getAuthToken(c.GetHeader("Authorization"))
+	if err != nil {
+		logger.Info(err.Error())
+		return nil, &httpErr{Type: httpErrTypeClient, Status: http.StatusUnauthorized, Message: err.Error()}
+	}
+
+	err = r.services.Vendor.HandleTokenExchange(c, sessionToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(fmt.Sprintf("didn't handle token exchange: %s", err.Error()))
+			clientErr := newClientErr(c, err)
+			switch errs.GetCode(err) {
+			case errs.GetCode(service.ErrVerifySessionTokenInvalid):
+				clientErr.Status = http.StatusUnauthorized
+			case errs.GetCode(service.ErrHandleRedirectReauthorizationRequired):
+				clientErr.Status = http.StatusForbidden
+			}
+			return nil, clientErr
+		}
+		logger.Error("failed to handle token exchange", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to handle token exchange", Details: err}
+	}
+
+	logger.Info("successfully installed the app")
+	return map[string]string{
+		"message": "successfully installed the app",
+	}, nil
+}
@@ -0,0 +1,54 @@
+package httpcontroller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+// webhookRouter represents webhook service router.
+type webhookRouter struct {
+	routerContext
+}
+
+// newWebhookRoutes is used to setup vendor webhook routes.
+func newWebhookRoutes(options RouterOptions) {
+	r := &webhookRouter{
+		routerContext{
+			services: options.Services,
+			logger:   options.Logger.Named("webhookRoutes"),
+			cfg:      options.Config,
+		},
+	}
+
+	p := options.Handler.Group("/webhooks")
+	{
+		p.POST("/shopify", errorHandler(options, r.shopifyWebhookHandler))
+	}
+}
+
+func (r *webhookRouter) shopifyWebhookHandler(c *gin.Context) (interface{}, *httpErr) {
+	logger := r.logger.Named("shopifyWebhookHandler").WithContext(c)
+
+	err := r.services.Webhook.HandleWebhook(c)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			clientErr := newClientErr(c, err)
+			if errs.GetCode(err) == errs.GetCode(service.ErrHandleWebhookInvalidSignature) {
+				clientErr.Status = http.StatusUnauthorized
+			}
+			return nil, clientErr
+		}
+		logger.Error("failed to handle webhook", "err", err)
+		return nil, &httpErr{Type: httpErrTypeServer, Message: "failed to handle webhook", Details: err}
+	}
+
+	logger.Info("successfully handled webhook")
+	return map[string]string{
+		"message": "successfully handled webhook",
+	}, nil
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// Actions recorded in ComplianceLog.
+const (
+	ComplianceActionCustomerDeleted  = "customer_deleted"
+	ComplianceActionCustomerNotFound = "customer_not_found"
+	ComplianceActionDataExported     = "data_exported"
+	ComplianceActionStorePurged      = "store_purged"
+)
+
+// ComplianceLog model records an action taken on a vendor privacy request (e.g. GDPR webhook),
+// it's an audit record and doesn't hold customer data.
+type ComplianceLog struct {
+	ID            string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	StoreVendorID string `json:"storeVendorId" gorm:"index"`
+	// Topic is the vendor webhook topic, e.g. customers/redact.
+	Topic string `json:"topic"`
+	// RequestID is the vendor id of the request, e.g. Shopify webhook id.
+	RequestID        string `json:"requestId"`
+	VendorCustomerID string `json:"vendorCustomerId" gorm:"index"`
+	// Action is one of ComplianceAction* values.
+	Action string `json:"action"`
+	// CustomerDataExportID is the id of CustomerDataExport created for data requests.
+	CustomerDataExportID string `json:"customerDataExportId,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty" gorm:"index"`
+}
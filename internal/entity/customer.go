@@ -1,11 +1,77 @@
 package entity
 
+import "time"
+
 // Customer model represents a customer.
 type Customer struct {
-	ID               string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
-	VendorCustomerID string `json:"vendorCustomerId" gorm:"index"`
-	// NOTE: we are getting it from Vendor API and not storing it in our DB
-	FirstName string `json:"firstName" gorm:"-"`
+	ID string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	// StoreID and VendorCustomerID identify the customer, vendor ids are unique only within a store.
+	StoreID          string `json:"storeId" gorm:"type:uuid;uniqueIndex:idx_customer_store_vendor_customer"`
+	Store            *Store `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	VendorCustomerID string `json:"vendorCustomerId" gorm:"uniqueIndex:idx_customer_store_vendor_customer"`
+	// NOTE: we are getting profile from Vendor API and not storing it in our DB
+	FirstName        string              `json:"firstName" gorm:"-"`
+	LastName         string              `json:"lastName" gorm:"-"`
+	Email            string              `json:"email" gorm:"-"`
+	Phone            string              `json:"phone" gorm:"-"`
+	AcceptsMarketing bool                `json:"acceptsMarketing" gorm:"-"`
+	Tags             []string            `json:"tags" gorm:"-"`
+	State            string              `json:"state" gorm:"-"`
+	VerifiedEmail    bool                `json:"verifiedEmail" gorm:"-"`
+	DefaultAddress   *CustomerAddress    `json:"defaultAddress" gorm:"-"`
+	Note             string              `json:"note" gorm:"-"`
+	Metafields       []CustomerMetafield `json:"metafields" gorm:"-"`
 
 	RefreshToken string `json:"refreshToken"`
+	// RefreshTokenExpiresAt is when the customer session ends, it's empty for sessions started before it was stored.
+	RefreshTokenExpiresAt *time.Time `json:"-" gorm:"index"`
+	// VendorAccessToken is an encrypted token used to act as the customer on vendor API
+	// (e.g. Shopify Storefront customer access token).
+	VendorAccessToken          string     `json:"-"`
+	VendorAccessTokenExpiresAt *time.Time `json:"-" gorm:"index"`
+
+	// Identities contains external identities (e.g. Google, Apple) linked to the customer.
+	Identities []CustomerIdentity `json:"identities,omitempty" gorm:"foreignKey:CustomerID;constraint:OnDelete:CASCADE"`
+}
+
+// SetProfile copies vendor profile fields from given customer.
+func (c *Customer) SetProfile(profile *Customer) {
+	c.FirstName = profile.FirstName
+	c.LastName = profile.LastName
+	c.Email = profile.Email
+	c.Phone = profile.Phone
+	c.AcceptsMarketing = profile.AcceptsMarketing
+	c.Tags = profile.Tags
+	c.State = profile.State
+	c.VerifiedEmail = profile.VerifiedEmail
+	c.DefaultAddress = profile.DefaultAddress
+	c.Note = profile.Note
+	c.Metafields = profile.Metafields
+}
+
+// CustomerAddress represents a customer mailing address stored in vendor.
+type CustomerAddress struct {
+	ID           string `json:"id"`
+	FirstName    string `json:"firstName"`
+	LastName     string `json:"lastName"`
+	Company      string `json:"company"`
+	Address1     string `json:"address1"`
+	Address2     string `json:"address2"`
+	City         string `json:"city"`
+	Province     string `json:"province"`
+	ProvinceCode string `json:"provinceCode"`
+	Country      string `json:"country"`
+	CountryCode  string `json:"countryCode"`
+	Zip          string `json:"zip"`
+	Phone        string `json:"phone"`
+	// Default is true for the default address of the customer.
+	Default bool `json:"default"`
+}
+
+// CustomerMetafield represents a custom field attached to a customer in vendor.
+type CustomerMetafield struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
 }
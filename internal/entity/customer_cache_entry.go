@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// CustomerCacheEntry model represents a vendor customer profile cached in a shared backend.
+type CustomerCacheEntry struct {
+	Key string `json:"key" gorm:"primaryKey"`
+	// Profile is a JSON encoded Customer, it's empty for customers missing in vendor.
+	Profile   string    `json:"profile" gorm:"type:text"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+}
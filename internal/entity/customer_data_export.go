@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// CustomerDataExport model holds customer data exported for a vendor data request (e.g. customers/data_request
+// webhook) until admins retrieve it for the merchant. It's deleted once it expires or the customer or the store
+// is redacted.
+type CustomerDataExport struct {
+	ID               string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	StoreID          string `json:"storeId" gorm:"type:uuid;index"`
+	VendorCustomerID string `json:"vendorCustomerId" gorm:"index"`
+	// RequestID is the vendor id of the data request, e.g. Shopify webhook id.
+	RequestID string `json:"requestId"`
+	// Data is an encrypted JSON export.
+	Data string `json:"-" gorm:"type:text"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt" gorm:"index"`
+}
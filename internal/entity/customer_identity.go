@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// CustomerIdentity model represents an external identity linked to a customer.
+type CustomerIdentity struct {
+	ID         string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	CustomerID string `json:"customerId" gorm:"type:uuid;index"`
+	// ProviderID is the id of the OIDCProvider that issued the identity.
+	ProviderID string `json:"providerId" gorm:"type:uuid;uniqueIndex:idx_customer_identity_provider_subject"`
+	// Subject is the "sub" claim of the provider id_token.
+	Subject string `json:"subject" gorm:"uniqueIndex:idx_customer_identity_provider_subject"`
+	Email   string `json:"email"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+}
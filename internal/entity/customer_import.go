@@ -0,0 +1,44 @@
+package entity
+
+import "time"
+
+// Statuses of CustomerImport.
+const (
+	// CustomerImportStatusPending means the vendor export isn't started yet.
+	CustomerImportStatusPending = "pending"
+	// CustomerImportStatusExporting means the vendor is exporting customers.
+	CustomerImportStatusExporting = "exporting"
+	// CustomerImportStatusImporting means exported customers are being saved.
+	CustomerImportStatusImporting = "importing"
+	CustomerImportStatusCompleted = "completed"
+	CustomerImportStatusFailed    = "failed"
+)
+
+// CustomerImport model represents a job importing existing vendor customers of a store.
+type CustomerImport struct {
+	ID      string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	StoreID string `json:"storeId" gorm:"type:uuid;index"`
+	// Status is one of CustomerImportStatus* values.
+	Status string `json:"status" gorm:"index"`
+	// BulkOperationID is the vendor id of the export, e.g. Shopify bulk operation id.
+	BulkOperationID string `json:"bulkOperationId"`
+	// ResultURL is a temporary URL of exported customers.
+	ResultURL string `json:"-"`
+	// TotalCount is a number of exported customers, it's known once the export is finished.
+	TotalCount int `json:"totalCount"`
+	// ImportedCount is a number of exported customers already saved, import is resumed after them.
+	ImportedCount int    `json:"importedCount"`
+	Error         string `json:"error,omitempty"`
+	// LeaseOwner identifies the run holding the import until LeaseUntil, so only one replica runs it at once.
+	LeaseOwner string     `json:"-"`
+	LeaseUntil *time.Time `json:"-"`
+
+	CreatedAt   time.Time  `json:"createdAt,omitempty" gorm:"index"`
+	UpdatedAt   time.Time  `json:"updatedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// IsFinished checks whether the import is completed or failed.
+func (i *CustomerImport) IsFinished() bool {
+	return i.Status == CustomerImportStatusCompleted || i.Status == CustomerImportStatusFailed
+}
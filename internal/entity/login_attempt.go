@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// LoginAttempt model represents failed login attempts tracked by a key (e.g. store and email, client IP).
+type LoginAttempt struct {
+	Key          string     `json:"key" gorm:"primaryKey"`
+	Failures     int        `json:"failures"`
+	LastFailedAt time.Time  `json:"lastFailedAt"`
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
+}
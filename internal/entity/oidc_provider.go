@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCProvider model represents an upstream OpenID Connect provider (e.g. Google, Apple) configured for a store.
+type OIDCProvider struct {
+	ID      string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	StoreID string `json:"storeId" gorm:"type:uuid;uniqueIndex:idx_oidc_provider_store_name"`
+	// Name is used in the login URL, e.g. /customers/oidc/google/authorize.
+	Name string `json:"name" binding:"required" gorm:"uniqueIndex:idx_oidc_provider_store_name"`
+
+	Issuer           string `json:"issuer" binding:"required"`
+	ClientID         string `json:"clientId" binding:"required"`
+	ClientSecret     string `json:"clientSecret" binding:"required"`
+	AuthorizationURL string `json:"authorizationUrl" binding:"required"`
+	TokenURL         string `json:"tokenUrl" binding:"required"`
+	JWKSURL          string `json:"jwksUrl" binding:"required"`
+	// Scopes is a space separated list of requested scopes, "openid email profile" is used if empty.
+	Scopes string `json:"scopes"`
+
+	CreatedAt time.Time      `json:"createdAt,omitempty" gorm:"index"`
+	UpdatedAt time.Time      `json:"updatedAt,omitempty"`
+	DeletedAt gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+}
@@ -0,0 +1,38 @@
+package entity
+
+import "time"
+
+// Order represents a customer order stored in vendor.
+type Order struct {
+	ID string `json:"id"`
+	// Name is a human readable order number, e.g. #1001.
+	Name              string          `json:"name"`
+	CustomerID        string          `json:"-"`
+	ProcessedAt       time.Time       `json:"processedAt"`
+	FinancialStatus   string          `json:"financialStatus"`
+	FulfillmentStatus string          `json:"fulfillmentStatus"`
+	SubtotalPrice     Money           `json:"subtotalPrice"`
+	TotalShipping     Money           `json:"totalShipping"`
+	TotalTax          Money           `json:"totalTax"`
+	TotalPrice        Money           `json:"totalPrice"`
+	LineItems         []OrderLineItem `json:"lineItems"`
+}
+
+// OrderLineItem represents a product line of an order.
+type OrderLineItem struct {
+	ID                string `json:"id"`
+	Title             string `json:"title"`
+	VariantTitle      string `json:"variantTitle"`
+	SKU               string `json:"sku"`
+	Quantity          int    `json:"quantity"`
+	UnitPrice         Money  `json:"unitPrice"`
+	TotalPrice        Money  `json:"totalPrice"`
+	FulfillmentStatus string `json:"fulfillmentStatus"`
+	ImageURL          string `json:"imageUrl"`
+}
+
+// Money is a decimal amount in given currency.
+type Money struct {
+	Amount       string `json:"amount"`
+	CurrencyCode string `json:"currencyCode"`
+}
@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// RateLimitBucket model represents a token bucket state shared between application replicas.
+type RateLimitBucket struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"index"`
+	// FullAt is when the bucket is full again, it's equal to a new bucket then and can be deleted.
+	FullAt time.Time `json:"fullAt" gorm:"index"`
+}
@@ -1,23 +1,155 @@
 package entity
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Supported CAPTCHA providers.
+const (
+	CaptchaProviderHCaptcha  = "hcaptcha"
+	CaptchaProviderReCaptcha = "recaptcha"
+	CaptchaProviderTurnstile = "turnstile"
+)
+
+// Endpoints which can be protected by CAPTCHA.
+const (
+	CaptchaEndpointLogin = "login"
+)
+
 // Store model represents a store.
 type Store struct {
 	ID string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
 
-	VendorID              string `json:"vendorId" binding:"required"`
-	Scope                 string `json:"scope"`
-	ClientSecret          string `json:"clientSecret" binding:"required"`
-	ClientID              string `json:"clientId" binding:"required"`
+	VendorID string `json:"vendorId" binding:"required" gorm:"uniqueIndex"`
+	// Scope is a comma separated list of access scopes granted to the app by the last install.
+	Scope string `json:"scope"`
+	// Scopes overrides default access scopes requested from the store, e.g. "read_customers,write_customers".
+	Scopes string `json:"scopes"`
+	// MissingScopes are requested scopes which aren't granted, the app has to be reinstalled to the store if there are any.
+	MissingScopes []string `json:"missingScopes,omitempty" gorm:"-"`
+	// ClientSecret and ClientID are credentials of the custom app of the store,
+	// they are empty for stores of the public app which use the app credentials from config.
+	ClientSecret          string `json:"clientSecret"`
+	ClientID              string `json:"clientId"`
 	AccessToken           string `json:"accessToken"`
 	StoreFrontAccessToken string `json:"storeFrontAccessToken"`
+	// RateLimits overrides default rate limits of route groups, e.g. "login=5/1m,customer=120/1m".
+	RateLimits string `json:"rateLimits"`
 
-	CreatedAt time.Time      `json:"createdAt,omitempty" gorm:"index"`
-	UpdatedAt time.Time      `json:"updatedAt,omitempty"`
+	// CaptchaProvider is one of CaptchaProvider* values, CAPTCHA is disabled if it's empty.
+	CaptchaProvider  string `json:"captchaProvider"`
+	CaptchaSecretKey string `json:"captchaSecretKey"`
+	// CaptchaEndpoints is a comma separated list of CaptchaEndpoint* values protected by CAPTCHA.
+	CaptchaEndpoints string `json:"captchaEndpoints"`
+
+	// CustomerMetafields is a comma separated list of "namespace.key" customer metafields exposed to customers.
+	CustomerMetafields string `json:"customerMetafields"`
+	// CustomerTagClaims maps customer tags to access token roles and scopes, rules are comma separated,
+	// e.g. "wholesale=role:wholesale|scope:prices.wholesale,vip-*=role:vip", trailing * matches tag prefix.
+	CustomerTagClaims string `json:"customerTagClaims"`
+	// CustomerCacheTTL overrides default TTL of cached customer profiles, e.g. "10m", "0s" disables caching.
+	CustomerCacheTTL string `json:"customerCacheTtl"`
+
+	CreatedAt time.Time `json:"createdAt,omitempty" gorm:"index"`
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+	// DeletedAt is set for disabled stores, they are treated as missing by customer and vendor flows.
+	// The store is disabled while it's either disabled by admins or uninstalled.
 	DeletedAt gorm.DeletedAt `json:"deletedAt,omitempty" gorm:"index"`
+	// DisabledAt is set for stores disabled by admins, they stay disabled until admins enable them.
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	// UninstalledAt is set for stores disabled because the merchant uninstalled the app,
+	// they are enabled again by install unless they are disabled by admins too.
+	UninstalledAt *time.Time `json:"uninstalledAt,omitempty"`
+}
+
+// IsDisabled checks whether the store is disabled.
+func (s *Store) IsDisabled() bool {
+	return s.DeletedAt.Valid
+}
+
+// IsDisabledByAdmin checks whether the store is disabled by admins, the app can't be installed to it then.
+func (s *Store) IsDisabledByAdmin() bool {
+	return s.IsDisabled() && s.DisabledAt != nil
+}
+
+// IsUninstalled checks whether the store is disabled because the app was uninstalled.
+func (s *Store) IsUninstalled() bool {
+	return s.IsDisabled() && s.UninstalledAt != nil
+}
+
+// RequiredScopes returns access scopes requested from the store, defaultScopes are used if the store doesn't override them.
+func (s *Store) RequiredScopes(defaultScopes string) []string {
+	if s.Scopes != "" {
+		return splitScopes(s.Scopes)
+	}
+	return splitScopes(defaultScopes)
+}
+
+// GetMissingScopes returns required scopes which aren't granted, write scopes imply read ones,
+// e.g. granted write_customers covers read_customers.
+func (s *Store) GetMissingScopes(defaultScopes string) []string {
+	granted := map[string]bool{}
+	for _, scope := range splitScopes(s.Scope) {
+		granted[scope] = true
+		if strings.Contains(scope, "write_") {
+			granted[strings.Replace(scope, "write_", "read_", 1)] = true
+		}
+	}
+
+	var missing []string
+	for _, scope := range s.RequiredScopes(defaultScopes) {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// splitScopes parses comma separated scopes, empty items are skipped.
+func splitScopes(list string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(list, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// Masked returns a copy of the store with masked secrets, it's used to expose stores to admins.
+func (s *Store) Masked() *Store {
+	masked := *s
+	masked.ClientSecret = maskSecret(s.ClientSecret)
+	masked.AccessToken = maskSecret(s.AccessToken)
+	masked.StoreFrontAccessToken = maskSecret(s.StoreFrontAccessToken)
+	masked.CaptchaSecretKey = maskSecret(s.CaptchaSecretKey)
+	return &masked
+}
+
+// maskSecret keeps the last 4 characters of long secrets, so they can be told apart.
+func maskSecret(secret string) string {
+	switch {
+	case secret == "":
+		return ""
+	case len(secret) <= 12:
+		return "****"
+	default:
+		return "****" + secret[len(secret)-4:]
+	}
+}
+
+// IsCaptchaEnabled checks whether given endpoint is protected by CAPTCHA.
+func (s *Store) IsCaptchaEnabled(endpoint string) bool {
+	if s.CaptchaProvider == "" {
+		return false
+	}
+	for _, e := range strings.Split(s.CaptchaEndpoints, ",") {
+		if strings.TrimSpace(e) == endpoint {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,98 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestStoreGetMissingScopes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		store         Store
+		defaultScopes string
+		expected      []string
+	}{
+		{
+			name:          "positive: all default scopes granted",
+			store:         Store{Scope: "read_customers,write_orders"},
+			defaultScopes: "read_customers, write_orders",
+		},
+		{
+			name:          "positive: write scope implies read one",
+			store:         Store{Scope: "write_customers"},
+			defaultScopes: "read_customers,write_customers",
+		},
+		{
+			name:          "positive: store scopes override default ones",
+			store:         Store{Scope: "read_customers", Scopes: "read_customers"},
+			defaultScopes: "read_customers,read_orders",
+		},
+		{
+			name:          "negative: default scope isn't granted",
+			store:         Store{Scope: "read_customers"},
+			defaultScopes: "read_customers,read_orders",
+			expected:      []string{"read_orders"},
+		},
+		{
+			name:          "negative: read scope doesn't imply write one",
+			store:         Store{Scope: "read_customers"},
+			defaultScopes: "write_customers",
+			expected:      []string{"write_customers"},
+		},
+		{
+			name:          "negative: not installed store",
+			store:         Store{Scopes: "read_customers"},
+			defaultScopes: "read_orders",
+			expected:      []string{"read_customers"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.store.GetMissingScopes(tc.defaultScopes))
+		})
+	}
+}
+
+func TestStoreDisabledState(t *testing.T) {
+	now := time.Now()
+	disabled := gorm.DeletedAt{Time: now, Valid: true}
+
+	testCases := []struct {
+		name                    string
+		store                   Store
+		expectedDisabledByAdmin bool
+		expectedUninstalled     bool
+	}{
+		{
+			name:  "positive: enabled store",
+			store: Store{},
+		},
+		{
+			name:                    "positive: disabled by admins",
+			store:                   Store{DeletedAt: disabled, DisabledAt: &now},
+			expectedDisabledByAdmin: true,
+		},
+		{
+			name:                "positive: uninstalled",
+			store:               Store{DeletedAt: disabled, UninstalledAt: &now},
+			expectedUninstalled: true,
+		},
+		{
+			name:                    "positive: disabled by admins and uninstalled",
+			store:                   Store{DeletedAt: disabled, DisabledAt: &now, UninstalledAt: &now},
+			expectedDisabledByAdmin: true,
+			expectedUninstalled:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDisabledByAdmin, tc.store.IsDisabledByAdmin())
+			assert.Equal(t, tc.expectedUninstalled, tc.store.IsUninstalled())
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// Statuses of WebhookEvent.
+const (
+	// WebhookEventStatusPending means the webhook is waiting to be handled or retried.
+	WebhookEventStatusPending   = "pending"
+	WebhookEventStatusProcessed = "processed"
+	// WebhookEventStatusFailed means all attempts to handle the webhook failed.
+	WebhookEventStatusFailed = "failed"
+)
+
+// WebhookEvent model represents a received vendor webhook, it's handled in background and kept for a while
+// to skip redeliveries of the same webhook.
+type WebhookEvent struct {
+	ID string `json:"id" gorm:"type:uuid;primaryKey;default:uuid_generate_v4()"`
+	// VendorWebhookID is the vendor id of the webhook, e.g. X-Shopify-Webhook-Id, redeliveries have the same id.
+	VendorWebhookID string `json:"vendorWebhookId" gorm:"uniqueIndex"`
+	StoreVendorID   string `json:"storeVendorId" gorm:"index"`
+	Topic           string `json:"topic"`
+	// VendorCustomerID, CustomerEmail and CustomerState are parsed from the payload of customer topics.
+	VendorCustomerID string `json:"vendorCustomerId"`
+	CustomerEmail    string `json:"-"`
+	CustomerState    string `json:"customerState"`
+	// Status is one of WebhookEventStatus* values.
+	Status string `json:"status" gorm:"index"`
+	// Attempts counts claimed attempts, including the running one.
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when the pending webhook is handled next time, it's the end of the lease while it's handled.
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty" gorm:"index"`
+	Error         string     `json:"error,omitempty"`
+
+	CreatedAt   time.Time  `json:"createdAt,omitempty" gorm:"index"`
+	UpdatedAt   time.Time  `json:"updatedAt,omitempty"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
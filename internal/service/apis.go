@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
@@ -10,17 +11,284 @@ import (
 // APIs provides a collection of API interfaces.
 type APIs struct {
 	VendorAPI
+	OIDC    OIDCAPI
+	Captcha CaptchaVerifier
 }
 
 type VendorAPI interface {
 	// WithStore returns a new Vendor based on a store config.
 	WithStore(config *entity.Store) VendorAPI
-	// HandleInstall handles an oauth2 installation call.
-	HandleInstall(c *gin.Context, redirectURL string) (*entity.Store, string, error)
-	// HandleRedirect handles an oauth2 redirect call.
+	// HandleInstall handles an oauth2 installation call and returns vendor URL the merchant is redirected to.
+	HandleInstall(c *gin.Context, opts VendorInstallOptions) (*entity.Store, string, error)
+	// VerifyInstallRequest verifies an oauth2 installation call signature, it's required for stores the app isn't
+	// installed to yet, since they are created by the call.
+	VerifyInstallRequest(c *gin.Context) error
+	// HandleRedirect verifies an oauth2 redirect call signature and exchanges its code for store credentials.
 	HandleRedirect(c *gin.Context) (newConfig *entity.Store, err error)
-	// GetLoggedInCustomerID returns the id of the logged in customer.
-	GetLoggedInCustomerID(ctx context.Context, opt LoginCustomerOptions) (string, error)
+	// HandleTokenExchange exchanges a session token of the embedded app for store credentials, it's an alternative
+	// to HandleInstall and HandleRedirect for apps installed by vendor (managed installation).
+	HandleTokenExchange(ctx context.Context, sessionToken string) (newConfig *entity.Store, err error)
+	// ExchangeSessionToken exchanges a session token of the embedded app for an access token of the store,
+	// ErrVerifySessionTokenInvalid is returned if vendor rejects the session token.
+	ExchangeSessionToken(ctx context.Context, opts ExchangeVendorSessionTokenOptions) (*VendorAccessToken, error)
+	// GetLoggedInCustomerID returns the id and vendor access token of the logged in customer.
+	GetLoggedInCustomerID(ctx context.Context, opt LoginCustomerOptions) (*LoggedInVendorCustomer, error)
 	// GetCustomerByVendorID returns the customer by vendor id.
 	GetCustomerByVendorID(ctx context.Context, vendorCustomerID string) (*entity.Customer, error)
+	// GetCustomerIDByEmail returns the vendor id of the customer with given email or empty string if there is no such customer.
+	GetCustomerIDByEmail(ctx context.Context, email string) (string, error)
+	// CreateCustomer creates a new customer in vendor and returns its vendor id.
+	CreateCustomer(ctx context.Context, opts CreateVendorCustomerOptions) (string, error)
+	// UpdateCustomer updates customer on behalf of the customer, field errors are returned in ErrUpdateCustomerInvalidFields details.
+	UpdateCustomer(ctx context.Context, opts UpdateVendorCustomerOptions) (*UpdateVendorCustomerOutput, error)
+	// RenewCustomerAccessToken extends the lifetime of the customer access token.
+	RenewCustomerAccessToken(ctx context.Context, accessToken string) (*VendorCustomerAccessToken, error)
+	// DeleteCustomerAccessToken revokes the customer access token, already revoked token isn't an error.
+	DeleteCustomerAccessToken(ctx context.Context, accessToken string) error
+	// GetCustomerAddresses returns the address book of the customer, the default address is marked with Default.
+	GetCustomerAddresses(ctx context.Context, accessToken string) ([]entity.CustomerAddress, error)
+	// CreateCustomerAddress adds an address to the address book of the customer.
+	CreateCustomerAddress(ctx context.Context, opts CreateVendorCustomerAddressOptions) (*entity.CustomerAddress, error)
+	// UpdateCustomerAddress updates an address of the customer.
+	UpdateCustomerAddress(ctx context.Context, opts UpdateVendorCustomerAddressOptions) (*entity.CustomerAddress, error)
+	// DeleteCustomerAddress removes an address from the address book of the customer.
+	DeleteCustomerAddress(ctx context.Context, opts DeleteVendorCustomerAddressOptions) error
+	// SetDefaultCustomerAddress makes an address the default address of the customer.
+	SetDefaultCustomerAddress(ctx context.Context, opts SetDefaultVendorCustomerAddressOptions) error
+	// GetCustomerOrders returns a page of orders of the customer with given vendor id, newest first.
+	GetCustomerOrders(ctx context.Context, opts GetVendorCustomerOrdersOptions) (*OrdersPage, error)
+	// GetOrder returns the order by vendor id or nil if there is no such order.
+	GetOrder(ctx context.Context, orderID string) (*entity.Order, error)
+	// StartCustomersExport starts an asynchronous export of all store customers and returns its vendor id.
+	StartCustomersExport(ctx context.Context) (string, error)
+	// GetCustomersExport returns the state of the customers export or nil if there is no such export.
+	GetCustomersExport(ctx context.Context, id string) (*VendorCustomersExport, error)
+	// ReadExportedCustomers streams vendor ids of exported customers from the export result URL to fn,
+	// reading is stopped if fn fails.
+	ReadExportedCustomers(ctx context.Context, resultURL string, fn func(vendorCustomerID string) error) error
+	// ParseWebhook reads a webhook request, signature isn't verified since it depends on the store.
+	ParseWebhook(c *gin.Context) (*VendorWebhook, error)
+	// VerifyWebhook checks the webhook signature with the store credentials.
+	VerifyWebhook(webhook *VendorWebhook) bool
+	// ParseSessionToken reads the store and the user of an embedded app session token, signature isn't verified
+	// since it depends on the store.
+	ParseSessionToken(sessionToken string) (*VendorSessionToken, error)
+	// VerifySessionToken checks the session token signature with the store credentials and its claims.
+	VerifySessionToken(sessionToken string) (*VendorSessionToken, error)
+	// RegisterWebhook subscribes the store webhooks of the topic to the callback URL,
+	// already existing subscription isn't an error.
+	RegisterWebhook(ctx context.Context, opts RegisterVendorWebhookOptions) error
+}
+
+type VendorInstallOptions struct {
+	RedirectURL string
+	// State is passed back to the redirect as is.
+	State string
+	// Scopes are access scopes requested from the store.
+	Scopes []string
+}
+
+// Access modes of VendorAccessToken.
+const (
+	// VendorAccessModeOffline tokens act on behalf of the app and don't expire.
+	VendorAccessModeOffline = "offline"
+	// VendorAccessModeOnline tokens act on behalf of the staff user and expire with the user session.
+	VendorAccessModeOnline = "online"
+)
+
+type ExchangeVendorSessionTokenOptions struct {
+	SessionToken string
+	// AccessMode is one of VendorAccessMode* values.
+	AccessMode string
+}
+
+// VendorAccessToken is an access token of the store Admin API.
+type VendorAccessToken struct {
+	AccessToken string
+	// Scope is a comma separated list of granted access scopes.
+	Scope string
+	// ExpiresAt and UserID are set for online tokens.
+	ExpiresAt *time.Time
+	UserID    string
+}
+
+// Statuses of VendorCustomersExport.
+const (
+	VendorExportStatusRunning   = "running"
+	VendorExportStatusCompleted = "completed"
+	VendorExportStatusFailed    = "failed"
+)
+
+type VendorCustomersExport struct {
+	ID string
+	// Status is one of VendorExportStatus* values.
+	Status string
+	// Error is a vendor reason of the failed export.
+	Error       string
+	ObjectCount int
+	// ResultURL is empty if nothing was exported.
+	ResultURL string
+}
+
+type LoggedInVendorCustomer struct {
+	ID                   string
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+}
+
+type CreateVendorCustomerOptions struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+type UpdateVendorCustomerOptions struct {
+	AccessToken string
+	// nil fields are not updated
+	FirstName        *string
+	LastName         *string
+	Phone            *string
+	AcceptsMarketing *bool
+	Password         *string
+}
+
+type UpdateVendorCustomerOutput struct {
+	Customer *entity.Customer
+	// AccessToken is set when vendor rotated the customer access token (e.g. on password change).
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+}
+
+// VendorCustomerAccessToken is a vendor access token of the customer session.
+type VendorCustomerAccessToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+type CreateVendorCustomerAddressOptions struct {
+	AccessToken string
+	Address     entity.CustomerAddress
+}
+
+type UpdateVendorCustomerAddressOptions struct {
+	AccessToken string
+	AddressID   string
+	Address     entity.CustomerAddress
+}
+
+type DeleteVendorCustomerAddressOptions struct {
+	AccessToken string
+	AddressID   string
+}
+
+type SetDefaultVendorCustomerAddressOptions struct {
+	AccessToken string
+	AddressID   string
+}
+
+type GetVendorCustomerOrdersOptions struct {
+	VendorCustomerID string
+	First            int
+	After            string
+}
+
+// OrdersPage is a page of orders with a cursor of the next page.
+type OrdersPage struct {
+	Orders      []entity.Order
+	HasNextPage bool
+	EndCursor   string
+}
+
+// Vendor webhook topics.
+const (
+	WebhookTopicCustomersDataRequest = "customers/data_request"
+	WebhookTopicCustomersRedact      = "customers/redact"
+	WebhookTopicShopRedact           = "shop/redact"
+	WebhookTopicCustomersCreate      = "customers/create"
+	WebhookTopicCustomersUpdate      = "customers/update"
+	WebhookTopicCustomersDelete      = "customers/delete"
+	WebhookTopicAppUninstalled       = "app/uninstalled"
+)
+
+// VendorSessionToken is a session token of the merchant staff user issued by vendor admin to the embedded app.
+type VendorSessionToken struct {
+	StoreVendorID string
+	// UserID is the vendor id of the staff user.
+	UserID string
+}
+
+type RegisterVendorWebhookOptions struct {
+	// Topic is one of WebhookTopic* values.
+	Topic       string
+	CallbackURL string
+}
+
+// VendorCustomerStateDisabled is a state of the vendor customer whose account is disabled.
+const VendorCustomerStateDisabled = "DISABLED"
+
+// VendorWebhook is a webhook sent by vendor.
+type VendorWebhook struct {
+	ID string
+	// Topic is one of WebhookTopic* values, unknown topics are passed as is.
+	Topic         string
+	StoreVendorID string
+	Signature     string
+	Body          []byte
+
+	// VendorCustomerID and CustomerEmail are set for customer topics.
+	VendorCustomerID string
+	CustomerEmail    string
+	// CustomerState is set for customers/create and customers/update topics, e.g. VendorCustomerStateDisabled.
+	CustomerState string
+}
+
+// FieldError describes an invalid input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// OIDCAPI provides an OpenID Connect client for upstream identity providers.
+type OIDCAPI interface {
+	// GetAuthorizationURL returns the provider URL the customer should be redirected to.
+	GetAuthorizationURL(provider *entity.OIDCProvider, opts GetOIDCAuthorizationURLOptions) (string, error)
+	// ExchangeCode exchanges an authorization code for tokens and returns validated id_token claims.
+	ExchangeCode(ctx context.Context, provider *entity.OIDCProvider, opts ExchangeOIDCCodeOptions) (*OIDCIDTokenClaims, error)
+}
+
+type GetOIDCAuthorizationURLOptions struct {
+	RedirectURL string
+	State       string
+	Nonce       string
+}
+
+type ExchangeOIDCCodeOptions struct {
+	Code        string
+	RedirectURL string
+	// Nonce is compared with the nonce claim of the id_token.
+	Nonce string
+}
+
+// OIDCIDTokenClaims contains validated claims of an upstream id_token.
+type OIDCIDTokenClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// CaptchaVerifier verifies CAPTCHA challenge responses.
+type CaptchaVerifier interface {
+	// VerifyCaptcha returns true if the challenge response token is valid.
+	VerifyCaptcha(ctx context.Context, opts VerifyCaptchaOptions) (bool, error)
+}
+
+type VerifyCaptchaOptions struct {
+	// Provider is one of entity.CaptchaProvider* values.
+	Provider string
+	Secret   string
+	Token    string
+	RemoteIP string
 }
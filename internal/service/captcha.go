@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+type verifyCaptchaOptions struct {
+	Store    *entity.Store
+	Endpoint string
+	Token    string
+	RemoteIP string
+}
+
+// verifyCaptcha checks CAPTCHA response if the store protects given endpoint with CAPTCHA.
+func (s *serviceContext) verifyCaptcha(ctx context.Context, opts verifyCaptchaOptions) error {
+	logger := s.logger.
+		Named("verifyCaptcha").
+		WithContext(ctx).
+		With("endpoint", opts.Endpoint, "provider", opts.Store.CaptchaProvider)
+
+	if !opts.Store.IsCaptchaEnabled(opts.Endpoint) {
+		return nil
+	}
+	if opts.Token == "" {
+		logger.Info("captcha token is missing")
+		return ErrCaptchaRequired
+	}
+
+	ok, err := s.apis.Captcha.VerifyCaptcha(ctx, VerifyCaptchaOptions{
+		Provider: opts.Store.CaptchaProvider,
+		Secret:   opts.Store.CaptchaSecretKey,
+		Token:    opts.Token,
+		RemoteIP: opts.RemoteIP,
+	})
+	if err != nil {
+		logger.Error("failed to verify captcha", "err", err)
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	if !ok {
+		logger.Info("invalid captcha")
+		return ErrCaptchaInvalid
+	}
+
+	logger.Debug("captcha verified")
+	return nil
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/secret"
+)
+
+// customerDataExport contains everything we hold about a customer, secrets are replaced by flags.
+type customerDataExport struct {
+	Customer      *customerExport           `json:"customer"`
+	Identities    []entity.CustomerIdentity `json:"identities"`
+	LoginAttempts []entity.LoginAttempt     `json:"loginAttempts"`
+}
+
+type customerExport struct {
+	ID                         string     `json:"id"`
+	VendorCustomerID           string     `json:"vendorCustomerId"`
+	HasSession                 bool       `json:"hasSession"`
+	VendorAccessTokenExpiresAt *time.Time `json:"vendorAccessTokenExpiresAt,omitempty"`
+}
+
+// exportCustomerData saves an encrypted JSON export of the customer data for a data request, admins retrieve it
+// for the merchant by StoreService.GetCustomerDataExport. Only a reference to it is recorded in compliance log.
+func (s *webhookService) exportCustomerData(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("exportCustomerData").
+		WithContext(ctx).
+		With("vendorCustomerID", webhook.VendorCustomerID)
+
+	export := customerDataExport{
+		Identities:    []entity.CustomerIdentity{},
+		LoginAttempts: []entity.LoginAttempt{},
+	}
+
+	customer, err := s.getWebhookCustomer(store, webhook)
+	if err != nil {
+		logger.Error("failed to get customer", "err", err)
+		return fmt.Errorf("failed to get customer: %w", err)
+	}
+	if customer != nil {
+		export.Customer = &customerExport{
+			ID:                         customer.ID,
+			VendorCustomerID:           customer.VendorCustomerID,
+			HasSession:                 customer.RefreshToken != "",
+			VendorAccessTokenExpiresAt: customer.VendorAccessTokenExpiresAt,
+		}
+
+		identities, err := s.storages.CustomerIdentity.ListCustomerIdentities(customer.ID)
+		if err != nil {
+			logger.Error("failed to list customer identities", "err", err)
+			return fmt.Errorf("failed to list customer identities: %w", err)
+		}
+		export.Identities = append(export.Identities, identities...)
+	}
+
+	if webhook.CustomerEmail != "" {
+		attempts, err := s.storages.LoginAttempt.GetLoginAttempts([]string{loginAttemptEmailKey(store.ID, webhook.CustomerEmail)})
+		if err != nil {
+			logger.Error("failed to get login attempts", "err", err)
+			return fmt.Errorf("failed to get login attempts: %w", err)
+		}
+		export.LoginAttempts = append(export.LoginAttempts, attempts...)
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		logger.Error("failed to encode customer data", "err", err)
+		return fmt.Errorf("failed to encode customer data: %w", err)
+	}
+
+	encrypted, err := secret.Encrypt(s.cfg.Auth.EncryptionKey, string(data))
+	if err != nil {
+		logger.Error("failed to encrypt customer data", "err", err)
+		return fmt.Errorf("failed to encrypt customer data: %w", err)
+	}
+
+	dataExport, err := s.storages.CustomerDataExport.CreateCustomerDataExport(&entity.CustomerDataExport{
+		StoreID:          store.ID,
+		VendorCustomerID: webhook.VendorCustomerID,
+		RequestID:        webhook.ID,
+		Data:             encrypted,
+		ExpiresAt:        time.Now().Add(s.cfg.Webhook.DataExportRetention),
+	})
+	if err != nil {
+		logger.Error("failed to create customer data export", "err", err)
+		return fmt.Errorf("failed to create customer data export: %w", err)
+	}
+
+	err = s.recordCompliance(ctx, webhook, entity.ComplianceActionDataExported, dataExport.ID)
+	if err != nil {
+		logger.Error("failed to record compliance action", "err", err)
+		return fmt.Errorf("failed to record compliance action: %w", err)
+	}
+
+	logger.Info("successfully exported customer data")
+	return nil
+}
+
+// redactCustomer deletes the customer with its sessions, identities and data exports.
+func (s *webhookService) redactCustomer(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("redactCustomer").
+		WithContext(ctx).
+		With("vendorCustomerID", webhook.VendorCustomerID)
+
+	customer, err := s.getWebhookCustomer(store, webhook)
+	if err != nil {
+		logger.Error("failed to get customer", "err", err)
+		return fmt.Errorf("failed to get customer: %w", err)
+	}
+
+	action := entity.ComplianceActionCustomerNotFound
+	if customer != nil {
+		// sessions are stored on the customer, so they are deleted along with it
+		if err := s.storages.Customer.DeleteCustomer(customer.ID); err != nil {
+			logger.Error("failed to delete customer", "err", err)
+			return fmt.Errorf("failed to delete customer: %w", err)
+		}
+		action = entity.ComplianceActionCustomerDeleted
+	}
+
+	if err := s.evictCachedCustomer(ctx, store.VendorID, webhook.VendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+	if webhook.VendorCustomerID != "" {
+		_, err := s.storages.CustomerDataExport.DeleteCustomerDataExports(DeleteCustomerDataExportsFilter{
+			StoreID:          &store.ID,
+			VendorCustomerID: &webhook.VendorCustomerID,
+		})
+		if err != nil {
+			logger.Error("failed to delete customer data exports", "err", err)
+			return fmt.Errorf("failed to delete customer data exports: %w", err)
+		}
+	}
+	if webhook.CustomerEmail != "" {
+		if err := s.storages.LoginAttempt.DeleteLoginAttempt(loginAttemptEmailKey(store.ID, webhook.CustomerEmail)); err != nil {
+			logger.Error("failed to delete login attempts", "err", err)
+			return fmt.Errorf("failed to delete login attempts: %w", err)
+		}
+	}
+
+	if err := s.recordCompliance(ctx, webhook, action, ""); err != nil {
+		logger.Error("failed to record compliance action", "err", err)
+		return fmt.Errorf("failed to record compliance action: %w", err)
+	}
+
+	logger.Info("successfully redacted customer", "action", action)
+	return nil
+}
+
+// redactStore purges all data of the store.
+func (s *webhookService) redactStore(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("redactStore").
+		WithContext(ctx).
+		With("storeID", store.ID)
+
+	if err := s.storages.Store.PurgeStore(store); err != nil {
+		logger.Error("failed to purge store", "err", err)
+		return fmt.Errorf("failed to purge store: %w", err)
+	}
+
+	if err := s.recordCompliance(ctx, webhook, entity.ComplianceActionStorePurged, ""); err != nil {
+		logger.Error("failed to record compliance action", "err", err)
+		return fmt.Errorf("failed to record compliance action: %w", err)
+	}
+
+	logger.Info("successfully purged store")
+	return nil
+}
+
+// getWebhookCustomer returns customer of the webhook store or nil if we don't hold it.
+func (s *webhookService) getWebhookCustomer(store *entity.Store, webhook *VendorWebhook) (*entity.Customer, error) {
+	if webhook.VendorCustomerID == "" {
+		return nil, nil
+	}
+	return s.storages.Customer.GetCustomer(GetCustomerFilter{
+		StoreID:          &store.ID,
+		VendorCustomerID: &webhook.VendorCustomerID,
+	})
+}
+
+// recordCompliance saves an audit record of the action taken on a vendor privacy request, dataExportID is set
+// for data requests.
+func (s *webhookService) recordCompliance(ctx context.Context, webhook *VendorWebhook, action, dataExportID string) error {
+	_, err := s.storages.ComplianceLog.CreateComplianceLog(&entity.ComplianceLog{
+		StoreVendorID:        webhook.StoreVendorID,
+		Topic:                webhook.Topic,
+		RequestID:            webhook.ID,
+		VendorCustomerID:     webhook.VendorCustomerID,
+		Action:               action,
+		CustomerDataExportID: dataExportID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create compliance log: %w", err)
+	}
+
+	s.logger.Named("recordCompliance").WithContext(ctx).Info("compliance action recorded", "topic", webhook.Topic, "action", action)
+	return nil
+}
@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/internal/storage"
+)
+
+// memoryCustomerDataExportStorage keeps customer data exports in memory.
+type memoryCustomerDataExportStorage struct {
+	mu      sync.Mutex
+	exports []entity.CustomerDataExport
+}
+
+func (f *memoryCustomerDataExportStorage) CreateCustomerDataExport(export *entity.CustomerDataExport) (*entity.CustomerDataExport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	export.ID = "export"
+	f.exports = append(f.exports, *export)
+	return export, nil
+}
+
+func (f *memoryCustomerDataExportStorage) GetCustomerDataExport(storeID, id string) (*entity.CustomerDataExport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, export := range f.exports {
+		if export.StoreID == storeID && export.ID == id {
+			return &export, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *memoryCustomerDataExportStorage) ListCustomerDataExports(storeID string) ([]entity.CustomerDataExport, error) {
+	return nil, nil
+}
+
+func (f *memoryCustomerDataExportStorage) DeleteCustomerDataExports(filter service.DeleteCustomerDataExportsFilter) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kept []entity.CustomerDataExport
+	for _, export := range f.exports {
+		matched := (filter.StoreID == nil || export.StoreID == *filter.StoreID) &&
+			(filter.VendorCustomerID == nil || export.VendorCustomerID == *filter.VendorCustomerID) &&
+			(filter.ExpiredBefore == nil || export.ExpiresAt.Before(*filter.ExpiredBefore))
+		if !matched {
+			kept = append(kept, export)
+		}
+	}
+	deleted := int64(len(f.exports) - len(kept))
+	f.exports = kept
+	return deleted, nil
+}
+
+type memoryComplianceLogStorage struct {
+	logs []entity.ComplianceLog
+}
+
+func (f *memoryComplianceLogStorage) CreateComplianceLog(log *entity.ComplianceLog) (*entity.ComplianceLog, error) {
+	f.logs = append(f.logs, *log)
+	return log, nil
+}
+
+// complianceCustomerStorage holds a single customer until it's deleted.
+type complianceCustomerStorage struct {
+	service.CustomerStorage
+	customer *entity.Customer
+}
+
+func (f *complianceCustomerStorage) GetCustomer(service.GetCustomerFilter) (*entity.Customer, error) {
+	return f.customer, nil
+}
+
+func (f *complianceCustomerStorage) DeleteCustomer(string) error {
+	f.customer = nil
+	return nil
+}
+
+type complianceIdentityStorage struct {
+	service.CustomerIdentityStorage
+}
+
+func (f *complianceIdentityStorage) ListCustomerIdentities(customerID string) ([]entity.CustomerIdentity, error) {
+	return []entity.CustomerIdentity{{CustomerID: customerID, Email: "customer@example.com"}}, nil
+}
+
+func TestCustomerDataRequest(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.EncryptionKey = "encryption-key"
+	cfg.Webhook.MaxAttempts = 5
+	cfg.Webhook.Lease = time.Minute
+	cfg.Webhook.DataExportRetention = time.Hour
+
+	dueAt := time.Now().Add(-time.Second)
+	events := &memoryWebhookEventStorage{events: map[string]*entity.WebhookEvent{}}
+	exports := &memoryCustomerDataExportStorage{}
+	logs := &memoryComplianceLogStorage{}
+	stores := &slowUninstallStoreStorage{store: &entity.Store{ID: "store", VendorID: "test.myshopify.com"}}
+	options := service.Options{
+		Storages: service.Storages{
+			WebhookEvent:       events,
+			Store:              stores,
+			Customer:           &complianceCustomerStorage{customer: &entity.Customer{ID: "customer", VendorCustomerID: "1001"}},
+			CustomerIdentity:   &complianceIdentityStorage{},
+			LoginAttempt:       &memoryLoginAttemptStorage{},
+			ComplianceLog:      logs,
+			CustomerCache:      storage.NewMemoryCustomerCacheStorage(10),
+			CustomerDataExport: exports,
+		},
+		Config: cfg,
+		Logger: logging.NewZapLogger("error"),
+	}
+	webhookService := service.NewWebhookService(options)
+	storeService := service.NewStoreService(options)
+
+	// processWebhook handles a single due webhook of given topic
+	processWebhook := func(topic string) {
+		events.events[topic] = &entity.WebhookEvent{
+			ID:               topic,
+			StoreVendorID:    "test.myshopify.com",
+			Topic:            topic,
+			VendorCustomerID: "1001",
+			Status:           entity.WebhookEventStatusPending,
+			NextAttemptAt:    &dueAt,
+		}
+		require.NoError(t, webhookService.ProcessWebhooks(context.Background()))
+		require.Equal(t, entity.WebhookEventStatusProcessed, events.events[topic].Status)
+	}
+
+	processWebhook(service.WebhookTopicCustomersDataRequest)
+	require.Len(t, exports.exports, 1)
+	assert.NotContains(t, exports.exports[0].Data, "customer@example.com")
+	require.Len(t, logs.logs, 1)
+	assert.Equal(t, "export", logs.logs[0].CustomerDataExportID)
+
+	export, err := storeService.GetCustomerDataExport(context.Background(), service.GetCustomerDataExportOptions{
+		StoreID: "store",
+		ID:      "export",
+	})
+	require.NoError(t, err)
+	var data struct {
+		Identities []entity.CustomerIdentity `json:"identities"`
+	}
+	require.NoError(t, json.Unmarshal(export.Data, &data))
+	require.Len(t, data.Identities, 1)
+	assert.Equal(t, "customer@example.com", data.Identities[0].Email)
+
+	processWebhook(service.WebhookTopicCustomersRedact)
+	assert.Empty(t, exports.exports)
+	_, err = storeService.GetCustomerDataExport(context.Background(), service.GetCustomerDataExportOptions{
+		StoreID: "store",
+		ID:      "export",
+	})
+	assert.Equal(t, service.ErrCustomerDataExportNotFound, err)
+}
@@ -22,10 +22,11 @@ type customerService struct {
 func NewCustomerService(options Options) *customerService {
 	return &customerService{
 		serviceContext: serviceContext{
-			storages: options.Storages,
-			cfg:      options.Config,
-			logger:   options.Logger.Named("customerService"),
-			apis:     options.APIs,
+			storages:   options.Storages,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("customerService"),
+			apis:       options.APIs,
+			background: options.Background,
 		},
 	}
 }
@@ -46,11 +47,54 @@ func (s *customerService) LoginCustomer(ctx context.Context, opts LoginCustomerO
 		return "", ErrLoginCustomerStoreNotFound
 	}
 
-	vendorCustomerID, err := s.apis.VendorAPI.WithStore(store).GetLoggedInCustomerID(ctx, LoginCustomerOptions{
+	err = s.verifyCaptcha(ctx, verifyCaptchaOptions{
+		Store:    store,
+		Endpoint: entity.CaptchaEndpointLogin,
+		Token:    opts.CaptchaToken,
+		RemoteIP: opts.ClientIP,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to verify captcha", "err", err)
+		return "", fmt.Errorf("failed to verify captcha: %w", err)
+	}
+
+	emailAttemptKey := loginAttemptEmailKey(store.ID, opts.Email)
+	ipAttemptKey := loginAttemptIPKey(opts.ClientIP)
+	err = s.checkLoginAttempts(ctx, emailAttemptKey, ipAttemptKey, loginAttemptStoreKey(store.ID))
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to check login attempts", "err", err)
+		return "", fmt.Errorf("failed to check login attempts: %w", err)
+	}
+
+	vendorCustomer, err := s.apis.VendorAPI.WithStore(store).GetLoggedInCustomerID(ctx, LoginCustomerOptions{
 		Email:    opts.Email,
 		Password: opts.Password,
 	})
 	if err != nil {
+		switch errs.GetCode(err) {
+		case customerInvalidEmailOrPasswordErrCode:
+			if err := s.registerFailedLoginAttempt(ctx, emailAttemptKey, s.cfg.LoginProtection.MaxFailedAttemptsPerEmail, true); err != nil {
+				logger.Error("failed to register failed login attempt by email", "err", err)
+				return "", fmt.Errorf("failed to register failed login attempt by email: %w", err)
+			}
+			if err := s.registerFailedLoginAttempt(ctx, ipAttemptKey, s.cfg.LoginProtection.MaxFailedAttemptsPerIP, false); err != nil {
+				logger.Error("failed to register failed login attempt by ip", "err", err)
+				return "", fmt.Errorf("failed to register failed login attempt by ip: %w", err)
+			}
+		case vendorThrottledErrCode:
+			if err := s.lockThrottledStoreLogins(store, err); err != nil {
+				logger.Error("failed to lock store logins", "err", err)
+				return "", fmt.Errorf("failed to lock store logins: %w", err)
+			}
+		}
 		if errs.IsExpected(err) {
 			logger.Info(err.Error())
 			return "", err
@@ -60,58 +104,131 @@ func (s *customerService) LoginCustomer(ctx context.Context, opts LoginCustomerO
 		return "", fmt.Errorf("failed to login customer: %w", err)
 	}
 
-	customer, err := s.storages.Customer.GetCustomer(GetCustomerFilter{
-		VendorCustomerID: &vendorCustomerID,
-	})
+	if vendorCustomer.ID == "" {
+		logger.Error("vendor customer id is empty")
+		return "", fmt.Errorf("vendor customer id is empty")
+	}
+
+	if err := s.storages.LoginAttempt.DeleteLoginAttempt(emailAttemptKey); err != nil {
+		logger.Error("failed to reset login attempts", "err", err)
+		return "", fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	sessionData, err := s.vendorSessionData(vendorCustomer.AccessToken, vendorCustomer.AccessTokenExpiresAt)
 	if err != nil {
-		logger.Error("failed to get customer through storage", "err", err)
-		return "", fmt.Errorf("failed to get customer through storage: %w", err)
+		logger.Error("failed to get vendor session data", "err", err)
+		return "", fmt.Errorf("failed to get vendor session data: %w", err)
 	}
-	if customer == nil {
-		customer, err = s.storages.Customer.CreateCustomer(&entity.Customer{
-			VendorCustomerID: vendorCustomerID,
-		})
+
+	// claims are resolved in vendor before the customer row is locked
+	claims, err := s.resolveCustomerClaims(ctx, store, vendorCustomer.ID)
+	if err != nil {
+		logger.Error("failed to resolve customer claims", "err", err)
+		return "", fmt.Errorf("failed to resolve customer claims: %w", err)
+	}
+
+	// the customer row stays locked from the upsert until the session is saved,
+	// so concurrent first logins share one customer and don't interleave session writes
+	var accessToken string
+	err = s.storages.Customer.Transaction(func(tx CustomerStorage) error {
+		txService := s.withCustomerStorage(tx)
+
+		customer, err := txService.getOrCreateCustomer(ctx, store, vendorCustomer.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get or create customer: %w", err)
+		}
+
+		accessToken, err = txService.startCustomerSession(ctx, customer, claims, sessionData)
 		if err != nil {
-			logger.Error("failed to create customer in storage", "err", err)
-			return "", fmt.Errorf("failed to create customer in storage: %w", err)
+			return fmt.Errorf("failed to start customer session: %w", err)
 		}
-		logger.Debug("created customer", "createdCustomer", customer)
-	} else {
-		logger.Debug("got customer", "customer", customer)
+
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to start customer session", "err", err)
+		return "", fmt.Errorf("failed to start customer session: %w", err)
 	}
 
-	// Generate a pair of tokens
-	tokens, err := s.GenerateCustomerTokens(ctx, customer.ID)
+	logger.Info("customer logged in")
+	return accessToken, nil
+}
+
+// getOrCreateCustomer returns customer of the store by given vendor id and creates it if it doesn't exist yet.
+func (s *customerService) getOrCreateCustomer(ctx context.Context, store *entity.Store, vendorCustomerID string) (*entity.Customer, error) {
+	logger := s.logger.
+		Named("getOrCreateCustomer").
+		WithContext(ctx).
+		With("storeID", store.ID, "vendorCustomerID", vendorCustomerID)
+
+	customer, err := s.storages.Customer.UpsertCustomer(&entity.Customer{
+		StoreID:          store.ID,
+		VendorCustomerID: vendorCustomerID,
+	})
+	if err != nil {
+		logger.Error("failed to upsert customer in storage", "err", err)
+		return nil, fmt.Errorf("failed to upsert customer in storage: %w", err)
+	}
+
+	logger.Debug("got customer", "customer", customer)
+	return customer, nil
+}
+
+// withCustomerStorage returns a copy of the service using given customer storage (e.g. bound to a transaction).
+func (s *customerService) withCustomerStorage(customerStorage CustomerStorage) *customerService {
+	c := *s
+	c.storages.Customer = customerStorage
+	return &c
+}
+
+// startCustomerSession generates a pair of tokens with given claims, saves refresh token along with non-empty fields
+// of sessionData (e.g. vendor access token) and returns access token. It doesn't call vendor, so it can be run
+// in a transaction.
+func (s *customerService) startCustomerSession(ctx context.Context, customer *entity.Customer, claims customerClaims, sessionData *entity.Customer) (string, error) {
+	logger := s.logger.
+		Named("startCustomerSession").
+		WithContext(ctx).
+		With("customerID", customer.ID)
+
+	tokens, err := s.GenerateCustomerTokens(ctx, GenerateCustomerTokensOptions{
+		CustomerID: customer.ID,
+		Roles:      claims.Roles,
+		Scopes:     claims.Scopes,
+	})
 	if err != nil {
 		logger.Error("failed to generate tokens", "err", err)
 		return "", fmt.Errorf("failed to generate tokens: %w", err)
 	}
 
-	customer, err = s.storages.Customer.UpdateCustomer(customer.ID, &entity.Customer{
-		RefreshToken: tokens.RefreshToken,
-	})
+	if sessionData == nil {
+		sessionData = &entity.Customer{}
+	}
+	sessionData.RefreshToken = tokens.RefreshToken
+	sessionData.RefreshTokenExpiresAt = &tokens.RefreshTokenExpiresAt
+
+	customer, err = s.storages.Customer.UpdateCustomer(customer.ID, sessionData)
 	if err != nil {
 		logger.Error("failed to update customer", "err", err)
 		return "", fmt.Errorf("failed to update customer: %w", err)
 	}
 	logger.Debug("updated customer", "customer", customer)
 
-	logger.Info("customer logged in", "tokens", tokens)
+	logger.Info("customer session started", "tokens", tokens)
 	return tokens.AccessToken, nil
 }
 
-func (s *customerService) RefreshCustomerAccessToken(ctx context.Context, accessToken string) (string, error) {
+func (s *customerService) RefreshCustomerAccessToken(ctx context.Context, opts RefreshCustomerAccessTokenOptions) (string, error) {
 	logger := s.logger.
 		Named("RefreshCustomerAccessToken").
 		WithContext(ctx).
-		With("token", accessToken)
+		With("opts", opts)
 
 	accessTokenClaims, err := token.VerifyJWTToken(token.VerifyJWTTokenOptions{
-		Token:                accessToken,
+		Token:                opts.Token,
 		Secret:               s.cfg.Auth.TokenSecretKey,
 		NotToCheckExpiration: true,
 	})
-	if err != nil {
+	if err != nil || accessTokenClaims.Iss != s.cfg.Auth.TokenIssuer {
 		logger.Info("invalid token", "err", err)
 		return "", ErrRefreshCustomerTokenInvalidToken
 	}
@@ -144,8 +261,29 @@ func (s *customerService) RefreshCustomerAccessToken(ctx context.Context, access
 		return "", ErrRefreshCustomerTokenTokenExpired
 	}
 
+	store, err := s.storages.Store.GetStore(&opts.StoreVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return "", fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return "", ErrRefreshCustomerTokenStoreNotFound
+	}
+	if customer.StoreID != store.ID {
+		logger.Info("customer belongs to another store")
+		return "", ErrRefreshCustomerTokenCustomerNotFound
+	}
+
+	// roles and scopes are resolved again, so tag changes are applied on every refresh
+	claims, err := s.resolveCustomerClaims(ctx, store, customer.VendorCustomerID)
+	if err != nil {
+		logger.Error("failed to resolve customer claims", "err", err)
+		return "", fmt.Errorf("failed to resolve customer claims: %w", err)
+	}
+
 	t := time.Now()
-	accessToken, err = token.SignJWTToken(
+	accessToken, err := token.SignJWTToken(
 		&token.UniversalClaims{
 			Iss:   s.cfg.Auth.TokenIssuer,
 			ExpAt: t.Add(s.cfg.Auth.AccessTokenLifetime),
@@ -153,6 +291,8 @@ func (s *customerService) RefreshCustomerAccessToken(ctx context.Context, access
 			IssAt: t,
 			Payload: token.UserDataClaims{
 				UserID: customer.ID,
+				Roles:  claims.Roles,
+				Scopes: claims.Scopes,
 			},
 		},
 		s.cfg.Auth.TokenSecretKey,
@@ -177,7 +317,7 @@ func (s *customerService) VerifyCustomerAccessToken(ctx context.Context, accessT
 		Token:  accessTokenStr,
 		Secret: s.cfg.Auth.TokenSecretKey,
 	})
-	if err != nil {
+	if err != nil || accessTokenClaims.Iss != s.cfg.Auth.TokenIssuer {
 		logger.Info("invalid token", "err", err)
 		return nil, ErrVerifyCustomerTokenInvalidToken
 	}
@@ -199,16 +339,20 @@ func (s *customerService) VerifyCustomerAccessToken(ctx context.Context, accessT
 		logger.Info("customer not found")
 		return nil, ErrVerifyCustomerTokenCustomerNotFound
 	}
+	if customer.RefreshToken == "" {
+		logger.Info("customer is logged out")
+		return nil, ErrVerifyCustomerTokenInvalidToken
+	}
 
 	logger.Info("verified token", "customer", customer)
 	return customer, nil
 }
 
-func (ts *customerService) GenerateCustomerTokens(ctx context.Context, customerID string) (GenerateCustomerTokensOutput, error) {
+func (ts *customerService) GenerateCustomerTokens(ctx context.Context, opts GenerateCustomerTokensOptions) (GenerateCustomerTokensOutput, error) {
 	logger := ts.logger.
 		Named("GenerateCustomerToken").
 		WithContext(ctx).
-		With("customerID", customerID)
+		With("opts", opts)
 
 	// Create new Access token
 	t := time.Now()
@@ -219,7 +363,9 @@ func (ts *customerService) GenerateCustomerTokens(ctx context.Context, customerI
 			NbfAt: t,
 			IssAt: t,
 			Payload: token.UserDataClaims{
-				UserID: customerID,
+				UserID: opts.CustomerID,
+				Roles:  opts.Roles,
+				Scopes: opts.Scopes,
 			},
 		},
 		ts.cfg.Auth.TokenSecretKey,
@@ -232,14 +378,15 @@ func (ts *customerService) GenerateCustomerTokens(ctx context.Context, customerI
 
 	// Create new Refresh token
 	t = time.Now()
+	refreshTokenExpiresAt := t.Add(ts.cfg.Auth.RefreshTokenLifetime)
 	refreshToken, err := token.SignJWTToken(
 		&token.UniversalClaims{
 			Iss:   ts.cfg.Auth.TokenIssuer,
-			ExpAt: t.Add(ts.cfg.Auth.RefreshTokenLifetime),
+			ExpAt: refreshTokenExpiresAt,
 			NbfAt: t,
 			IssAt: t,
 			Payload: token.UserDataClaims{
-				UserID: customerID,
+				UserID: opts.CustomerID,
 			},
 		},
 		ts.cfg.Auth.TokenSecretKey,
@@ -251,8 +398,9 @@ func (ts *customerService) GenerateCustomerTokens(ctx context.Context, customerI
 
 	logger.Info("refresh token generated", "refreshToken", refreshToken)
 	return GenerateCustomerTokensOutput{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
 	}, nil
 }
 
@@ -262,6 +410,17 @@ func (s *customerService) GetCustomer(ctx context.Context, opts GetCustomerOptio
 		WithContext(ctx).
 		With("opts", opts)
 
+	var unknownFields []string
+	for _, field := range opts.Fields {
+		if !isCustomerProfileField(field) {
+			unknownFields = append(unknownFields, field)
+		}
+	}
+	if len(unknownFields) > 0 {
+		logger.Info("unknown fields", "unknownFields", unknownFields)
+		return nil, errs.WithDetails(ErrGetCustomerUnknownFields, unknownFields)
+	}
+
 	customer, err := s.storages.Customer.GetCustomer(GetCustomerFilter{
 		ID: &opts.ID,
 	})
@@ -275,6 +434,11 @@ func (s *customerService) GetCustomer(ctx context.Context, opts GetCustomerOptio
 	}
 	logger.Debug("got customer", "customer", customer)
 
+	if len(opts.Fields) == 1 && opts.Fields[0] == CustomerProfileFieldID {
+		logger.Info("successfully got customer without vendor profile")
+		return customer, nil
+	}
+
 	store, err := s.storages.Store.GetStore(&opts.StoreVendorID)
 	if err != nil {
 		logger.Error("failed to get store", "err", err)
@@ -284,8 +448,12 @@ func (s *customerService) GetCustomer(ctx context.Context, opts GetCustomerOptio
 		logger.Info("store not found")
 		return nil, ErrGetCustomerStoreNotFound
 	}
+	if customer.StoreID != store.ID {
+		logger.Info("customer belongs to another store")
+		return nil, ErrGetCustomerCustomerNotFoundInStorage
+	}
 
-	vendorCustomer, err := s.apis.VendorAPI.WithStore(store).GetCustomerByVendorID(ctx, customer.VendorCustomerID)
+	vendorCustomer, err := s.getVendorCustomer(ctx, store, customer.VendorCustomerID)
 	if err != nil {
 		logger.Error("failed to get customer from vendor", "err", err)
 		return nil, fmt.Errorf("failed to get customer from vendor: %w", err)
@@ -296,8 +464,249 @@ func (s *customerService) GetCustomer(ctx context.Context, opts GetCustomerOptio
 	}
 	logger.Debug("got customer from vendor", "vendorCustomer", vendorCustomer)
 
-	customer.FirstName = vendorCustomer.FirstName
+	customer.SetProfile(vendorCustomer)
 
 	logger.Info("successfully got customer")
 	return customer, nil
 }
+
+func (s *customerService) UpdateCustomer(ctx context.Context, opts UpdateCustomerOptions) (*entity.Customer, error) {
+	logger := s.logger.
+		Named("UpdateCustomer").
+		WithContext(ctx).
+		With("opts", opts)
+
+	customer, store, err := s.getCustomerAndStore(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get customer and store", "err", err)
+		return nil, fmt.Errorf("failed to get customer and store: %w", err)
+	}
+
+	vendorAccessToken, err := s.getVendorAccessToken(ctx, store, customer)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get vendor access token", "err", err)
+		return nil, fmt.Errorf("failed to get vendor access token: %w", err)
+	}
+
+	output, err := s.apis.VendorAPI.WithStore(store).UpdateCustomer(ctx, UpdateVendorCustomerOptions{
+		AccessToken:      vendorAccessToken,
+		FirstName:        opts.FirstName,
+		LastName:         opts.LastName,
+		Phone:            opts.Phone,
+		AcceptsMarketing: opts.AcceptsMarketing,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to update customer in vendor", "err", err)
+		return nil, fmt.Errorf("failed to update customer in vendor: %w", err)
+	}
+
+	if err := s.evictCachedCustomer(ctx, store.VendorID, customer.VendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return nil, fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	customer.FirstName = output.Customer.FirstName
+	customer.LastName = output.Customer.LastName
+	customer.Phone = output.Customer.Phone
+	customer.AcceptsMarketing = output.Customer.AcceptsMarketing
+
+	logger.Info("successfully updated customer")
+	return customer, nil
+}
+
+func (s *customerService) ChangeCustomerPassword(ctx context.Context, opts ChangeCustomerPasswordOptions) (string, error) {
+	logger := s.logger.
+		Named("ChangeCustomerPassword").
+		WithContext(ctx).
+		With("customerID", opts.ID)
+
+	customer, store, err := s.getCustomerAndStore(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to get customer and store", "err", err)
+		return "", fmt.Errorf("failed to get customer and store: %w", err)
+	}
+
+	vendorAccessToken, err := s.getVendorAccessToken(ctx, store, customer)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to get vendor access token", "err", err)
+		return "", fmt.Errorf("failed to get vendor access token: %w", err)
+	}
+
+	if err := s.verifyCurrentPassword(ctx, store, customer, opts.CurrentPassword); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to verify current password", "err", err)
+		return "", fmt.Errorf("failed to verify current password: %w", err)
+	}
+
+	output, err := s.apis.VendorAPI.WithStore(store).UpdateCustomer(ctx, UpdateVendorCustomerOptions{
+		AccessToken: vendorAccessToken,
+		Password:    &opts.Password,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to update customer password in vendor", "err", err)
+		return "", fmt.Errorf("failed to update customer password in vendor: %w", err)
+	}
+
+	// rotate our tokens as well, so the refresh token issued before the change stops working
+	sessionData := &entity.Customer{}
+	if output.AccessToken != "" {
+		sessionData, err = s.vendorSessionData(output.AccessToken, output.AccessTokenExpiresAt)
+		if err != nil {
+			logger.Error("failed to get vendor session data", "err", err)
+			return "", fmt.Errorf("failed to get vendor session data: %w", err)
+		}
+	}
+	claims, err := s.resolveCustomerClaims(ctx, store, customer.VendorCustomerID)
+	if err != nil {
+		logger.Error("failed to resolve customer claims", "err", err)
+		return "", fmt.Errorf("failed to resolve customer claims: %w", err)
+	}
+	accessToken, err := s.startCustomerSession(ctx, customer, claims, sessionData)
+	if err != nil {
+		logger.Error("failed to start customer session", "err", err)
+		return "", fmt.Errorf("failed to start customer session: %w", err)
+	}
+
+	logger.Info("successfully changed customer password")
+	return accessToken, nil
+}
+
+// verifyCurrentPassword checks the password by logging the customer in vendor with its email, the check is
+// locked out on repeated failures like LoginCustomer. The vendor session created by the check is deleted.
+func (s *customerService) verifyCurrentPassword(ctx context.Context, store *entity.Store, customer *entity.Customer, password string) error {
+	logger := s.logger.
+		Named("verifyCurrentPassword").
+		WithContext(ctx).
+		With("customerID", customer.ID)
+
+	if password == "" {
+		return ErrChangeCustomerPasswordInvalidCurrentPassword
+	}
+
+	profile, err := s.getVendorCustomer(ctx, store, customer.VendorCustomerID)
+	if err != nil {
+		return fmt.Errorf("failed to get vendor customer: %w", err)
+	}
+	if profile == nil || profile.Email == "" {
+		return ErrCustomerNotFound
+	}
+
+	emailAttemptKey := loginAttemptEmailKey(store.ID, profile.Email)
+	if err := s.checkLoginAttempts(ctx, emailAttemptKey, loginAttemptStoreKey(store.ID)); err != nil {
+		if errs.IsExpected(err) {
+			return err
+		}
+		return fmt.Errorf("failed to check login attempts: %w", err)
+	}
+
+	vendorAPI := s.apis.VendorAPI.WithStore(store)
+	loggedIn, err := vendorAPI.GetLoggedInCustomerID(ctx, LoginCustomerOptions{
+		Email:    profile.Email,
+		Password: password,
+	})
+	if err != nil {
+		switch errs.GetCode(err) {
+		case customerInvalidEmailOrPasswordErrCode:
+			if err := s.registerFailedLoginAttempt(ctx, emailAttemptKey, s.cfg.LoginProtection.MaxFailedAttemptsPerEmail, true); err != nil {
+				return fmt.Errorf("failed to register failed login attempt by email: %w", err)
+			}
+			return ErrChangeCustomerPasswordInvalidCurrentPassword
+		case vendorThrottledErrCode:
+			if err := s.lockThrottledStoreLogins(store, err); err != nil {
+				return fmt.Errorf("failed to lock store logins: %w", err)
+			}
+		}
+		if errs.IsExpected(err) {
+			return err
+		}
+		return fmt.Errorf("failed to login customer in vendor: %w", err)
+	}
+
+	// the session is needed only for the check, the customer keeps using its own one
+	if err := vendorAPI.DeleteCustomerAccessToken(ctx, loggedIn.AccessToken); err != nil {
+		logger.Error("failed to delete vendor access token of the password check", "err", err)
+		return fmt.Errorf("failed to delete vendor access token of the password check: %w", err)
+	}
+	if loggedIn.ID != customer.VendorCustomerID {
+		if err := s.registerFailedLoginAttempt(ctx, emailAttemptKey, s.cfg.LoginProtection.MaxFailedAttemptsPerEmail, true); err != nil {
+			return fmt.Errorf("failed to register failed login attempt by email: %w", err)
+		}
+		return ErrChangeCustomerPasswordInvalidCurrentPassword
+	}
+
+	if err := s.storages.LoginAttempt.DeleteLoginAttempt(emailAttemptKey); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+// getCustomerAndStore returns customer by id and store by vendor id.
+func (s *customerService) getCustomerAndStore(ctx context.Context, customerID, storeVendorID string) (*entity.Customer, *entity.Store, error) {
+	logger := s.logger.
+		Named("getCustomerAndStore").
+		WithContext(ctx).
+		With("customerID", customerID, "storeVendorID", storeVendorID)
+
+	customer, err := s.storages.Customer.GetCustomer(GetCustomerFilter{ID: &customerID})
+	if err != nil {
+		logger.Error("failed to get customer", "err", err)
+		return nil, nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+	if customer == nil {
+		logger.Info("customer not found")
+		return nil, nil, ErrCustomerNotFound
+	}
+
+	store, err := s.storages.Store.GetStore(&storeVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return nil, nil, ErrStoreNotFound
+	}
+	if customer.StoreID != store.ID {
+		logger.Info("customer belongs to another store")
+		return nil, nil, ErrCustomerNotFound
+	}
+
+	return customer, store, nil
+}
+
+func isCustomerProfileField(field string) bool {
+	for _, f := range CustomerProfileFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+func (s *customerService) ListCustomerAddresses(ctx context.Context, opts ListCustomerAddressesOptions) ([]entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("ListCustomerAddresses").
+		WithContext(ctx).
+		With("opts", opts)
+
+	session, err := s.getVendorSession(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get vendor session", "err", err)
+		return nil, fmt.Errorf("failed to get vendor session: %w", err)
+	}
+
+	addresses, err := session.api.GetCustomerAddresses(ctx, session.accessToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get customer addresses from vendor", "err", err)
+		return nil, fmt.Errorf("failed to get customer addresses from vendor: %w", err)
+	}
+
+	logger.Info("successfully listed customer addresses")
+	return addresses, nil
+}
+
+func (s *customerService) CreateCustomerAddress(ctx context.Context, opts CreateCustomerAddressOptions) (*entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("CreateCustomerAddress").
+		WithContext(ctx).
+		With("opts", opts)
+
+	session, err := s.getVendorSession(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get vendor session", "err", err)
+		return nil, fmt.Errorf("failed to get vendor session: %w", err)
+	}
+
+	address, err := session.api.CreateCustomerAddress(ctx, CreateVendorCustomerAddressOptions{
+		AccessToken: session.accessToken,
+		Address:     opts.Address,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to create customer address in vendor", "err", err)
+		return nil, fmt.Errorf("failed to create customer address in vendor: %w", err)
+	}
+
+	if opts.Default {
+		err = session.api.SetDefaultCustomerAddress(ctx, SetDefaultVendorCustomerAddressOptions{
+			AccessToken: session.accessToken,
+			AddressID:   address.ID,
+		})
+		if err != nil {
+			if errs.IsExpected(err) {
+				logger.Info(err.Error())
+				return nil, err
+			}
+			logger.Error("failed to set default customer address in vendor", "err", err)
+			return nil, fmt.Errorf("failed to set default customer address in vendor: %w", err)
+		}
+		address.Default = true
+	}
+
+	// the default address is a part of cached customer profile
+	if err := s.evictCachedCustomer(ctx, session.storeVendorID, session.vendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return nil, fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	logger.Info("successfully created customer address")
+	return address, nil
+}
+
+func (s *customerService) UpdateCustomerAddress(ctx context.Context, opts UpdateCustomerAddressOptions) (*entity.CustomerAddress, error) {
+	logger := s.logger.
+		Named("UpdateCustomerAddress").
+		WithContext(ctx).
+		With("opts", opts)
+
+	session, err := s.getVendorSession(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get vendor session", "err", err)
+		return nil, fmt.Errorf("failed to get vendor session: %w", err)
+	}
+
+	address, err := session.api.UpdateCustomerAddress(ctx, UpdateVendorCustomerAddressOptions{
+		AccessToken: session.accessToken,
+		AddressID:   opts.AddressID,
+		Address:     opts.Address,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to update customer address in vendor", "err", err)
+		return nil, fmt.Errorf("failed to update customer address in vendor: %w", err)
+	}
+
+	if err := s.evictCachedCustomer(ctx, session.storeVendorID, session.vendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return nil, fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	logger.Info("successfully updated customer address")
+	return address, nil
+}
+
+func (s *customerService) DeleteCustomerAddress(ctx context.Context, opts DeleteCustomerAddressOptions) error {
+	logger := s.logger.
+		Named("DeleteCustomerAddress").
+		WithContext(ctx).
+		With("opts", opts)
+
+	session, err := s.getVendorSession(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to get vendor session", "err", err)
+		return fmt.Errorf("failed to get vendor session: %w", err)
+	}
+
+	err = session.api.DeleteCustomerAddress(ctx, DeleteVendorCustomerAddressOptions{
+		AccessToken: session.accessToken,
+		AddressID:   opts.AddressID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to delete customer address in vendor", "err", err)
+		return fmt.Errorf("failed to delete customer address in vendor: %w", err)
+	}
+
+	if err := s.evictCachedCustomer(ctx, session.storeVendorID, session.vendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	logger.Info("successfully deleted customer address")
+	return nil
+}
+
+func (s *customerService) SetDefaultCustomerAddress(ctx context.Context, opts SetDefaultCustomerAddressOptions) error {
+	logger := s.logger.
+		Named("SetDefaultCustomerAddress").
+		WithContext(ctx).
+		With("opts", opts)
+
+	session, err := s.getVendorSession(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to get vendor session", "err", err)
+		return fmt.Errorf("failed to get vendor session: %w", err)
+	}
+
+	err = session.api.SetDefaultCustomerAddress(ctx, SetDefaultVendorCustomerAddressOptions{
+		AccessToken: session.accessToken,
+		AddressID:   opts.AddressID,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to set default customer address in vendor", "err", err)
+		return fmt.Errorf("failed to set default customer address in vendor: %w", err)
+	}
+
+	if err := s.evictCachedCustomer(ctx, session.storeVendorID, session.vendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	logger.Info("successfully set default customer address")
+	return nil
+}
+
+// vendorSession is used to act as the customer on vendor API.
+type vendorSession struct {
+	api              VendorAPI
+	accessToken      string
+	storeVendorID    string
+	vendorCustomerID string
+}
+
+// getVendorSession returns vendor API of the customer store and a valid vendor access token of the customer.
+func (s *customerService) getVendorSession(ctx context.Context, customerID, storeVendorID string) (*vendorSession, error) {
+	customer, store, err := s.getCustomerAndStore(ctx, customerID, storeVendorID)
+	if err != nil {
+		return nil, err
+	}
+
+	vendorAccessToken, err := s.getVendorAccessToken(ctx, store, customer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vendorSession{
+		api:              s.apis.VendorAPI.WithStore(store),
+		accessToken:      vendorAccessToken,
+		storeVendorID:    store.VendorID,
+		vendorCustomerID: customer.VendorCustomerID,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+func customerCacheKey(storeVendorID, vendorCustomerID string) string {
+	return fmt.Sprintf("%s:%s", storeVendorID, vendorCustomerID)
+}
+
+// customerCacheTTL returns TTL of cached customers of the store, zero means caching is disabled.
+func (s *serviceContext) customerCacheTTL(store *entity.Store) time.Duration {
+	if store.CustomerCacheTTL == "" {
+		return s.cfg.CustomerCache.TTL
+	}
+	ttl, err := time.ParseDuration(store.CustomerCacheTTL)
+	if err != nil {
+		s.logger.Named("customerCacheTTL").Error("invalid store customer cache ttl", "storeID", store.ID, "err", err)
+		return s.cfg.CustomerCache.TTL
+	}
+	return ttl
+}
+
+// getVendorCustomer returns the vendor customer profile through the cache, nil is returned if customer
+// is missing in vendor. Cache failures are logged and the profile is fetched from vendor.
+func (s *serviceContext) getVendorCustomer(ctx context.Context, store *entity.Store, vendorCustomerID string) (*entity.Customer, error) {
+	logger := s.logger.
+		Named("getVendorCustomer").
+		WithContext(ctx).
+		With("storeVendorID", store.VendorID, "vendorCustomerID", vendorCustomerID)
+
+	ttl := s.customerCacheTTL(store)
+	key := customerCacheKey(store.VendorID, vendorCustomerID)
+	if ttl > 0 {
+		customer, found, err := s.storages.CustomerCache.GetCachedCustomer(key)
+		if err != nil {
+			logger.Error("failed to get cached customer", "err", err)
+		}
+		if found {
+			logger.Debug("got cached customer", "customer", customer)
+			return customer, nil
+		}
+	}
+
+	customer, err := s.apis.VendorAPI.WithStore(store).GetCustomerByVendorID(ctx, vendorCustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer from vendor: %w", err)
+	}
+
+	if ttl > 0 {
+		if customer == nil && s.cfg.CustomerCache.NegativeTTL < ttl {
+			ttl = s.cfg.CustomerCache.NegativeTTL
+		}
+		if err := s.storages.CustomerCache.SetCachedCustomer(key, customer, ttl); err != nil {
+			logger.Error("failed to cache customer", "err", err)
+		}
+	}
+
+	return customer, nil
+}
+
+// evictCachedCustomer removes the customer profile from the cache, e.g. after it's changed in vendor.
+func (s *serviceContext) evictCachedCustomer(ctx context.Context, storeVendorID, vendorCustomerID string) error {
+	if err := s.storages.CustomerCache.DeleteCachedCustomer(customerCacheKey(storeVendorID, vendorCustomerID)); err != nil {
+		return fmt.Errorf("failed to delete cached customer: %w", err)
+	}
+
+	s.logger.Named("evictCachedCustomer").WithContext(ctx).Debug("evicted cached customer", "storeVendorID", storeVendorID, "vendorCustomerID", vendorCustomerID)
+	return nil
+}
+
+func (s *customerService) DeleteExpiredCachedCustomers(ctx context.Context) error {
+	logger := s.logger.
+		Named("DeleteExpiredCachedCustomers").
+		WithContext(ctx)
+
+	deleted, err := s.storages.CustomerCache.DeleteExpiredCachedCustomers(time.Now())
+	if err != nil {
+		logger.Error("failed to delete expired cached customers", "err", err)
+		return fmt.Errorf("failed to delete expired cached customers: %w", err)
+	}
+
+	logger.Info("deleted expired cached customers", "deleted", deleted)
+	return nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+// Claim kinds of customer tag rules.
+const (
+	tagClaimKindRole  = "role"
+	tagClaimKindScope = "scope"
+)
+
+// customerClaims contains permissions of the customer embedded into access token.
+type customerClaims struct {
+	Roles  []string
+	Scopes []string
+}
+
+// tagClaimRule grants roles and scopes to customers with matching tag.
+type tagClaimRule struct {
+	// Tag is matched case insensitively, it's a prefix if Prefix is true.
+	Tag    string
+	Prefix bool
+	Roles  []string
+	Scopes []string
+}
+
+// parseTagClaimRules parses entity.Store CustomerTagClaims, invalid rules and claims are skipped.
+func parseTagClaimRules(value string) []tagClaimRule {
+	var rules []tagClaimRule
+	for _, item := range strings.Split(value, ",") {
+		tag, claims, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+
+		rule := tagClaimRule{Tag: strings.ToLower(strings.TrimSpace(tag))}
+		if strings.HasSuffix(rule.Tag, "*") {
+			rule.Tag = strings.TrimSuffix(rule.Tag, "*")
+			rule.Prefix = true
+		}
+		if rule.Tag == "" {
+			continue
+		}
+
+		for _, claim := range strings.Split(claims, "|") {
+			kind, name, _ := strings.Cut(strings.TrimSpace(claim), ":")
+			if name == "" {
+				continue
+			}
+			switch kind {
+			case tagClaimKindRole:
+				rule.Roles = append(rule.Roles, name)
+			case tagClaimKindScope:
+				rule.Scopes = append(rule.Scopes, name)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// matchTagClaimRules returns unique roles and scopes granted by rules matching any of given tags.
+func matchTagClaimRules(rules []tagClaimRule, tags []string) customerClaims {
+	var claims customerClaims
+	for _, rule := range rules {
+		for _, tag := range tags {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == rule.Tag || (rule.Prefix && strings.HasPrefix(tag, rule.Tag)) {
+				claims.Roles = appendUnique(claims.Roles, rule.Roles...)
+				claims.Scopes = appendUnique(claims.Scopes, rule.Scopes...)
+				break
+			}
+		}
+	}
+	return claims
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		exists := false
+		for _, v := range list {
+			if v == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// resolveCustomerClaims maps vendor tags of the customer to roles and scopes by the store rules,
+// vendor isn't called if the store has no rules. Tags are read through the customer cache.
+func (s *customerService) resolveCustomerClaims(ctx context.Context, store *entity.Store, vendorCustomerID string) (customerClaims, error) {
+	logger := s.logger.
+		Named("resolveCustomerClaims").
+		WithContext(ctx).
+		With("vendorCustomerID", vendorCustomerID)
+
+	rules := parseTagClaimRules(store.CustomerTagClaims)
+	if len(rules) == 0 {
+		return customerClaims{}, nil
+	}
+
+	vendorCustomer, err := s.getVendorCustomer(ctx, store, vendorCustomerID)
+	if err != nil {
+		logger.Error("failed to get customer from vendor", "err", err)
+		return customerClaims{}, fmt.Errorf("failed to get customer from vendor: %w", err)
+	}
+	if vendorCustomer == nil {
+		logger.Info("customer not found in vendor")
+		return customerClaims{}, nil
+	}
+
+	claims := matchTagClaimRules(rules, vendorCustomer.Tags)
+	logger.Debug("resolved customer claims", "tags", vendorCustomer.Tags, "claims", claims)
+	return claims, nil
+}
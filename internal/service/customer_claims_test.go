@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTagClaimRules(t *testing.T) {
+	rules := parseTagClaimRules("wholesale=role:wholesale|scope:prices.wholesale, vip-*=role:vip|scope:content.vip, invalid, *=role:any, gold=role:vip")
+
+	testCases := []struct {
+		name           string
+		tags           []string
+		expectedClaims customerClaims
+	}{
+		{
+			name: "positive: no tags",
+		},
+		{
+			name:           "positive: exact match is case insensitive",
+			tags:           []string{"Wholesale"},
+			expectedClaims: customerClaims{Roles: []string{"wholesale"}, Scopes: []string{"prices.wholesale"}},
+		},
+		{
+			name:           "positive: prefix match",
+			tags:           []string{"vip-2024"},
+			expectedClaims: customerClaims{Roles: []string{"vip"}, Scopes: []string{"content.vip"}},
+		},
+		{
+			name:           "positive: duplicate roles are merged",
+			tags:           []string{"gold", "vip-gold", "wholesale"},
+			expectedClaims: customerClaims{Roles: []string{"wholesale", "vip"}, Scopes: []string{"prices.wholesale", "content.vip"}},
+		},
+		{
+			name: "negative: exact rule doesn't match prefix",
+			tags: []string{"wholesale-eu", "vip"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedClaims, matchTagClaimRules(rules, tc.tags))
+		})
+	}
+}
@@ -0,0 +1,401 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+var _ CustomerImportService = (*customerImportService)(nil)
+
+type customerImportService struct {
+	serviceContext
+}
+
+func NewCustomerImportService(options Options) *customerImportService {
+	return &customerImportService{
+		serviceContext: serviceContext{
+			storages:   options.Storages,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("customerImportService"),
+			apis:       options.APIs,
+			background: options.Background,
+		},
+	}
+}
+
+// unfinishedCustomerImportStatuses are statuses of imports which have to be run.
+var unfinishedCustomerImportStatuses = []string{
+	entity.CustomerImportStatusPending,
+	entity.CustomerImportStatusExporting,
+	entity.CustomerImportStatusImporting,
+}
+
+func (s *customerImportService) StartCustomerImport(ctx context.Context, opts StartCustomerImportOptions) (*entity.CustomerImport, error) {
+	logger := s.logger.
+		Named("StartCustomerImport").
+		WithContext(ctx).
+		With("opts", opts)
+
+	store, err := s.storages.Store.GetStore(&opts.StoreVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return nil, ErrStartCustomerImportStoreNotFound
+	}
+
+	// vendor runs one export per store at a time, so unfinished import is resumed instead
+	unfinished, err := s.storages.CustomerImport.ListCustomerImports(ListCustomerImportsFilter{
+		StoreID:  &store.ID,
+		Statuses: unfinishedCustomerImportStatuses,
+	})
+	if err != nil {
+		logger.Error("failed to list unfinished customer imports", "err", err)
+		return nil, fmt.Errorf("failed to list unfinished customer imports: %w", err)
+	}
+	if len(unfinished) > 0 {
+		logger.Info("store has unfinished customer import", "customerImportID", unfinished[0].ID)
+		return &unfinished[0], nil
+	}
+
+	customerImport, err := s.storages.CustomerImport.CreateCustomerImport(&entity.CustomerImport{
+		StoreID: store.ID,
+		Status:  entity.CustomerImportStatusPending,
+	})
+	if err != nil {
+		logger.Error("failed to create customer import", "err", err)
+		return nil, fmt.Errorf("failed to create customer import: %w", err)
+	}
+
+	logger.Info("successfully created customer import", "customerImportID", customerImport.ID)
+	return customerImport, nil
+}
+
+func (s *customerImportService) GetCustomerImport(ctx context.Context, id string) (*entity.CustomerImport, error) {
+	logger := s.logger.
+		Named("GetCustomerImport").
+		WithContext(ctx).
+		With("id", id)
+
+	customerImport, err := s.storages.CustomerImport.GetCustomerImport(id)
+	if err != nil {
+		logger.Error("failed to get customer import", "err", err)
+		return nil, fmt.Errorf("failed to get customer import: %w", err)
+	}
+	if customerImport == nil {
+		logger.Info("customer import not found")
+		return nil, ErrCustomerImportNotFound
+	}
+
+	logger.Info("successfully got customer import")
+	return customerImport, nil
+}
+
+func (s *customerImportService) ResumeCustomerImports(ctx context.Context) error {
+	logger := s.logger.
+		Named("ResumeCustomerImports").
+		WithContext(ctx)
+
+	customerImports, err := s.storages.CustomerImport.ListCustomerImports(ListCustomerImportsFilter{
+		Statuses: unfinishedCustomerImportStatuses,
+	})
+	if err != nil {
+		logger.Error("failed to list unfinished customer imports", "err", err)
+		return fmt.Errorf("failed to list unfinished customer imports: %w", err)
+	}
+
+	for _, customerImport := range customerImports {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := s.RunCustomerImport(ctx, customerImport.ID); err != nil {
+			logger.Error("failed to run customer import", "err", err, "customerImportID", customerImport.ID)
+		}
+	}
+
+	logger.Info("resumed customer imports", "count", len(customerImports))
+	return nil
+}
+
+func (s *customerImportService) RunCustomerImport(ctx context.Context, id string) (*entity.CustomerImport, error) {
+	logger := s.logger.
+		Named("RunCustomerImport").
+		WithContext(ctx).
+		With("id", id)
+
+	customerImport, err := s.GetCustomerImport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if customerImport.IsFinished() {
+		logger.Info("customer import is already finished", "status", customerImport.Status)
+		return customerImport, nil
+	}
+
+	// replicas share imports, so the import is run only by the one holding its lease
+	owner := uuid.NewString()
+	now := time.Now()
+	claimed, err := s.storages.CustomerImport.ClaimCustomerImport(id, owner, now, now.Add(s.cfg.CustomerImport.Lease))
+	if err != nil {
+		logger.Error("failed to claim customer import", "err", err)
+		return nil, fmt.Errorf("failed to claim customer import: %w", err)
+	}
+	if !claimed {
+		logger.Info("customer import is already running")
+		return s.GetCustomerImport(ctx, id)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	leaseDone := make(chan struct{})
+	go func() {
+		defer close(leaseDone)
+		s.keepCustomerImportLease(ctx, cancel, id, owner)
+	}()
+	defer func() {
+		cancel()
+		<-leaseDone
+		if err := s.storages.CustomerImport.ReleaseCustomerImport(id, owner); err != nil {
+			logger.Error("failed to release customer import", "err", err)
+		}
+	}()
+
+	store, err := s.storages.Store.GetStoreByID(customerImport.StoreID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return s.failCustomerImport(ctx, customerImport, "store not found")
+	}
+	vendorAPI := s.apis.VendorAPI.WithStore(store)
+
+	if customerImport.Status == entity.CustomerImportStatusPending {
+		bulkOperationID, err := vendorAPI.StartCustomersExport(ctx)
+		if err != nil {
+			logger.Error("failed to start customers export", "err", err)
+			return s.failCustomerImport(ctx, customerImport, err.Error())
+		}
+		customerImport, err = s.updateCustomerImport(customerImport, &entity.CustomerImport{
+			Status:          entity.CustomerImportStatusExporting,
+			BulkOperationID: bulkOperationID,
+		})
+		if err != nil {
+			logger.Error("failed to update customer import", "err", err)
+			return nil, fmt.Errorf("failed to update customer import: %w", err)
+		}
+	}
+
+	if customerImport.Status == entity.CustomerImportStatusExporting {
+		export, err := s.waitCustomersExport(ctx, vendorAPI, customerImport.BulkOperationID)
+		if err != nil {
+			logger.Error("failed to wait for customers export", "err", err)
+			return nil, fmt.Errorf("failed to wait for customers export: %w", err)
+		}
+		if export == nil || export.Status == VendorExportStatusFailed {
+			reason := "customers export not found"
+			if export != nil {
+				reason = fmt.Sprintf("customers export failed: %s", export.Error)
+			}
+			logger.Info(reason)
+			return s.failCustomerImport(ctx, customerImport, reason)
+		}
+		customerImport, err = s.updateCustomerImport(customerImport, &entity.CustomerImport{
+			Status:     entity.CustomerImportStatusImporting,
+			ResultURL:  export.ResultURL,
+			TotalCount: export.ObjectCount,
+		})
+		if err != nil {
+			logger.Error("failed to update customer import", "err", err)
+			return nil, fmt.Errorf("failed to update customer import: %w", err)
+		}
+	}
+
+	if err := s.importExportedCustomers(ctx, vendorAPI, customerImport); err != nil {
+		if ctx.Err() != nil {
+			logger.Info("customer import is interrupted", "importedCount", customerImport.ImportedCount)
+			return nil, err
+		}
+		logger.Error("failed to import exported customers", "err", err)
+		return s.failCustomerImport(ctx, customerImport, err.Error())
+	}
+
+	completedAt := time.Now()
+	customerImport, err = s.updateCustomerImport(customerImport, &entity.CustomerImport{
+		Status:      entity.CustomerImportStatusCompleted,
+		CompletedAt: &completedAt,
+	})
+	if err != nil {
+		logger.Error("failed to update customer import", "err", err)
+		return nil, fmt.Errorf("failed to update customer import: %w", err)
+	}
+
+	logger.Info("successfully imported customers", "importedCount", customerImport.ImportedCount)
+	return customerImport, nil
+}
+
+// keepCustomerImportLease renews the lease of owner until ctx is done, the run is cancelled by cancel
+// once the lease is lost, e.g. it expired while DB was unavailable and another replica claimed the import.
+func (s *customerImportService) keepCustomerImportLease(ctx context.Context, cancel context.CancelFunc, id, owner string) {
+	logger := s.logger.
+		Named("keepCustomerImportLease").
+		WithContext(ctx).
+		With("id", id)
+
+	lease := s.cfg.CustomerImport.Lease
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		claimed, err := s.storages.CustomerImport.ClaimCustomerImport(id, owner, now, now.Add(lease))
+		if err != nil {
+			// the lease is still valid for a while, so it's renewed on the next tick
+			logger.Error("failed to renew customer import lease", "err", err)
+			continue
+		}
+		if !claimed {
+			logger.Info("customer import lease is lost")
+			cancel()
+			return
+		}
+	}
+}
+
+// waitCustomersExport polls vendor until the export is finished and returns it, nil is returned if there is no such export.
+func (s *customerImportService) waitCustomersExport(ctx context.Context, vendorAPI VendorAPI, id string) (*VendorCustomersExport, error) {
+	ticker := time.NewTicker(s.cfg.CustomerImport.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		export, err := vendorAPI.GetCustomersExport(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get customers export: %w", err)
+		}
+		if export == nil || export.Status != VendorExportStatusRunning {
+			return export, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// importExportedCustomers saves exported customers in batches, customers imported before are skipped.
+// Progress is saved to customerImport after every batch.
+func (s *customerImportService) importExportedCustomers(ctx context.Context, vendorAPI VendorAPI, customerImport *entity.CustomerImport) error {
+	logger := s.logger.
+		Named("importExportedCustomers").
+		WithContext(ctx).
+		With("id", customerImport.ID, "importedCount", customerImport.ImportedCount)
+
+	// nothing was exported
+	if customerImport.ResultURL == "" {
+		return nil
+	}
+
+	batchSize := s.cfg.CustomerImport.BatchSize
+	batch := make([]entity.Customer, 0, batchSize)
+	line := 0
+	flush := func() error {
+		if err := s.storages.Customer.UpsertCustomers(batch); err != nil {
+			return fmt.Errorf("failed to upsert customers: %w", err)
+		}
+		if _, err := s.updateCustomerImport(customerImport, &entity.CustomerImport{ImportedCount: line}); err != nil {
+			return fmt.Errorf("failed to update customer import: %w", err)
+		}
+		batch = batch[:0]
+		logger.Debug("imported customers batch", "importedCount", line)
+		return nil
+	}
+
+	err := vendorAPI.ReadExportedCustomers(ctx, customerImport.ResultURL, func(vendorCustomerID string) error {
+		line++
+		if line <= customerImport.ImportedCount {
+			return nil
+		}
+		batch = append(batch, entity.Customer{
+			StoreID:          customerImport.StoreID,
+			VendorCustomerID: vendorCustomerID,
+		})
+		if len(batch) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return flush()
+	}
+
+	return nil
+}
+
+// updateCustomerImport saves non-empty fields of update and applies them to customerImport.
+func (s *customerImportService) updateCustomerImport(customerImport *entity.CustomerImport, update *entity.CustomerImport) (*entity.CustomerImport, error) {
+	if _, err := s.storages.CustomerImport.UpdateCustomerImport(customerImport.ID, update); err != nil {
+		return nil, err
+	}
+
+	if update.Status != "" {
+		customerImport.Status = update.Status
+	}
+	if update.BulkOperationID != "" {
+		customerImport.BulkOperationID = update.BulkOperationID
+	}
+	if update.ResultURL != "" {
+		customerImport.ResultURL = update.ResultURL
+	}
+	if update.TotalCount != 0 {
+		customerImport.TotalCount = update.TotalCount
+	}
+	if update.ImportedCount != 0 {
+		customerImport.ImportedCount = update.ImportedCount
+	}
+	if update.Error != "" {
+		customerImport.Error = update.Error
+	}
+	if update.CompletedAt != nil {
+		customerImport.CompletedAt = update.CompletedAt
+	}
+	return customerImport, nil
+}
+
+// failCustomerImport marks the import as failed with given reason and returns it.
+func (s *customerImportService) failCustomerImport(ctx context.Context, customerImport *entity.CustomerImport, reason string) (*entity.CustomerImport, error) {
+	logger := s.logger.
+		Named("failCustomerImport").
+		WithContext(ctx).
+		With("id", customerImport.ID, "reason", reason)
+
+	completedAt := time.Now()
+	customerImport, err := s.updateCustomerImport(customerImport, &entity.CustomerImport{
+		Status:      entity.CustomerImportStatusFailed,
+		Error:       reason,
+		CompletedAt: &completedAt,
+	})
+	if err != nil {
+		logger.Error("failed to update customer import", "err", err)
+		return nil, fmt.Errorf("failed to update customer import: %w", err)
+	}
+
+	logger.Info("customer import failed")
+	return customerImport, nil
+}
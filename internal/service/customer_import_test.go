@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// memoryCustomerImportStorage keeps a single import in memory, claims are atomic like the conditional update.
+type memoryCustomerImportStorage struct {
+	service.CustomerImportStorage
+	mu             sync.Mutex
+	customerImport entity.CustomerImport
+}
+
+func (f *memoryCustomerImportStorage) GetCustomerImport(string) (*entity.CustomerImport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	customerImport := f.customerImport
+	return &customerImport, nil
+}
+
+func (f *memoryCustomerImportStorage) UpdateCustomerImport(_ string, update *entity.CustomerImport) (*entity.CustomerImport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if update.Status != "" {
+		f.customerImport.Status = update.Status
+	}
+	return update, nil
+}
+
+func (f *memoryCustomerImportStorage) ClaimCustomerImport(_, owner string, now, leaseUntil time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	leased := f.customerImport.LeaseOwner != owner && f.customerImport.LeaseUntil != nil && f.customerImport.LeaseUntil.After(now)
+	if f.customerImport.IsFinished() || leased {
+		return false, nil
+	}
+	f.customerImport.LeaseOwner, f.customerImport.LeaseUntil = owner, &leaseUntil
+	return true, nil
+}
+
+func (f *memoryCustomerImportStorage) ReleaseCustomerImport(_, owner string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.customerImport.LeaseOwner == owner {
+		f.customerImport.LeaseOwner, f.customerImport.LeaseUntil = "", nil
+	}
+	return nil
+}
+
+// exportVendorAPI counts started exports, they take a while so concurrent runs overlap.
+type exportVendorAPI struct {
+	service.VendorAPI
+	started atomic.Int32
+}
+
+func (f *exportVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *exportVendorAPI) StartCustomersExport(context.Context) (string, error) {
+	f.started.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return "export", nil
+}
+
+func (f *exportVendorAPI) GetCustomersExport(_ context.Context, id string) (*service.VendorCustomersExport, error) {
+	return &service.VendorCustomersExport{ID: id, Status: service.VendorExportStatusCompleted}, nil
+}
+
+type importStoreStorage struct {
+	service.StoreStorage
+}
+
+func (f *importStoreStorage) GetStoreByID(id string) (*entity.Store, error) {
+	return &entity.Store{ID: id}, nil
+}
+
+func TestRunCustomerImportConcurrentReplicas(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.CustomerImport.PollInterval = time.Millisecond
+	cfg.CustomerImport.BatchSize = 10
+	cfg.CustomerImport.Lease = time.Minute
+
+	imports := &memoryCustomerImportStorage{customerImport: entity.CustomerImport{
+		ID:      "import",
+		StoreID: "store",
+		Status:  entity.CustomerImportStatusPending,
+	}}
+	vendorAPI := &exportVendorAPI{}
+
+	// every replica has its own service, so only the storage claim keeps them from running the same import
+	const replicas = 5
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		customerImportService := service.NewCustomerImportService(service.Options{
+			APIs:     service.APIs{VendorAPI: vendorAPI},
+			Storages: service.Storages{CustomerImport: imports, Store: &importStoreStorage{}},
+			Config:   cfg,
+			Logger:   logging.NewZapLogger("error"),
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := customerImportService.RunCustomerImport(context.Background(), "import")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	customerImport, err := imports.GetCustomerImport("import")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), vendorAPI.started.Load())
+	assert.Equal(t, entity.CustomerImportStatusCompleted, customerImport.Status)
+	// the lease is released once the import is finished
+	assert.Empty(t, customerImport.LeaseOwner)
+}
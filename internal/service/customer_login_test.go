@@ -0,0 +1,380 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/api/captcha"
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+	"github.com/taraslis453/shopify-customer-auth/internal/storage"
+)
+
+// fakeVendorAPI logs in every customer as the same vendor customer, other methods aren't implemented.
+type fakeVendorAPI struct {
+	service.VendorAPI
+	loggedInCustomer service.LoggedInVendorCustomer
+}
+
+func (f *fakeVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *fakeVendorAPI) GetLoggedInCustomerID(context.Context, service.LoginCustomerOptions) (*service.LoggedInVendorCustomer, error) {
+	customer := f.loggedInCustomer
+	return &customer, nil
+}
+
+// lockedCustomerStorage keeps customers in memory, transactions are serialized like the locked customer row.
+type lockedCustomerStorage struct {
+	service.CustomerStorage
+	tx        sync.Mutex
+	mu        sync.Mutex
+	customers map[string]*entity.Customer
+	// inTransaction is set while a transaction holds the lock.
+	inTransaction atomic.Bool
+}
+
+func (f *lockedCustomerStorage) Transaction(fn func(tx service.CustomerStorage) error) error {
+	f.tx.Lock()
+	defer f.tx.Unlock()
+	f.inTransaction.Store(true)
+	defer f.inTransaction.Store(false)
+	return fn(f)
+}
+
+func (f *lockedCustomerStorage) UpsertCustomer(customer *entity.Customer) (*entity.Customer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := customer.StoreID + ":" + customer.VendorCustomerID
+	if existing, ok := f.customers[key]; ok {
+		return existing, nil
+	}
+	customer.ID = fmt.Sprintf("customer-%d", len(f.customers)+1)
+	f.customers[key] = customer
+	return customer, nil
+}
+
+func (f *lockedCustomerStorage) UpdateCustomer(_ string, customer *entity.Customer) (*entity.Customer, error) {
+	return customer, nil
+}
+
+type memoryLoginAttemptStorage struct {
+	service.LoginAttemptStorage
+}
+
+func (f *memoryLoginAttemptStorage) GetLoginAttempts([]string) ([]entity.LoginAttempt, error) {
+	return nil, nil
+}
+
+func (f *memoryLoginAttemptStorage) DeleteLoginAttempt(string) error {
+	return nil
+}
+
+// claimsVendorAPI counts vendor customer reads made while the customer row is locked.
+type claimsVendorAPI struct {
+	fakeVendorAPI
+	customers     *lockedCustomerStorage
+	lockedReads   atomic.Int32
+	unlockedReads atomic.Int32
+}
+
+func (f *claimsVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *claimsVendorAPI) GetCustomerByVendorID(_ context.Context, vendorCustomerID string) (*entity.Customer, error) {
+	if f.customers.inTransaction.Load() {
+		f.lockedReads.Add(1)
+	} else {
+		f.unlockedReads.Add(1)
+	}
+	return &entity.Customer{VendorCustomerID: vendorCustomerID, Tags: []string{"wholesale"}}, nil
+}
+
+// TestLoginCustomerConcurrentFirstLoginInMemory checks concurrent first logins share one customer and vendor
+// isn't called while the customer is locked, TestLoginCustomerConcurrentFirstLogin checks it with Postgres.
+func TestLoginCustomerConcurrentFirstLoginInMemory(t *testing.T) {
+	store := &entity.Store{ID: "store", VendorID: "test.myshopify.com", CustomerTagClaims: "wholesale=role:wholesale"}
+	customers := &lockedCustomerStorage{customers: map[string]*entity.Customer{}}
+	vendorAPI := &claimsVendorAPI{
+		fakeVendorAPI: fakeVendorAPI{
+			loggedInCustomer: service.LoggedInVendorCustomer{
+				ID:                   "1001",
+				AccessToken:          "storefront-token",
+				AccessTokenExpiresAt: time.Now().Add(24 * time.Hour),
+			},
+		},
+		customers: customers,
+	}
+
+	cfg := &config.Config{}
+	cfg.Auth.TokenIssuer = "API"
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.Auth.AccessTokenLifetime = time.Hour
+	cfg.Auth.RefreshTokenLifetime = 24 * time.Hour
+	cfg.Auth.EncryptionKey = "encryption-key"
+
+	customerService := service.NewCustomerService(service.Options{
+		APIs: service.APIs{VendorAPI: vendorAPI},
+		Storages: service.Storages{
+			Customer:     customers,
+			Store:        &passwordStoreStorage{store: store},
+			LoginAttempt: &memoryLoginAttemptStorage{},
+		},
+		Config: cfg,
+		Logger: logging.NewZapLogger("error"),
+	})
+
+	const logins = 20
+	var wg sync.WaitGroup
+	loginErrs := make(chan error, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := customerService.LoginCustomer(context.Background(), service.LoginCustomerOptions{
+				Email:         "customer@example.com",
+				Password:      "password",
+				StoreVendorID: store.VendorID,
+				ClientIP:      fmt.Sprintf("10.0.0.%d", i),
+			})
+			loginErrs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(loginErrs)
+
+	for err := range loginErrs {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, customers.customers, 1)
+	assert.Equal(t, int32(logins), vendorAPI.unlockedReads.Load())
+	assert.Zero(t, vendorAPI.lockedReads.Load())
+}
+
+func TestLoginCustomerCaptcha(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.TokenIssuer = "API"
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.Auth.AccessTokenLifetime = time.Hour
+	cfg.Auth.RefreshTokenLifetime = 24 * time.Hour
+	cfg.Auth.EncryptionKey = "encryption-key"
+	providerErr := errors.New("provider is unavailable")
+
+	testCases := []struct {
+		name          string
+		captcha       *captcha.Fake
+		token         string
+		expectedError error
+	}{
+		{
+			name:    "positive: valid captcha token",
+			captcha: &captcha.Fake{ValidToken: "valid"},
+			token:   "valid",
+		},
+		{
+			name:          "negative: missing captcha token",
+			captcha:       &captcha.Fake{ValidToken: "valid"},
+			expectedError: service.ErrCaptchaRequired,
+		},
+		{
+			name:          "negative: invalid captcha token",
+			captcha:       &captcha.Fake{ValidToken: "valid"},
+			token:         "invalid",
+			expectedError: service.ErrCaptchaInvalid,
+		},
+		{
+			name:          "negative: captcha provider is unavailable",
+			captcha:       &captcha.Fake{Err: providerErr},
+			token:         "valid",
+			expectedError: providerErr,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &entity.Store{
+				ID:               "store",
+				VendorID:         "test.myshopify.com",
+				CaptchaProvider:  entity.CaptchaProviderTurnstile,
+				CaptchaEndpoints: entity.CaptchaEndpointLogin,
+			}
+			customers := &lockedCustomerStorage{customers: map[string]*entity.Customer{}}
+			customerService := service.NewCustomerService(service.Options{
+				APIs: service.APIs{
+					VendorAPI: &claimsVendorAPI{
+						fakeVendorAPI: fakeVendorAPI{
+							loggedInCustomer: service.LoggedInVendorCustomer{
+								ID:                   "1001",
+								AccessToken:          "storefront-token",
+								AccessTokenExpiresAt: time.Now().Add(24 * time.Hour),
+							},
+						},
+						customers: customers,
+					},
+					Captcha: tc.captcha,
+				},
+				Storages: service.Storages{
+					Customer:     customers,
+					Store:        &passwordStoreStorage{store: store},
+					LoginAttempt: &memoryLoginAttemptStorage{},
+				},
+				Config: cfg,
+				Logger: logging.NewZapLogger("error"),
+			})
+
+			accessToken, err := customerService.LoginCustomer(context.Background(), service.LoginCustomerOptions{
+				Email:         "customer@example.com",
+				Password:      "password",
+				StoreVendorID: store.VendorID,
+				ClientIP:      "10.0.0.1",
+				CaptchaToken:  tc.token,
+			})
+			if tc.expectedError != nil {
+				assert.ErrorIs(t, err, tc.expectedError)
+				assert.Empty(t, accessToken)
+				assert.Empty(t, customers.customers)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, accessToken)
+			assert.Len(t, customers.customers, 1)
+		})
+	}
+}
+
+// TestLoginCustomerConcurrentFirstLogin needs a real Postgres, it's skipped unless TEST_POSTGRESQL_HOST is set,
+// the rest of connection settings are taken from TEST_POSTGRESQL_USER, TEST_POSTGRESQL_PASSWORD and TEST_POSTGRESQL_DATABASE,
+// e.g. TEST_POSTGRESQL_HOST=localhost TEST_POSTGRESQL_USER=postgres TEST_POSTGRESQL_PASSWORD=postgres
+// TEST_POSTGRESQL_DATABASE=api go test ./internal/service/ -run TestLoginCustomerConcurrentFirstLogin.
+func TestLoginCustomerConcurrentFirstLogin(t *testing.T) {
+	host := os.Getenv("TEST_POSTGRESQL_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRESQL_HOST is not set")
+	}
+
+	db, err := postgresql.NewPostgreSQLGorm(postgresql.Config{
+		User:     os.Getenv("TEST_POSTGRESQL_USER"),
+		Password: os.Getenv("TEST_POSTGRESQL_PASSWORD"),
+		Host:     host,
+		Database: os.Getenv("TEST_POSTGRESQL_DATABASE"),
+	})
+	require.NoError(t, err)
+	err = db.DB.AutoMigrate(
+		&entity.Store{},
+		&entity.Customer{},
+		&entity.OIDCProvider{},
+		&entity.CustomerIdentity{},
+		&entity.LoginAttempt{},
+	)
+	require.NoError(t, err)
+
+	storages := service.Storages{
+		Customer:         storage.NewCustomerStorage(db),
+		CustomerIdentity: storage.NewCustomerIdentityStorage(db),
+		Store:            storage.NewStoreStorage(db),
+		LoginAttempt:     storage.NewLoginAttemptStorage(db),
+		CustomerCache:    storage.NewMemoryCustomerCacheStorage(100),
+	}
+
+	store := &entity.Store{VendorID: fmt.Sprintf("test-%d.myshopify.com", time.Now().UnixNano())}
+	require.NoError(t, db.DB.Create(store).Error)
+	t.Cleanup(func() {
+		assert.NoError(t, storages.Store.PurgeStore(store))
+	})
+
+	cfg := &config.Config{}
+	cfg.Auth.TokenIssuer = "API"
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.Auth.AccessTokenLifetime = time.Hour
+	cfg.Auth.RefreshTokenLifetime = 24 * time.Hour
+	cfg.Auth.EncryptionKey = "encryption-key"
+
+	customerService := service.NewCustomerService(service.Options{
+		APIs: service.APIs{
+			VendorAPI: &fakeVendorAPI{
+				loggedInCustomer: service.LoggedInVendorCustomer{
+					ID:                   "1001",
+					AccessToken:          "storefront-token",
+					AccessTokenExpiresAt: time.Now().Add(24 * time.Hour),
+				},
+			},
+		},
+		Storages: storages,
+		Config:   cfg,
+		Logger:   logging.NewZapLogger("error"),
+	})
+
+	const logins = 20
+	var wg sync.WaitGroup
+	loginErrs := make(chan error, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := customerService.LoginCustomer(context.Background(), service.LoginCustomerOptions{
+				Email:         "customer@example.com",
+				Password:      "password",
+				StoreVendorID: store.VendorID,
+				ClientIP:      fmt.Sprintf("10.0.0.%d", i),
+			})
+			loginErrs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(loginErrs)
+
+	for err := range loginErrs {
+		assert.NoError(t, err)
+	}
+
+	var count int64
+	err = db.DB.Model(&entity.Customer{}).
+		Where("store_id = ? AND vendor_customer_id = ?", store.ID, "1001").
+		Count(&count).Error
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+// expiringLoginAttemptStorage records the bounds login attempts are deleted by.
+type expiringLoginAttemptStorage struct {
+	memoryLoginAttemptStorage
+	failedBefore time.Time
+	lockedBefore time.Time
+}
+
+func (f *expiringLoginAttemptStorage) DeleteExpiredLoginAttempts(failedBefore, lockedBefore time.Time) (int64, error) {
+	f.failedBefore, f.lockedBefore = failedBefore, lockedBefore
+	return 1, nil
+}
+
+func TestDeleteExpiredLoginAttempts(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LoginProtection.FailedAttemptsWindow = 15 * time.Minute
+
+	attempts := &expiringLoginAttemptStorage{}
+	customerService := service.NewCustomerService(service.Options{
+		Storages: service.Storages{LoginAttempt: attempts},
+		Config:   cfg,
+		Logger:   logging.NewZapLogger("error"),
+	})
+
+	require.NoError(t, customerService.DeleteExpiredLoginAttempts(context.Background()))
+	// attempts are kept while they are counted within the window or locked
+	assert.WithinDuration(t, time.Now().Add(-15*time.Minute), attempts.failedBefore, time.Second)
+	assert.WithinDuration(t, time.Now(), attempts.lockedBefore, time.Second)
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+	"github.com/taraslis453/shopify-customer-auth/pkg/token"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+const (
+	// oidcStateLifetime is how long the customer has to complete the login on provider side.
+	oidcStateLifetime = 10 * time.Minute
+	// oidcStateCookieName is a name of the cookie holding the signed state in the browser which started the login.
+	oidcStateCookieName = "oidc_login_state"
+)
+
+// oidcStateClaims is a payload of a signed state passed through the upstream OIDC provider.
+type oidcStateClaims struct {
+	StoreVendorID string `json:"storeVendorId"`
+	Provider      string `json:"provider"`
+	Nonce         string `json:"nonce"`
+	ReturnURL     string `json:"returnUrl"`
+}
+
+func (s *customerService) StartOIDCLogin(c *gin.Context, opts StartOIDCLoginOptions) (string, error) {
+	logger := s.logger.
+		Named("StartOIDCLogin").
+		WithContext(c).
+		With("opts", opts)
+
+	store, err := s.storages.Store.GetStore(&opts.StoreVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return "", fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return "", ErrStartOIDCLoginStoreNotFound
+	}
+
+	provider, err := s.storages.OIDCProvider.GetOIDCProvider(GetOIDCProviderFilter{
+		StoreID: &store.ID,
+		Name:    &opts.ProviderName,
+	})
+	if err != nil {
+		logger.Error("failed to get oidc provider", "err", err)
+		return "", fmt.Errorf("failed to get oidc provider: %w", err)
+	}
+	if provider == nil {
+		logger.Info("oidc provider not found")
+		return "", ErrStartOIDCLoginProviderNotFound
+	}
+
+	err = s.verifyCaptcha(c, verifyCaptchaOptions{
+		Store:    store,
+		Endpoint: entity.CaptchaEndpointLogin,
+		Token:    opts.CaptchaToken,
+		RemoteIP: opts.ClientIP,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to verify captcha", "err", err)
+		return "", fmt.Errorf("failed to verify captcha: %w", err)
+	}
+
+	if opts.ReturnURL != "" && !isStoreURL(store, opts.ReturnURL) {
+		logger.Info("return url doesn't belong to the store")
+		return "", ErrStartOIDCLoginInvalidReturnURL
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		logger.Error("failed to generate nonce", "err", err)
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	t := time.Now()
+	state, err := token.SignJWTToken(
+		&token.UniversalClaims{
+			Iss:   s.oidcStateIssuer(),
+			ExpAt: t.Add(oidcStateLifetime),
+			NbfAt: t,
+			IssAt: t,
+			Payload: oidcStateClaims{
+				StoreVendorID: store.VendorID,
+				Provider:      provider.Name,
+				Nonce:         nonce,
+				ReturnURL:     opts.ReturnURL,
+			},
+		},
+		s.cfg.Auth.TokenSecretKey,
+	)
+	if err != nil {
+		logger.Error("failed to sign state", "err", err)
+		return "", fmt.Errorf("failed to sign state: %w", err)
+	}
+
+	authorizationURL, err := s.apis.OIDC.GetAuthorizationURL(provider, GetOIDCAuthorizationURLOptions{
+		RedirectURL: s.oidcRedirectURL(provider.Name),
+		State:       state,
+		Nonce:       nonce,
+	})
+	if err != nil {
+		logger.Error("failed to get authorization url", "err", err)
+		return "", fmt.Errorf("failed to get authorization url: %w", err)
+	}
+	logger = logger.With("authorizationURL", authorizationURL)
+
+	// the callback accepts the state only along with the cookie, so a state of another browser can't be injected
+	s.setOIDCStateCookie(c, state, int(oidcStateLifetime.Seconds()))
+
+	logger.Info("successfully started oidc login")
+	return authorizationURL, nil
+}
+
+// NOTE: email lockouts of LoginCustomer don't apply to OIDC logins as no password is checked, failed callbacks
+// are counted by client IP instead.
+func (s *customerService) LoginCustomerWithOIDC(c *gin.Context, opts LoginCustomerWithOIDCOptions) (LoginCustomerWithOIDCOutput, error) {
+	var ctx context.Context = c
+	logger := s.logger.
+		Named("LoginCustomerWithOIDC").
+		WithContext(c).
+		With("provider", opts.ProviderName)
+
+	ipAttemptKey := loginAttemptIPKey(opts.ClientIP)
+	if err := s.checkLoginAttempts(ctx, ipAttemptKey); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return LoginCustomerWithOIDCOutput{}, err
+		}
+		logger.Error("failed to check login attempts", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to check login attempts: %w", err)
+	}
+
+	state, ok := s.verifyOIDCState(c, opts)
+	if !ok {
+		logger.Info("invalid state")
+		return LoginCustomerWithOIDCOutput{}, s.failOIDCLogin(ctx, ipAttemptKey, ErrLoginCustomerWithOIDCInvalidState)
+	}
+	logger = logger.With("storeVendorID", state.StoreVendorID)
+
+	store, err := s.storages.Store.GetStore(&state.StoreVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return LoginCustomerWithOIDCOutput{}, ErrLoginCustomerWithOIDCStoreNotFound
+	}
+
+	provider, err := s.storages.OIDCProvider.GetOIDCProvider(GetOIDCProviderFilter{
+		StoreID: &store.ID,
+		Name:    &state.Provider,
+	})
+	if err != nil {
+		logger.Error("failed to get oidc provider", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to get oidc provider: %w", err)
+	}
+	if provider == nil {
+		logger.Info("oidc provider not found")
+		return LoginCustomerWithOIDCOutput{}, ErrLoginCustomerWithOIDCProviderNotFound
+	}
+
+	// logins of the store are locked while vendor throttles them
+	if err := s.checkLoginAttempts(ctx, loginAttemptStoreKey(store.ID)); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return LoginCustomerWithOIDCOutput{}, err
+		}
+		logger.Error("failed to check login attempts", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to check login attempts: %w", err)
+	}
+
+	idToken, err := s.apis.OIDC.ExchangeCode(ctx, provider, ExchangeOIDCCodeOptions{
+		Code:        opts.Code,
+		RedirectURL: s.oidcRedirectURL(provider.Name),
+		Nonce:       state.Nonce,
+	})
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return LoginCustomerWithOIDCOutput{}, s.failOIDCLogin(ctx, ipAttemptKey, err)
+		}
+		logger.Error("failed to exchange code", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	logger = logger.With("subject", idToken.Subject)
+	logger.Debug("got id token")
+
+	customer, err := s.getCustomerByIdentity(ctx, store, provider, idToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return LoginCustomerWithOIDCOutput{}, err
+		}
+		logger.Error("failed to get customer by identity", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to get customer by identity: %w", err)
+	}
+	logger = logger.With("customerID", customer.ID)
+
+	claims, err := s.resolveCustomerClaims(ctx, store, customer.VendorCustomerID)
+	if err != nil {
+		logger.Error("failed to resolve customer claims", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to resolve customer claims: %w", err)
+	}
+	accessToken, err := s.startCustomerSession(ctx, customer, claims, nil)
+	if err != nil {
+		logger.Error("failed to start customer session", "err", err)
+		return LoginCustomerWithOIDCOutput{}, fmt.Errorf("failed to start customer session: %w", err)
+	}
+
+	logger.Info("customer logged in with oidc")
+	return LoginCustomerWithOIDCOutput{
+		AccessToken: accessToken,
+		ReturnURL:   state.ReturnURL,
+	}, nil
+}
+
+// verifyOIDCState checks that the state is signed for the provider and it's the one stored in the cookie
+// by StartOIDCLogin in the same browser. The cookie is removed, so every state is accepted once.
+func (s *customerService) verifyOIDCState(c *gin.Context, opts LoginCustomerWithOIDCOptions) (oidcStateClaims, bool) {
+	cookie, err := c.Cookie(oidcStateCookieName)
+	if err != nil {
+		return oidcStateClaims{}, false
+	}
+	s.setOIDCStateCookie(c, "", -1)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(opts.State)) != 1 {
+		return oidcStateClaims{}, false
+	}
+
+	stateClaims, err := token.VerifyJWTToken(token.VerifyJWTTokenOptions{
+		Token:  opts.State,
+		Secret: s.cfg.Auth.TokenSecretKey,
+	})
+	if err != nil || stateClaims.Iss != s.oidcStateIssuer() {
+		return oidcStateClaims{}, false
+	}
+	var state oidcStateClaims
+	if err := mapstructure.Decode(stateClaims.GetPayload(), &state); err != nil || state.Provider != opts.ProviderName {
+		return oidcStateClaims{}, false
+	}
+
+	return state, true
+}
+
+func (s *customerService) setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	// lax cookies are sent on the top-level redirect back from provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookieName, value, maxAge, "/customers/oidc", "", strings.HasPrefix(s.cfg.App.BaseURL, "https://"), true)
+}
+
+// failOIDCLogin counts the failed OIDC callback of the client and returns given error.
+func (s *customerService) failOIDCLogin(ctx context.Context, ipAttemptKey string, err error) error {
+	if registerErr := s.registerFailedLoginAttempt(ctx, ipAttemptKey, s.cfg.LoginProtection.MaxFailedAttemptsPerIP, false); registerErr != nil {
+		return fmt.Errorf("failed to register failed login attempt by ip: %w", registerErr)
+	}
+	return err
+}
+
+// getCustomerByIdentity returns customer linked to the identity. If there is no linked customer yet,
+// vendor customer is looked up by verified email (or created) and linked to the identity.
+func (s *customerService) getCustomerByIdentity(ctx context.Context, store *entity.Store, provider *entity.OIDCProvider, idToken *OIDCIDTokenClaims) (*entity.Customer, error) {
+	logger := s.logger.
+		Named("getCustomerByIdentity").
+		WithContext(ctx).
+		With("providerID", provider.ID, "subject", idToken.Subject)
+
+	identity, err := s.storages.CustomerIdentity.GetCustomerIdentity(GetCustomerIdentityFilter{
+		ProviderID: &provider.ID,
+		Subject:    &idToken.Subject,
+	})
+	if err != nil {
+		logger.Error("failed to get customer identity", "err", err)
+		return nil, fmt.Errorf("failed to get customer identity: %w", err)
+	}
+	if identity != nil {
+		customer, err := s.storages.Customer.GetCustomer(GetCustomerFilter{ID: &identity.CustomerID})
+		if err != nil {
+			logger.Error("failed to get customer", "err", err)
+			return nil, fmt.Errorf("failed to get customer: %w", err)
+		}
+		if customer == nil {
+			logger.Info("linked customer not found")
+			return nil, ErrLoginCustomerWithOIDCCustomerNotFound
+		}
+
+		logger.Info("got customer by linked identity")
+		return customer, nil
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		logger.Info("email is not verified")
+		return nil, ErrLoginCustomerWithOIDCEmailNotVerified
+	}
+	logger = logger.With("email", idToken.Email)
+
+	vendorAPI := s.apis.VendorAPI.WithStore(store)
+	vendorCustomerID, err := vendorAPI.GetCustomerIDByEmail(ctx, idToken.Email)
+	if err != nil {
+		logger.Error("failed to get vendor customer by email", "err", err)
+		return nil, fmt.Errorf("failed to get vendor customer by email: %w", err)
+	}
+	if vendorCustomerID == "" {
+		vendorCustomerID, err = vendorAPI.CreateCustomer(ctx, CreateVendorCustomerOptions{
+			Email:     idToken.Email,
+			FirstName: idToken.GivenName,
+			LastName:  idToken.FamilyName,
+		})
+		if err != nil {
+			logger.Error("failed to create vendor customer", "err", err)
+			return nil, fmt.Errorf("failed to create vendor customer: %w", err)
+		}
+		logger.Debug("created vendor customer", "vendorCustomerID", vendorCustomerID)
+	}
+
+	customer, err := s.getOrCreateCustomer(ctx, store, vendorCustomerID)
+	if err != nil {
+		logger.Error("failed to get or create customer", "err", err)
+		return nil, fmt.Errorf("failed to get or create customer: %w", err)
+	}
+
+	identity, err = s.storages.CustomerIdentity.CreateCustomerIdentity(&entity.CustomerIdentity{
+		CustomerID: customer.ID,
+		ProviderID: provider.ID,
+		Subject:    idToken.Subject,
+		Email:      idToken.Email,
+	})
+	if err != nil {
+		logger.Error("failed to create customer identity", "err", err)
+		return nil, fmt.Errorf("failed to create customer identity: %w", err)
+	}
+	logger.Debug("linked identity", "identity", identity)
+
+	logger.Info("got customer by verified email")
+	return customer, nil
+}
+
+func (s *customerService) oidcRedirectURL(providerName string) string {
+	return fmt.Sprintf("%s/customers/oidc/%s/callback", s.cfg.App.BaseURL, providerName)
+}
+
+// oidcStateIssuer differs from access tokens issuer so state can't be used as an access token and vice versa.
+func (s *customerService) oidcStateIssuer() string {
+	return s.cfg.Auth.TokenIssuer + "/oidc-state"
+}
+
+// isStoreURL checks that URL points to the store domain.
+func isStoreURL(store *entity.Store, rawURL string) bool {
+	origin := "https://" + store.VendorID
+	return rawURL == origin || strings.HasPrefix(rawURL, origin+"/")
+}
+
+func generateNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,154 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// stateOIDCAPI rejects every code, it records whether the code was exchanged at all.
+type stateOIDCAPI struct {
+	exchanged bool
+}
+
+func (f *stateOIDCAPI) GetAuthorizationURL(_ *entity.OIDCProvider, opts service.GetOIDCAuthorizationURLOptions) (string, error) {
+	return "https://accounts.example.com/authorize?" + url.Values{"state": {opts.State}}.Encode(), nil
+}
+
+func (f *stateOIDCAPI) ExchangeCode(context.Context, *entity.OIDCProvider, service.ExchangeOIDCCodeOptions) (*service.OIDCIDTokenClaims, error) {
+	f.exchanged = true
+	return nil, service.ErrLoginCustomerWithOIDCInvalidCode
+}
+
+type oidcProviderStorage struct {
+	provider *entity.OIDCProvider
+}
+
+func (f *oidcProviderStorage) GetOIDCProvider(service.GetOIDCProviderFilter) (*entity.OIDCProvider, error) {
+	return f.provider, nil
+}
+
+// failedLoginAttemptStorage counts failed attempts by key, nothing is locked.
+type failedLoginAttemptStorage struct {
+	memoryLoginAttemptStorage
+	failures map[string]int
+}
+
+func (f *failedLoginAttemptStorage) RegisterFailedLoginAttempt(key string, _ time.Time) (*entity.LoginAttempt, error) {
+	f.failures[key]++
+	return &entity.LoginAttempt{Key: key, Failures: f.failures[key]}, nil
+}
+
+func TestLoginCustomerWithOIDCState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Auth.TokenIssuer = "API"
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.LoginProtection.MaxFailedAttemptsPerIP = 10
+
+	store := &entity.Store{ID: "store", VendorID: "test.myshopify.com"}
+	provider := &entity.OIDCProvider{ID: "provider", StoreID: store.ID, Name: "google"}
+
+	// startLogin starts a login in a new browser and returns the state passed to the provider with the state cookie
+	startLogin := func(t *testing.T, customerService service.CustomerService) (string, *http.Cookie) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/customers/oidc/google/authorize", nil)
+
+		authorizationURL, err := customerService.StartOIDCLogin(c, service.StartOIDCLoginOptions{
+			StoreVendorID: store.VendorID,
+			ProviderName:  provider.Name,
+		})
+		require.NoError(t, err)
+		parsed, err := url.Parse(authorizationURL)
+		require.NoError(t, err)
+
+		cookies := recorder.Result().Cookies()
+		require.Len(t, cookies, 1)
+		return parsed.Query().Get("state"), cookies[0]
+	}
+
+	testCases := []struct {
+		name string
+		// cookie returns the cookie sent to the callback along with the state of the started login
+		cookie            func(t *testing.T, customerService service.CustomerService, cookie *http.Cookie) *http.Cookie
+		expectedError     error
+		expectedExchanged bool
+	}{
+		{
+			name: "positive: state of the same browser is accepted",
+			cookie: func(_ *testing.T, _ service.CustomerService, cookie *http.Cookie) *http.Cookie {
+				return cookie
+			},
+			expectedError:     service.ErrLoginCustomerWithOIDCInvalidCode,
+			expectedExchanged: true,
+		},
+		{
+			name: "negative: state without the cookie",
+			cookie: func(*testing.T, service.CustomerService, *http.Cookie) *http.Cookie {
+				return nil
+			},
+			expectedError: service.ErrLoginCustomerWithOIDCInvalidState,
+		},
+		{
+			name: "negative: state of another browser",
+			cookie: func(t *testing.T, customerService service.CustomerService, _ *http.Cookie) *http.Cookie {
+				_, cookie := startLogin(t, customerService)
+				return cookie
+			},
+			expectedError: service.ErrLoginCustomerWithOIDCInvalidState,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oidcAPI := &stateOIDCAPI{}
+			attempts := &failedLoginAttemptStorage{failures: map[string]int{}}
+			customerService := service.NewCustomerService(service.Options{
+				APIs: service.APIs{OIDC: oidcAPI},
+				Storages: service.Storages{
+					Store:        &passwordStoreStorage{store: store},
+					OIDCProvider: &oidcProviderStorage{provider: provider},
+					LoginAttempt: attempts,
+				},
+				Config: cfg,
+				Logger: logging.NewZapLogger("error"),
+			})
+
+			state, cookie := startLogin(t, customerService)
+			// the attacker's state is replayed in the victim's browser
+			callbackCookie := tc.cookie(t, customerService, cookie)
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/customers/oidc/google/callback", nil)
+			if callbackCookie != nil {
+				c.Request.AddCookie(callbackCookie)
+			}
+
+			_, err := customerService.LoginCustomerWithOIDC(c, service.LoginCustomerWithOIDCOptions{
+				ProviderName: provider.Name,
+				Code:         "code",
+				State:        state,
+				ClientIP:     "10.0.0.1",
+			})
+			assert.Equal(t, tc.expectedError, err)
+			assert.Equal(t, tc.expectedExchanged, oidcAPI.exchanged)
+			// failed callbacks count towards the client lockout
+			assert.Equal(t, map[string]int{"ip:10.0.0.1": 1}, attempts.failures)
+		})
+	}
+}
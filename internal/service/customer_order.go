@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+func (s *customerService) ListCustomerOrders(ctx context.Context, opts ListCustomerOrdersOptions) (*OrdersPage, error) {
+	logger := s.logger.
+		Named("ListCustomerOrders").
+		WithContext(ctx).
+		With("opts", opts)
+
+	customer, store, err := s.getCustomerAndStore(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get customer and store", "err", err)
+		return nil, fmt.Errorf("failed to get customer and store: %w", err)
+	}
+
+	first := opts.First
+	if first <= 0 {
+		first = DefaultCustomerOrdersPageSize
+	}
+	if first > MaxCustomerOrdersPageSize {
+		first = MaxCustomerOrdersPageSize
+	}
+
+	// orders are queried by the vendor customer id of the token owner, so the page can't contain other customer orders
+	page, err := s.apis.VendorAPI.WithStore(store).GetCustomerOrders(ctx, GetVendorCustomerOrdersOptions{
+		VendorCustomerID: customer.VendorCustomerID,
+		First:            first,
+		After:            opts.After,
+	})
+	if err != nil {
+		logger.Error("failed to get customer orders from vendor", "err", err)
+		return nil, fmt.Errorf("failed to get customer orders from vendor: %w", err)
+	}
+
+	logger.Info("successfully listed customer orders", "count", len(page.Orders))
+	return page, nil
+}
+
+func (s *customerService) GetCustomerOrder(ctx context.Context, opts GetCustomerOrderOptions) (*entity.Order, error) {
+	logger := s.logger.
+		Named("GetCustomerOrder").
+		WithContext(ctx).
+		With("opts", opts)
+
+	customer, store, err := s.getCustomerAndStore(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get customer and store", "err", err)
+		return nil, fmt.Errorf("failed to get customer and store: %w", err)
+	}
+
+	order, err := s.apis.VendorAPI.WithStore(store).GetOrder(ctx, opts.OrderID)
+	if err != nil {
+		logger.Error("failed to get order from vendor", "err", err)
+		return nil, fmt.Errorf("failed to get order from vendor: %w", err)
+	}
+	if order == nil {
+		logger.Info("order not found in vendor")
+		return nil, ErrCustomerOrderNotFound
+	}
+	// NOTE: orders of other customers are reported as not found, so order ids can't be probed
+	if order.CustomerID == "" || order.CustomerID != customer.VendorCustomerID {
+		logger.Info("order belongs to another customer", "orderCustomerID", order.CustomerID)
+		return nil, ErrCustomerOrderNotFound
+	}
+
+	logger.Info("successfully got customer order")
+	return order, nil
+}
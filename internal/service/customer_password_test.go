@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+	"github.com/taraslis453/shopify-customer-auth/pkg/secret"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// passwordVendorAPI accepts only the password of one vendor customer, other methods aren't implemented.
+type passwordVendorAPI struct {
+	service.VendorAPI
+	customer *entity.Customer
+	password string
+	// updated is set once the password is updated.
+	updated bool
+	// deletedTokens are the access tokens deleted in vendor.
+	deletedTokens []string
+}
+
+func (f *passwordVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *passwordVendorAPI) GetCustomerByVendorID(context.Context, string) (*entity.Customer, error) {
+	customer := *f.customer
+	return &customer, nil
+}
+
+func (f *passwordVendorAPI) GetLoggedInCustomerID(_ context.Context, opts service.LoginCustomerOptions) (*service.LoggedInVendorCustomer, error) {
+	if opts.Email != f.customer.Email || opts.Password != f.password {
+		return nil, service.ErrLoginCustomerInvalidEmailOrPassword
+	}
+	return &service.LoggedInVendorCustomer{
+		ID:                   f.customer.VendorCustomerID,
+		AccessToken:          "verification-token",
+		AccessTokenExpiresAt: time.Now().Add(24 * time.Hour),
+	}, nil
+}
+
+func (f *passwordVendorAPI) DeleteCustomerAccessToken(_ context.Context, accessToken string) error {
+	f.deletedTokens = append(f.deletedTokens, accessToken)
+	return nil
+}
+
+func (f *passwordVendorAPI) UpdateCustomer(context.Context, service.UpdateVendorCustomerOptions) (*service.UpdateVendorCustomerOutput, error) {
+	f.updated = true
+	return &service.UpdateVendorCustomerOutput{Customer: f.customer}, nil
+}
+
+type passwordCustomerStorage struct {
+	service.CustomerStorage
+	customer *entity.Customer
+}
+
+func (f *passwordCustomerStorage) GetCustomer(service.GetCustomerFilter) (*entity.Customer, error) {
+	customer := *f.customer
+	return &customer, nil
+}
+
+func (f *passwordCustomerStorage) Transaction(fn func(tx service.CustomerStorage) error) error {
+	return fn(f)
+}
+
+func (f *passwordCustomerStorage) UpdateCustomer(_ string, customer *entity.Customer) (*entity.Customer, error) {
+	return customer, nil
+}
+
+type passwordStoreStorage struct {
+	service.StoreStorage
+	store *entity.Store
+}
+
+func (f *passwordStoreStorage) GetStore(*string) (*entity.Store, error) {
+	return f.store, nil
+}
+
+func TestChangeCustomerPassword(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.TokenIssuer = "API"
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.Auth.AccessTokenLifetime = time.Hour
+	cfg.Auth.RefreshTokenLifetime = 24 * time.Hour
+	cfg.Auth.EncryptionKey = "encryption-key-of-32-characters!"
+	cfg.LoginProtection.MaxFailedAttemptsPerEmail = 5
+
+	vendorAccessToken, err := secret.Encrypt(cfg.Auth.EncryptionKey, "storefront-token")
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(7 * 24 * time.Hour)
+
+	testCases := []struct {
+		name            string
+		currentPassword string
+		expectedError   error
+		expectedUpdated bool
+		// expectedFailures are the failed login attempts registered by key
+		expectedFailures map[string]int
+		// expectedDeletedTokens are the vendor sessions of the password check deleted after it
+		expectedDeletedTokens []string
+	}{
+		{
+			name:                  "positive: valid current password",
+			currentPassword:       "old-password",
+			expectedUpdated:       true,
+			expectedFailures:      map[string]int{},
+			expectedDeletedTokens: []string{"verification-token"},
+		},
+		{
+			name:             "negative: invalid current password",
+			currentPassword:  "wrong-password",
+			expectedError:    service.ErrChangeCustomerPasswordInvalidCurrentPassword,
+			expectedFailures: map[string]int{"email:store:customer@example.com": 1},
+		},
+		{
+			name:             "negative: missing current password",
+			expectedError:    service.ErrChangeCustomerPasswordInvalidCurrentPassword,
+			expectedFailures: map[string]int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &entity.Store{ID: "store", VendorID: "test.myshopify.com"}
+			customer := &entity.Customer{
+				ID:                         "customer",
+				StoreID:                    store.ID,
+				VendorCustomerID:           "1001",
+				Email:                      "customer@example.com",
+				VendorAccessToken:          vendorAccessToken,
+				VendorAccessTokenExpiresAt: &expiresAt,
+			}
+			vendorAPI := &passwordVendorAPI{customer: customer, password: "old-password"}
+			attempts := &failedLoginAttemptStorage{failures: map[string]int{}}
+
+			customerService := service.NewCustomerService(service.Options{
+				APIs: service.APIs{VendorAPI: vendorAPI},
+				Storages: service.Storages{
+					Customer:     &passwordCustomerStorage{customer: customer},
+					Store:        &passwordStoreStorage{store: store},
+					LoginAttempt: attempts,
+				},
+				Config: cfg,
+				Logger: logging.NewZapLogger("error"),
+			})
+
+			accessToken, err := customerService.ChangeCustomerPassword(context.Background(), service.ChangeCustomerPasswordOptions{
+				ID:              customer.ID,
+				StoreVendorID:   store.VendorID,
+				CurrentPassword: tc.currentPassword,
+				Password:        "new-password",
+			})
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, accessToken)
+			}
+			assert.Equal(t, tc.expectedUpdated, vendorAPI.updated)
+			assert.Equal(t, tc.expectedFailures, attempts.failures)
+			assert.Equal(t, tc.expectedDeletedTokens, vendorAPI.deletedTokens)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+// syncCustomer handles customers/create and customers/update webhooks, customers/create creates the customer
+// if we don't hold it yet, customers/update touches only customers we hold, so an update delivered after
+// customers/delete or customers/redact doesn't bring the customer back. It refreshes the cached profile
+// and revokes sessions of the customer if it's disabled in vendor.
+func (s *webhookService) syncCustomer(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("syncCustomer").
+		WithContext(ctx).
+		With("vendorCustomerID", webhook.VendorCustomerID, "customerState", webhook.CustomerState)
+
+	if webhook.VendorCustomerID == "" {
+		logger.Info("webhook has no customer, skipping")
+		return nil
+	}
+
+	var customer *entity.Customer
+	var err error
+	if webhook.Topic == WebhookTopicCustomersUpdate {
+		customer, err = s.getWebhookCustomer(store, webhook)
+		if err != nil {
+			logger.Error("failed to get customer", "err", err)
+			return fmt.Errorf("failed to get customer: %w", err)
+		}
+		if customer == nil {
+			logger.Info("customer not found, skipping")
+			return nil
+		}
+	} else {
+		customer, err = s.storages.Customer.UpsertCustomer(&entity.Customer{
+			StoreID:          store.ID,
+			VendorCustomerID: webhook.VendorCustomerID,
+		})
+		if err != nil {
+			logger.Error("failed to upsert customer", "err", err)
+			return fmt.Errorf("failed to upsert customer: %w", err)
+		}
+	}
+	logger = logger.With("customerID", customer.ID)
+
+	if webhook.CustomerState == VendorCustomerStateDisabled && customer.RefreshToken != "" {
+		if err := s.storages.Customer.ClearCustomerSession(customer.ID); err != nil {
+			logger.Error("failed to clear customer session", "err", err)
+			return fmt.Errorf("failed to clear customer session: %w", err)
+		}
+		logger.Info("revoked sessions of disabled customer")
+	}
+
+	if err := s.refreshCachedCustomer(ctx, store, webhook.VendorCustomerID); err != nil {
+		logger.Error("failed to refresh cached customer", "err", err)
+		return fmt.Errorf("failed to refresh cached customer: %w", err)
+	}
+
+	logger.Info("successfully synced customer")
+	return nil
+}
+
+// deleteCustomer handles customers/delete webhook, the customer is deleted along with its sessions and identities.
+func (s *webhookService) deleteCustomer(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("deleteCustomer").
+		WithContext(ctx).
+		With("vendorCustomerID", webhook.VendorCustomerID)
+
+	customer, err := s.getWebhookCustomer(store, webhook)
+	if err != nil {
+		logger.Error("failed to get customer", "err", err)
+		return fmt.Errorf("failed to get customer: %w", err)
+	}
+	if customer != nil {
+		if err := s.storages.Customer.DeleteCustomer(customer.ID); err != nil {
+			logger.Error("failed to delete customer", "err", err)
+			return fmt.Errorf("failed to delete customer: %w", err)
+		}
+	}
+
+	if err := s.evictCachedCustomer(ctx, store.VendorID, webhook.VendorCustomerID); err != nil {
+		logger.Error("failed to evict cached customer", "err", err)
+		return fmt.Errorf("failed to evict cached customer: %w", err)
+	}
+
+	logger.Info("successfully deleted customer", "found", customer != nil)
+	return nil
+}
+
+// refreshCachedCustomer replaces the cached customer profile with the current one from vendor.
+// Webhook payloads lack metafields, so the profile is fetched instead of being cached from the payload.
+func (s *serviceContext) refreshCachedCustomer(ctx context.Context, store *entity.Store, vendorCustomerID string) error {
+	if err := s.evictCachedCustomer(ctx, store.VendorID, vendorCustomerID); err != nil {
+		return err
+	}
+	if s.customerCacheTTL(store) <= 0 {
+		return nil
+	}
+
+	// the entry is already evicted, so failing to fetch the profile only makes the next read slower
+	if _, err := s.getVendorCustomer(ctx, store, vendorCustomerID); err != nil {
+		s.logger.Named("refreshCachedCustomer").WithContext(ctx).Warn("failed to fetch customer", "err", err, "vendorCustomerID", vendorCustomerID)
+	}
+	return nil
+}
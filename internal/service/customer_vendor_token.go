@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+	"github.com/taraslis453/shopify-customer-auth/pkg/secret"
+)
+
+// vendorAccessTokenRenewBefore is how long before expiration the vendor access token is renewed.
+const vendorAccessTokenRenewBefore = 24 * time.Hour
+
+// renewVendorAccessTokensBatchSize is how many customers are loaded at once by RenewVendorAccessTokens.
+const renewVendorAccessTokensBatchSize = 100
+
+// vendorSessionData returns customer session fields storing encrypted vendor access token.
+func (s *customerService) vendorSessionData(accessToken string, expiresAt time.Time) (*entity.Customer, error) {
+	encrypted, err := secret.Encrypt(s.cfg.Auth.EncryptionKey, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt vendor access token: %w", err)
+	}
+
+	return &entity.Customer{
+		VendorAccessToken:          encrypted,
+		VendorAccessTokenExpiresAt: &expiresAt,
+	}, nil
+}
+
+// getVendorAccessToken returns vendor access token of the customer session if it's still valid,
+// the token is renewed in vendor when it's close to expiration.
+func (s *customerService) getVendorAccessToken(ctx context.Context, store *entity.Store, customer *entity.Customer) (string, error) {
+	logger := s.logger.
+		Named("getVendorAccessToken").
+		WithContext(ctx).
+		With("customerID", customer.ID)
+
+	if customer.VendorAccessToken == "" || customer.VendorAccessTokenExpiresAt == nil || customer.VendorAccessTokenExpiresAt.Before(time.Now()) {
+		logger.Info("vendor access token is missing or expired")
+		return "", ErrVendorSessionExpired
+	}
+
+	accessToken, err := secret.Decrypt(s.cfg.Auth.EncryptionKey, customer.VendorAccessToken)
+	if err != nil {
+		// e.g. the encryption key was rotated, the customer has to login again
+		logger.Warn("failed to decrypt vendor access token", "err", err)
+		return "", ErrVendorSessionExpired
+	}
+	if time.Until(*customer.VendorAccessTokenExpiresAt) > vendorAccessTokenRenewBefore {
+		return accessToken, nil
+	}
+
+	accessToken, err = s.renewVendorAccessToken(ctx, store, customer, accessToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to renew vendor access token", "err", err)
+		return "", fmt.Errorf("failed to renew vendor access token: %w", err)
+	}
+
+	return accessToken, nil
+}
+
+// renewVendorAccessToken renews given vendor access token of the customer in vendor,
+// saves the new token and returns it.
+func (s *customerService) renewVendorAccessToken(ctx context.Context, store *entity.Store, customer *entity.Customer, accessToken string) (string, error) {
+	logger := s.logger.
+		Named("renewVendorAccessToken").
+		WithContext(ctx).
+		With("customerID", customer.ID)
+
+	renewed, err := s.apis.VendorAPI.WithStore(store).RenewCustomerAccessToken(ctx, accessToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to renew vendor access token", "err", err)
+		return "", fmt.Errorf("failed to renew vendor access token: %w", err)
+	}
+
+	sessionData, err := s.vendorSessionData(renewed.AccessToken, renewed.ExpiresAt)
+	if err != nil {
+		logger.Error("failed to get vendor session data", "err", err)
+		return "", fmt.Errorf("failed to get vendor session data: %w", err)
+	}
+	_, err = s.storages.Customer.UpdateCustomer(customer.ID, sessionData)
+	if err != nil {
+		logger.Error("failed to update customer", "err", err)
+		return "", fmt.Errorf("failed to update customer: %w", err)
+	}
+	customer.VendorAccessToken = sessionData.VendorAccessToken
+	customer.VendorAccessTokenExpiresAt = sessionData.VendorAccessTokenExpiresAt
+
+	logger.Info("renewed vendor access token")
+	return renewed.AccessToken, nil
+}
+
+func (s *customerService) RenewVendorAccessTokens(ctx context.Context) error {
+	logger := s.logger.
+		Named("RenewVendorAccessTokens").
+		WithContext(ctx)
+
+	now := time.Now()
+	expiresBefore := now.Add(vendorAccessTokenRenewBefore)
+	stores := map[string]*entity.Store{}
+	renewedCount, failedCount := 0, 0
+
+	// customers are paginated by expiration time and id, renewed tokens move out of the window
+	// and failed ones are skipped until the next run. Tokens of ended sessions are left to expire.
+	expiresAfter, afterID := now, ""
+	for ctx.Err() == nil {
+		customers, err := s.storages.Customer.ListCustomers(ListCustomersFilter{
+			VendorAccessTokenExpiresAfter:  &expiresAfter,
+			AfterID:                        afterID,
+			VendorAccessTokenExpiresBefore: &expiresBefore,
+			RefreshTokenExpiresAfter:       &now,
+			Limit:                          renewVendorAccessTokensBatchSize,
+		})
+		if err != nil {
+			logger.Error("failed to list customers", "err", err)
+			return fmt.Errorf("failed to list customers: %w", err)
+		}
+
+		for i := range customers {
+			customer := &customers[i]
+			expiresAfter, afterID = *customer.VendorAccessTokenExpiresAt, customer.ID
+			if customer.VendorAccessToken == "" || customer.StoreID == "" {
+				continue
+			}
+
+			store, ok := stores[customer.StoreID]
+			if !ok {
+				store, err = s.storages.Store.GetStoreByID(customer.StoreID)
+				if err != nil {
+					logger.Error("failed to get store", "err", err)
+					return fmt.Errorf("failed to get store: %w", err)
+				}
+				stores[customer.StoreID] = store
+			}
+			if store == nil {
+				continue
+			}
+
+			// getVendorAccessToken renews tokens close to expiration
+			if _, err := s.getVendorAccessToken(ctx, store, customer); err != nil {
+				logger.Info("failed to renew vendor access token", "customerID", customer.ID, "err", err)
+				failedCount++
+				continue
+			}
+			renewedCount++
+		}
+
+		if len(customers) < renewVendorAccessTokensBatchSize {
+			break
+		}
+	}
+
+	logger.Info("renewed vendor access tokens", "renewed", renewedCount, "failed", failedCount)
+	return nil
+}
+
+func (s *customerService) ClearExpiredCustomerSessions(ctx context.Context) error {
+	logger := s.logger.
+		Named("ClearExpiredCustomerSessions").
+		WithContext(ctx)
+
+	cleared, err := s.storages.Customer.ClearExpiredCustomerSessions(time.Now())
+	if err != nil {
+		logger.Error("failed to clear expired customer sessions", "err", err)
+		return fmt.Errorf("failed to clear expired customer sessions: %w", err)
+	}
+
+	logger.Info("cleared expired customer sessions", "cleared", cleared)
+	return nil
+}
+
+func (s *customerService) GetStorefrontAccessToken(ctx context.Context, opts GetStorefrontAccessTokenOptions) (*VendorCustomerAccessToken, error) {
+	logger := s.logger.
+		Named("GetStorefrontAccessToken").
+		WithContext(ctx).
+		With("opts", opts)
+
+	customer, store, err := s.getCustomerAndStore(ctx, opts.ID, opts.StoreVendorID)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get customer and store", "err", err)
+		return nil, fmt.Errorf("failed to get customer and store: %w", err)
+	}
+
+	accessToken, err := s.getVendorAccessToken(ctx, store, customer)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to get vendor access token", "err", err)
+		return nil, fmt.Errorf("failed to get vendor access token: %w", err)
+	}
+
+	logger.Info("successfully got storefront access token")
+	return &VendorCustomerAccessToken{
+		AccessToken: accessToken,
+		ExpiresAt:   *customer.VendorAccessTokenExpiresAt,
+	}, nil
+}
+
+func (s *customerService) LogoutCustomer(ctx context.Context, opts LogoutCustomerOptions) error {
+	logger := s.logger.
+		Named("LogoutCustomer").
+		WithContext(ctx).
+		With("opts", opts)
+
+	customer, err := s.storages.Customer.GetCustomer(GetCustomerFilter{ID: &opts.ID})
+	if err != nil {
+		logger.Error("failed to get customer", "err", err)
+		return fmt.Errorf("failed to get customer: %w", err)
+	}
+	if customer == nil {
+		logger.Info("customer not found")
+		return ErrCustomerNotFound
+	}
+
+	// vendor token is revoked on a best-effort basis, it expires anyway and must not block the logout
+	if err := s.deleteVendorAccessToken(ctx, customer); err != nil {
+		logger.Warn("failed to delete vendor access token", "err", err)
+	}
+
+	if err := s.storages.Customer.ClearCustomerSession(customer.ID); err != nil {
+		logger.Error("failed to clear customer session", "err", err)
+		return fmt.Errorf("failed to clear customer session: %w", err)
+	}
+
+	logger.Info("customer logged out")
+	return nil
+}
+
+// deleteVendorAccessToken revokes vendor access token of the customer session in vendor.
+func (s *customerService) deleteVendorAccessToken(ctx context.Context, customer *entity.Customer) error {
+	if customer.VendorAccessToken == "" || customer.StoreID == "" {
+		return nil
+	}
+	if customer.VendorAccessTokenExpiresAt != nil && customer.VendorAccessTokenExpiresAt.Before(time.Now()) {
+		return nil
+	}
+
+	store, err := s.storages.Store.GetStoreByID(customer.StoreID)
+	if err != nil {
+		return fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		return nil
+	}
+
+	accessToken, err := secret.Decrypt(s.cfg.Auth.EncryptionKey, customer.VendorAccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt vendor access token: %w", err)
+	}
+
+	if err := s.apis.VendorAPI.WithStore(store).DeleteCustomerAccessToken(ctx, accessToken); err != nil {
+		return fmt.Errorf("failed to delete vendor access token: %w", err)
+	}
+
+	return nil
+}
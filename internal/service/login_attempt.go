@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+// RetryAfterDetails is attached to errors of requests that can be retried later.
+type RetryAfterDetails struct {
+	// RetryAfter is a number of seconds to wait before retrying.
+	RetryAfter int `json:"retryAfter"`
+}
+
+// NewRetryAfterDetails rounds given duration up to whole seconds.
+func NewRetryAfterDetails(d time.Duration) RetryAfterDetails {
+	return RetryAfterDetails{RetryAfter: int(math.Ceil(d.Seconds()))}
+}
+
+func loginAttemptEmailKey(storeID, email string) string {
+	return fmt.Sprintf("email:%s:%s", storeID, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// loginAttemptIPKey keys IPv6 clients by their /64 network, a single client usually owns the whole one
+// and could rotate addresses within it to bypass the lockout.
+func loginAttemptIPKey(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.Is6() && !addr.Is4In6() {
+		prefix, _ := addr.Prefix(64)
+		return "ip:" + prefix.String()
+	}
+	return "ip:" + ip
+}
+
+// loginAttemptStoreKey is used to stop forwarding logins to a store throttled by vendor.
+func loginAttemptStoreKey(storeID string) string {
+	return "store:" + storeID
+}
+
+// checkLoginAttempts returns ErrLoginCustomerTooManyAttempts with RetryAfterDetails if any of the keys is locked.
+func (s *customerService) checkLoginAttempts(ctx context.Context, keys ...string) error {
+	logger := s.logger.
+		Named("checkLoginAttempts").
+		WithContext(ctx).
+		With("keys", keys)
+
+	attempts, err := s.storages.LoginAttempt.GetLoginAttempts(keys)
+	if err != nil {
+		logger.Error("failed to get login attempts", "err", err)
+		return fmt.Errorf("failed to get login attempts: %w", err)
+	}
+
+	var retryAfter time.Duration
+	for _, attempt := range attempts {
+		if attempt.LockedUntil == nil {
+			continue
+		}
+		if d := time.Until(*attempt.LockedUntil); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	if retryAfter > 0 {
+		logger.Info("login is locked", "retryAfter", retryAfter)
+		return errs.WithDetails(ErrLoginCustomerTooManyAttempts, NewRetryAfterDetails(retryAfter))
+	}
+
+	return nil
+}
+
+// registerFailedLoginAttempt counts failure and locks the key for a progressive delay
+// (if enabled) or for the lockout duration once maxFailures is reached.
+func (s *customerService) registerFailedLoginAttempt(ctx context.Context, key string, maxFailures int, progressive bool) error {
+	logger := s.logger.
+		Named("registerFailedLoginAttempt").
+		WithContext(ctx).
+		With("key", key)
+
+	cfg := s.cfg.LoginProtection
+	attempt, err := s.storages.LoginAttempt.RegisterFailedLoginAttempt(key, time.Now().Add(-cfg.FailedAttemptsWindow))
+	if err != nil {
+		logger.Error("failed to register failed login attempt", "err", err)
+		return fmt.Errorf("failed to register failed login attempt: %w", err)
+	}
+	logger = logger.With("failures", attempt.Failures)
+
+	var delay time.Duration
+	switch {
+	case attempt.Failures >= maxFailures:
+		delay = cfg.LockoutDuration
+	case progressive:
+		// 1x, 2x, 4x... of the base delay but never longer than the lockout
+		delay = cfg.LockoutDuration
+		if shift := attempt.Failures - 1; shift < 30 && cfg.ProgressiveDelay<<shift < delay {
+			delay = cfg.ProgressiveDelay << shift
+		}
+	}
+	if delay <= 0 {
+		logger.Debug("failed login attempt registered")
+		return nil
+	}
+
+	err = s.storages.LoginAttempt.LockLoginAttempt(key, time.Now().Add(delay))
+	if err != nil {
+		logger.Error("failed to lock login attempt", "err", err)
+		return fmt.Errorf("failed to lock login attempt: %w", err)
+	}
+
+	logger.Info("login locked", "delay", delay)
+	return nil
+}
+
+func (s *customerService) DeleteExpiredLoginAttempts(ctx context.Context) error {
+	logger := s.logger.
+		Named("DeleteExpiredLoginAttempts").
+		WithContext(ctx)
+
+	now := time.Now()
+	deleted, err := s.storages.LoginAttempt.DeleteExpiredLoginAttempts(now.Add(-s.cfg.LoginProtection.FailedAttemptsWindow), now)
+	if err != nil {
+		logger.Error("failed to delete expired login attempts", "err", err)
+		return fmt.Errorf("failed to delete expired login attempts: %w", err)
+	}
+
+	logger.Info("deleted expired login attempts", "deleted", deleted)
+	return nil
+}
+
+// lockThrottledStoreLogins locks logins of the store until vendor stops throttling them,
+// err is the vendor throttled error with RetryAfterDetails.
+func (s *customerService) lockThrottledStoreLogins(store *entity.Store, err error) error {
+	details, _ := errs.GetDetails(err).(RetryAfterDetails)
+	retryAfter := time.Duration(details.RetryAfter) * time.Second
+	if err := s.storages.LoginAttempt.LockLoginAttempt(loginAttemptStoreKey(store.ID), time.Now().Add(retryAfter)); err != nil {
+		return fmt.Errorf("failed to lock store login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+type rateLimitService struct {
+	serviceContext
+}
+
+var _ RateLimitService = (*rateLimitService)(nil)
+
+func NewRateLimitService(options Options) *rateLimitService {
+	return &rateLimitService{
+		serviceContext: serviceContext{
+			apis:       options.APIs,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("RateLimit"),
+			storages:   options.Storages,
+			background: options.Background,
+		},
+	}
+}
+
+func (s *rateLimitService) TakeRateLimitToken(ctx context.Context, opts TakeRateLimitTokenOptions) (ratelimit.Result, error) {
+	logger := s.logger.
+		Named("TakeRateLimitToken").
+		WithContext(ctx).
+		With("opts", opts)
+
+	// store vendor id comes from the client, so only existing stores get their own buckets,
+	// otherwise rotating it would bypass the limit
+	var store *entity.Store
+	if opts.StoreVendorID != "" {
+		var err error
+		store, err = s.storages.Store.GetStore(&opts.StoreVendorID)
+		if err != nil {
+			logger.Error("failed to get store", "err", err)
+			return ratelimit.Result{}, fmt.Errorf("failed to get store: %w", err)
+		}
+	}
+
+	limit, err := s.getLimit(opts.Group, store)
+	if err != nil {
+		logger.Error("failed to get limit", "err", err)
+		return ratelimit.Result{}, fmt.Errorf("failed to get limit: %w", err)
+	}
+	if limit.IsZero() {
+		logger.Debug("group is not limited")
+		return ratelimit.Result{Allowed: true}, nil
+	}
+	logger = logger.With("limit", limit)
+
+	var storeID string
+	if store != nil {
+		storeID = store.ID
+	}
+	key := fmt.Sprintf("%s:%s:%s", opts.Group, storeID, opts.Key)
+	result, err := s.storages.RateLimit.TakeRateLimitToken(key, limit)
+	if err != nil {
+		logger.Error("failed to take rate limit token", "err", err)
+		return ratelimit.Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	logger.Debug("took rate limit token", "result", result)
+	return result, nil
+}
+
+// getLimit returns store limit of the group if it's configured and default one otherwise.
+func (s *rateLimitService) DeleteFullRateLimitBuckets(ctx context.Context) error {
+	logger := s.logger.
+		Named("DeleteFullRateLimitBuckets").
+		WithContext(ctx)
+
+	deleted, err := s.storages.RateLimit.DeleteFullRateLimitBuckets(time.Now())
+	if err != nil {
+		logger.Error("failed to delete full rate limit buckets", "err", err)
+		return fmt.Errorf("failed to delete full rate limit buckets: %w", err)
+	}
+
+	logger.Info("deleted full rate limit buckets", "deleted", deleted)
+	return nil
+}
+
+func (s *rateLimitService) getLimit(group string, store *entity.Store) (ratelimit.Limit, error) {
+	if store != nil && store.RateLimits != "" {
+		limit, ok, err := parseGroupLimit(store.RateLimits, group)
+		if err != nil {
+			return ratelimit.Limit{}, fmt.Errorf("invalid store rate limits: %w", err)
+		}
+		if ok {
+			return limit, nil
+		}
+	}
+
+	var defaultLimit string
+	switch group {
+	case RateLimitGroupLogin:
+		defaultLimit = s.cfg.RateLimit.Login
+	case RateLimitGroupCustomer:
+		defaultLimit = s.cfg.RateLimit.Customer
+	case RateLimitGroupVendor:
+		defaultLimit = s.cfg.RateLimit.Vendor
+	}
+	if defaultLimit == "" {
+		return ratelimit.Limit{}, nil
+	}
+
+	return ratelimit.ParseLimit(defaultLimit)
+}
+
+// parseGroupLimit finds group limit in "group=limit,group=limit" list.
+func parseGroupLimit(limits, group string) (ratelimit.Limit, bool, error) {
+	for _, item := range strings.Split(limits, ",") {
+		name, value, found := strings.Cut(item, "=")
+		if !found {
+			return ratelimit.Limit{}, false, fmt.Errorf("invalid group limit %q", item)
+		}
+		if strings.TrimSpace(name) != group {
+			continue
+		}
+
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return ratelimit.Limit{}, false, err
+		}
+		return limit, true, nil
+	}
+
+	return ratelimit.Limit{}, false, nil
+}
@@ -2,26 +2,37 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/background"
 	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
 	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
 
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 )
 
 type Services struct {
-	Customer CustomerService
-	Vendor   VendorService
+	Customer  CustomerService
+	Vendor    VendorService
+	RateLimit RateLimitService
+	Webhook   WebhookService
+	// CustomerImport imports existing vendor customers of stores.
+	CustomerImport CustomerImportService
+	// Store manages stores on behalf of admins.
+	Store StoreService
 }
 
 // serviceContext provides a shared context for all services
 type serviceContext struct {
-	storages Storages
-	cfg      *config.Config
-	logger   logging.Logger
-	apis     APIs
+	storages   Storages
+	cfg        *config.Config
+	logger     logging.Logger
+	apis       APIs
+	background *background.Group
 }
 
 // Options is used to parameterize service
@@ -30,11 +41,22 @@ type Options struct {
 	Storages Storages
 	Config   *config.Config
 	Logger   logging.Logger
+	// Background runs tasks which outlive requests, e.g. webhook handling.
+	Background *background.Group
 }
 
 const (
 	customerInvalidEmailOrPasswordErrCode = "invalid_email_or_password"
 	customerNotFoundErrCode               = "customer_not_found"
+	tooManyAttemptsErrCode                = "too_many_attempts"
+	vendorThrottledErrCode                = "vendor_throttled"
+	captchaVerificationFailedErrCode      = "captcha_verification_failed"
+	vendorSessionExpiredErrCode           = "vendor_session_expired"
+	invalidFieldsErrCode                  = "invalid_fields"
+	unknownFieldsErrCode                  = "unknown_fields"
+	addressNotFoundErrCode                = "address_not_found"
+	orderNotFoundErrCode                  = "order_not_found"
+	invalidCurrentPasswordErrCode         = "invalid_current_password"
 
 	invalidTokenErrCode = "invalid_token"
 	tokenExpiredErrCode = "token_expired"
@@ -42,6 +64,31 @@ const (
 	vendorIdNotFoundErrCode = "vendor_id_not_found"
 
 	storeNotFoundErrCode = "store_not_found"
+
+	customerDataExportNotFoundErrCode = "customer_data_export_not_found"
+
+	invalidInstallRequestErrCode   = "invalid_install_request"
+	invalidInstallStateErrCode     = "invalid_install_state"
+	invalidInstallHMACErrCode      = "invalid_install_hmac"
+	installTimestampExpiredErrCode = "install_timestamp_expired"
+	reauthorizationRequiredErrCode = "reauthorization_required"
+	invalidSessionTokenErrCode     = "invalid_session_token"
+
+	oidcProviderNotFoundErrCode = "oidc_provider_not_found"
+	invalidOIDCStateErrCode     = "invalid_oidc_state"
+	invalidOIDCCodeErrCode      = "invalid_oidc_code"
+	invalidIDTokenErrCode       = "invalid_id_token"
+	emailNotVerifiedErrCode     = "email_not_verified"
+	invalidReturnURLErrCode     = "invalid_return_url"
+
+	invalidWebhookErrCode          = "invalid_webhook"
+	invalidWebhookSignatureErrCode = "invalid_webhook_signature"
+
+	customerImportNotFoundErrCode = "customer_import_not_found"
+
+	invalidVendorIDErrCode         = "invalid_vendor_id"
+	storeAlreadyExistsErrCode      = "store_already_exists"
+	missingStoreCredentialsErrCode = "missing_store_credentials"
 )
 
 type CustomerService interface {
@@ -50,16 +97,61 @@ type CustomerService interface {
 	// VerifyCustomerAccessToken is used to verify the customer by given token and return verified customer entity.
 	VerifyCustomerAccessToken(ctx context.Context, token string) (*entity.Customer, error)
 	// RefreshCustomerAccessToken is used to verify refresh token and then generate a new access token.
-	RefreshCustomerAccessToken(ctx context.Context, tokenStr string) (string, error)
+	RefreshCustomerAccessToken(ctx context.Context, opts RefreshCustomerAccessTokenOptions) (string, error)
 	// GenerateCustomerTokens is used to generate a pair of access and refresh tokens.
-	GenerateCustomerTokens(ctx context.Context, userID string) (GenerateCustomerTokensOutput, error)
+	GenerateCustomerTokens(ctx context.Context, opts GenerateCustomerTokensOptions) (GenerateCustomerTokensOutput, error)
 	// GetCustomer is used to get customer by given id
 	GetCustomer(ctx context.Context, opts GetCustomerOptions) (*entity.Customer, error)
+	// StartOIDCLogin is used to get an upstream OIDC provider URL the customer should be redirected to,
+	// the login state is bound to the browser with a cookie.
+	StartOIDCLogin(c *gin.Context, opts StartOIDCLoginOptions) (string, error)
+	// LoginCustomerWithOIDC is used to login customer by upstream OIDC provider callback and return a new access token.
+	LoginCustomerWithOIDC(c *gin.Context, opts LoginCustomerWithOIDCOptions) (LoginCustomerWithOIDCOutput, error)
+	// UpdateCustomer is used to update customer profile in vendor and return updated customer.
+	UpdateCustomer(ctx context.Context, opts UpdateCustomerOptions) (*entity.Customer, error)
+	// ChangeCustomerPassword is used to change customer password in vendor and return a new access token.
+	ChangeCustomerPassword(ctx context.Context, opts ChangeCustomerPasswordOptions) (string, error)
+	// ListCustomerAddresses is used to get the address book of the customer.
+	ListCustomerAddresses(ctx context.Context, opts ListCustomerAddressesOptions) ([]entity.CustomerAddress, error)
+	// CreateCustomerAddress is used to add a new address to the address book of the customer.
+	CreateCustomerAddress(ctx context.Context, opts CreateCustomerAddressOptions) (*entity.CustomerAddress, error)
+	// UpdateCustomerAddress is used to update an address in the address book of the customer.
+	UpdateCustomerAddress(ctx context.Context, opts UpdateCustomerAddressOptions) (*entity.CustomerAddress, error)
+	// DeleteCustomerAddress is used to remove an address from the address book of the customer.
+	DeleteCustomerAddress(ctx context.Context, opts DeleteCustomerAddressOptions) error
+	// SetDefaultCustomerAddress is used to make an address the default address of the customer.
+	SetDefaultCustomerAddress(ctx context.Context, opts SetDefaultCustomerAddressOptions) error
+	// ListCustomerOrders is used to get a page of customer orders, newest first.
+	ListCustomerOrders(ctx context.Context, opts ListCustomerOrdersOptions) (*OrdersPage, error)
+	// GetCustomerOrder is used to get an order of the customer by given order id.
+	GetCustomerOrder(ctx context.Context, opts GetCustomerOrderOptions) (*entity.Order, error)
+	// GetStorefrontAccessToken is used to get a valid vendor storefront access token of the customer session.
+	GetStorefrontAccessToken(ctx context.Context, opts GetStorefrontAccessTokenOptions) (*VendorCustomerAccessToken, error)
+	// LogoutCustomer is used to end the customer session and revoke its vendor access token.
+	LogoutCustomer(ctx context.Context, opts LogoutCustomerOptions) error
+	// RenewVendorAccessTokens is used to renew vendor access tokens which are close to expiration
+	// of all customers with a live session.
+	RenewVendorAccessTokens(ctx context.Context) error
+	// DeleteExpiredCachedCustomers is used to remove expired customer profiles from the customer cache.
+	DeleteExpiredCachedCustomers(ctx context.Context) error
+	// ClearExpiredCustomerSessions is used to remove refresh tokens and vendor access tokens which are expired.
+	ClearExpiredCustomerSessions(ctx context.Context) error
+	// DeleteExpiredLoginAttempts is used to remove failed login attempts which are neither counted nor locked anymore.
+	DeleteExpiredLoginAttempts(ctx context.Context) error
 }
 
 var (
+	// ErrCaptchaRequired happens when endpoint is protected by CAPTCHA but response token is missing.
+	ErrCaptchaRequired = errs.New("captcha is required", captchaVerificationFailedErrCode)
+	// ErrCaptchaInvalid happens when CAPTCHA provider rejects response token.
+	ErrCaptchaInvalid = errs.New("invalid captcha", captchaVerificationFailedErrCode)
+
 	ErrLoginCustomerStoreNotFound          = errs.New("store not found", storeNotFoundErrCode)
 	ErrLoginCustomerInvalidEmailOrPassword = errs.New("invalid email or password", customerInvalidEmailOrPasswordErrCode)
+	// ErrLoginCustomerTooManyAttempts is returned with RetryAfterDetails when login is temporarily locked.
+	ErrLoginCustomerTooManyAttempts = errs.New("too many login attempts, try again later", tooManyAttemptsErrCode)
+	// ErrLoginCustomerVendorThrottled is returned by VendorAPI with RetryAfterDetails when vendor throttles login requests.
+	ErrLoginCustomerVendorThrottled = errs.New("too many login requests to the store, try again later", vendorThrottledErrCode)
 
 	ErrVerifyCustomerTokenInvalidToken     = errs.New("invalid authenticate token.", invalidTokenErrCode)
 	ErrVerifyCustomerTokenTokenExpired     = errs.New("authenticate token expired", tokenExpiredErrCode)
@@ -68,27 +160,213 @@ var (
 	ErrRefreshCustomerTokenInvalidToken     = errs.New("invalid refresh token", invalidTokenErrCode)
 	ErrRefreshCustomerTokenTokenExpired     = errs.New("refresh token expired", tokenExpiredErrCode)
 	ErrRefreshCustomerTokenCustomerNotFound = errs.New("customer not found", customerNotFoundErrCode)
+	ErrRefreshCustomerTokenStoreNotFound    = errs.New("store not found", storeNotFoundErrCode)
 
 	ErrGetCustomerCustomerNotFoundInStorage = errs.New("customer not found in storage", customerNotFoundErrCode)
 	ErrGetCustomerCustomerNotFoundInVendor  = errs.New("customer not found in vendor", customerNotFoundErrCode)
 	ErrGetCustomerStoreNotFound             = errs.New("store not found", storeNotFoundErrCode)
+	// ErrGetCustomerUnknownFields is returned with a list of unknown fields in details.
+	ErrGetCustomerUnknownFields = errs.New("unknown customer fields", unknownFieldsErrCode)
+
+	ErrStartOIDCLoginStoreNotFound        = errs.New("store not found", storeNotFoundErrCode)
+	ErrStartOIDCLoginProviderNotFound     = errs.New("oidc provider not found", oidcProviderNotFoundErrCode)
+	ErrStartOIDCLoginInvalidReturnURL     = errs.New("return url must belong to the store", invalidReturnURLErrCode)
+	ErrLoginCustomerWithOIDCInvalidState  = errs.New("invalid oidc state", invalidOIDCStateErrCode)
+	ErrLoginCustomerWithOIDCStoreNotFound = errs.New("store not found", storeNotFoundErrCode)
+	// ErrLoginCustomerWithOIDCProviderNotFound happens when provider was removed during the login.
+	ErrLoginCustomerWithOIDCProviderNotFound = errs.New("oidc provider not found", oidcProviderNotFoundErrCode)
+	// ErrLoginCustomerWithOIDCInvalidCode is returned by OIDCAPI when provider rejects the authorization code.
+	ErrLoginCustomerWithOIDCInvalidCode = errs.New("invalid authorization code", invalidOIDCCodeErrCode)
+	// ErrLoginCustomerWithOIDCInvalidIDToken is returned by OIDCAPI when id_token validation fails.
+	ErrLoginCustomerWithOIDCInvalidIDToken   = errs.New("invalid id token", invalidIDTokenErrCode)
+	ErrLoginCustomerWithOIDCEmailNotVerified = errs.New("email is not verified by the provider", emailNotVerifiedErrCode)
+	ErrLoginCustomerWithOIDCCustomerNotFound = errs.New("customer not found", customerNotFoundErrCode)
+
+	ErrCustomerNotFound = errs.New("customer not found", customerNotFoundErrCode)
+	ErrStoreNotFound    = errs.New("store not found", storeNotFoundErrCode)
+	// ErrVendorSessionExpired happens when customer has no valid vendor access token and has to login with password again.
+	ErrVendorSessionExpired = errs.New("store session expired, login with password again", vendorSessionExpiredErrCode)
+	// ErrUpdateCustomerInvalidFields is returned by VendorAPI with []FieldError details.
+	ErrUpdateCustomerInvalidFields = errs.New("invalid customer fields", invalidFieldsErrCode)
+	// ErrChangeCustomerPasswordInvalidCurrentPassword happens when the current password isn't accepted by vendor.
+	ErrChangeCustomerPasswordInvalidCurrentPassword = errs.New("invalid current password", invalidCurrentPasswordErrCode)
+	// ErrCustomerAddressInvalidFields is returned by VendorAPI with []FieldError details.
+	ErrCustomerAddressInvalidFields = errs.New("invalid address fields", invalidFieldsErrCode)
+	// ErrCustomerAddressNotFound is returned by VendorAPI when address doesn't belong to the customer.
+	ErrCustomerAddressNotFound = errs.New("address not found", addressNotFoundErrCode)
+	// ErrCustomerOrderNotFound happens when order doesn't exist or belongs to another customer.
+	ErrCustomerOrderNotFound = errs.New("order not found", orderNotFoundErrCode)
 )
 
 type LoginCustomerOptions struct {
 	Email         string
 	Password      string
 	StoreVendorID string
+	// ClientIP is the request remote address, X-Forwarded-For is only read from trusted proxies.
+	ClientIP     string
+	CaptchaToken string
 }
 
 type GetCustomerOptions struct {
 	ID            string
 	EmailAddress  string
 	StoreVendorID string
+	// Fields is a selection of CustomerProfileFields, all fields are returned if it's empty.
+	Fields []string
+}
+
+// Customer profile fields which can be selected in GetCustomerOptions.
+const (
+	CustomerProfileFieldID               = "id"
+	CustomerProfileFieldFirstName        = "firstName"
+	CustomerProfileFieldLastName         = "lastName"
+	CustomerProfileFieldEmail            = "email"
+	CustomerProfileFieldPhone            = "phone"
+	CustomerProfileFieldAcceptsMarketing = "acceptsMarketing"
+	CustomerProfileFieldTags             = "tags"
+	CustomerProfileFieldState            = "state"
+	CustomerProfileFieldVerifiedEmail    = "verifiedEmail"
+	CustomerProfileFieldDefaultAddress   = "defaultAddress"
+	CustomerProfileFieldNote             = "note"
+	CustomerProfileFieldMetafields       = "metafields"
+)
+
+// CustomerProfileFields contains all customer profile fields.
+var CustomerProfileFields = []string{
+	CustomerProfileFieldID,
+	CustomerProfileFieldFirstName,
+	CustomerProfileFieldLastName,
+	CustomerProfileFieldEmail,
+	CustomerProfileFieldPhone,
+	CustomerProfileFieldAcceptsMarketing,
+	CustomerProfileFieldTags,
+	CustomerProfileFieldState,
+	CustomerProfileFieldVerifiedEmail,
+	CustomerProfileFieldDefaultAddress,
+	CustomerProfileFieldNote,
+	CustomerProfileFieldMetafields,
+}
+
+type StartOIDCLoginOptions struct {
+	StoreVendorID string
+	ProviderName  string
+	// ReturnURL is an optional store page the customer is sent back to with the access token.
+	ReturnURL string
+	// CaptchaToken is required if store protects login with CAPTCHA.
+	CaptchaToken string
+	ClientIP     string
+}
+
+type LoginCustomerWithOIDCOptions struct {
+	ProviderName string
+	Code         string
+	State        string
+	// ClientIP is used to lock clients out after repeated failed callbacks.
+	ClientIP string
+}
+
+type LoginCustomerWithOIDCOutput struct {
+	AccessToken string
+	ReturnURL   string
+}
+
+type UpdateCustomerOptions struct {
+	ID            string
+	StoreVendorID string
+	// nil fields are not updated
+	FirstName        *string
+	LastName         *string
+	Phone            *string
+	AcceptsMarketing *bool
+}
+
+type ChangeCustomerPasswordOptions struct {
+	ID            string
+	StoreVendorID string
+	// CurrentPassword is checked in vendor, so a stolen access token isn't enough to take over the account.
+	CurrentPassword string
+	Password        string
+}
+
+type GetStorefrontAccessTokenOptions struct {
+	ID            string
+	StoreVendorID string
+}
+
+type LogoutCustomerOptions struct {
+	ID string
+}
+
+type ListCustomerAddressesOptions struct {
+	ID            string
+	StoreVendorID string
+}
+
+type CreateCustomerAddressOptions struct {
+	ID            string
+	StoreVendorID string
+	Address       entity.CustomerAddress
+	// Default makes the created address the default address of the customer.
+	Default bool
+}
+
+type UpdateCustomerAddressOptions struct {
+	ID            string
+	StoreVendorID string
+	AddressID     string
+	Address       entity.CustomerAddress
+}
+
+type DeleteCustomerAddressOptions struct {
+	ID            string
+	StoreVendorID string
+	AddressID     string
+}
+
+type SetDefaultCustomerAddressOptions struct {
+	ID            string
+	StoreVendorID string
+	AddressID     string
+}
+
+// Customer orders page size limits.
+const (
+	DefaultCustomerOrdersPageSize = 10
+	MaxCustomerOrdersPageSize     = 50
+)
+
+type ListCustomerOrdersOptions struct {
+	ID            string
+	StoreVendorID string
+	// First is a page size, DefaultCustomerOrdersPageSize is used if it's zero.
+	First int
+	// After is an EndCursor of the previous page.
+	After string
+}
+
+type GetCustomerOrderOptions struct {
+	ID            string
+	StoreVendorID string
+	OrderID       string
+}
+
+type RefreshCustomerAccessTokenOptions struct {
+	Token string
+	// StoreVendorID is used to resolve customer roles and scopes.
+	StoreVendorID string
+}
+
+type GenerateCustomerTokensOptions struct {
+	CustomerID string
+	// Roles and Scopes are embedded into access token claims.
+	Roles  []string
+	Scopes []string
 }
 
 type GenerateCustomerTokensOutput struct {
-	AccessToken  string
-	RefreshToken string
+	AccessToken           string
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
 }
 
 // VendorService provides business logic related to vendors.
@@ -97,6 +375,19 @@ type VendorService interface {
 	HandleInstall(c *gin.Context) (redirectURL string, err error)
 	// HandleRedirect handles an oauth2 redirect call for a vendor integration.
 	HandleRedirect(c *gin.Context) (string, error)
+	// HandleTokenExchange is used to install the embedded app to the store of the session token by exchanging it
+	// for store credentials, it's used instead of HandleInstall and HandleRedirect when vendor installs the app.
+	HandleTokenExchange(ctx context.Context, sessionToken string) error
+	// VerifySessionToken is used to verify a session token of the merchant staff user issued by vendor admin
+	// to the embedded app and return the store of the session.
+	VerifySessionToken(ctx context.Context, sessionToken string) (*VendorSession, error)
+}
+
+// VendorSession is a verified session of the merchant staff user in the embedded app.
+type VendorSession struct {
+	Store *entity.Store
+	// UserID is the vendor id of the staff user.
+	UserID string
 }
 
 var (
@@ -104,8 +395,201 @@ var (
 	ErrHandleInstallVendorIDNotFound = errs.New("vendor id not found", vendorIdNotFoundErrCode)
 	// ErrHandleInstallStoreNotFound happens when store is not found while handling install
 	ErrHandleInstallStoreNotFound = errs.New("store not found", storeNotFoundErrCode)
+	// ErrHandleInstallInvalidVendorID happens when install store domain is malformed.
+	ErrHandleInstallInvalidVendorID = errs.New("invalid vendor id", invalidVendorIDErrCode)
+	// ErrHandleInstallInvalidRequest is returned by VendorAPI when install query of a new store is malformed.
+	ErrHandleInstallInvalidRequest = errs.New("invalid install request", invalidInstallRequestErrCode)
+	// ErrHandleInstallInvalidHMAC is returned by VendorAPI when install of a new store isn't signed by the app credentials.
+	ErrHandleInstallInvalidHMAC = errs.New("invalid install request signature", invalidInstallHMACErrCode)
+	// ErrHandleInstallTimestampExpired is returned by VendorAPI when install timestamp is outside of the allowed skew.
+	ErrHandleInstallTimestampExpired = errs.New("install request timestamp expired", installTimestampExpiredErrCode)
 	// ErrHandleRedirectVendorIDNotFound is returned when vendor ID is not found.
 	ErrHandleRedirectVendorIDNotFound = errs.New("vendor id not found", vendorIdNotFoundErrCode)
 	// ErrHandleRedirectStoreNotFound happens when store is not found while handling redirect
 	ErrHandleRedirectStoreNotFound = errs.New("store not found", storeNotFoundErrCode)
+	// ErrHandleRedirectInvalidVendorID happens when redirect store domain is malformed.
+	ErrHandleRedirectInvalidVendorID = errs.New("invalid vendor id", invalidVendorIDErrCode)
+	// ErrHandleRedirectInvalidRequest is returned by VendorAPI when redirect query is malformed.
+	ErrHandleRedirectInvalidRequest = errs.New("invalid install redirect request", invalidInstallRequestErrCode)
+	// ErrHandleRedirectInvalidState happens when redirect state doesn't match the nonce issued by install for the store,
+	// e.g. the install was started in another browser, has expired or the redirect is replayed.
+	ErrHandleRedirectInvalidState = errs.New("invalid install state", invalidInstallStateErrCode)
+	// ErrHandleRedirectInvalidHMAC is returned by VendorAPI when redirect isn't signed by the store credentials.
+	ErrHandleRedirectInvalidHMAC = errs.New("invalid install redirect signature", invalidInstallHMACErrCode)
+	// ErrHandleRedirectReauthorizationRequired is returned with ReauthorizationRequiredDetails by HandleRedirect and
+	// HandleTokenExchange when the store didn't grant all required scopes, the merchant has to go through install again.
+	ErrHandleRedirectReauthorizationRequired = errs.New("reauthorization required", reauthorizationRequiredErrCode)
+	// ErrHandleRedirectTimestampExpired is returned by VendorAPI when redirect timestamp is outside of the allowed skew.
+	ErrHandleRedirectTimestampExpired = errs.New("install redirect timestamp expired", installTimestampExpiredErrCode)
+	// ErrHandleTokenExchangeStoreNotFound happens when the store of the session token isn't created by admins
+	// while the app isn't public or the store is disabled.
+	ErrHandleTokenExchangeStoreNotFound = errs.New("store not found", storeNotFoundErrCode)
+	// ErrVerifySessionTokenInvalid is returned when the session token is malformed, expired, isn't signed by
+	// the store credentials or its store isn't installed.
+	ErrVerifySessionTokenInvalid = errs.New("invalid session token", invalidSessionTokenErrCode)
+)
+
+// ReauthorizationRequiredDetails describes access scopes the store has to grant by going through install again.
+type ReauthorizationRequiredDetails struct {
+	MissingScopes []string `json:"missingScopes"`
+	InstallURL    string   `json:"installUrl"`
+}
+
+// RateLimitService provides request rate limiting.
+type RateLimitService interface {
+	// TakeRateLimitToken takes a token from the bucket of given key and returns the bucket state.
+	TakeRateLimitToken(ctx context.Context, opts TakeRateLimitTokenOptions) (ratelimit.Result, error)
+	// DeleteFullRateLimitBuckets is used to remove buckets which are full again, they are equal to new ones.
+	DeleteFullRateLimitBuckets(ctx context.Context) error
+}
+
+// Route groups with separately configured rate limits.
+const (
+	RateLimitGroupLogin    = "login"
+	RateLimitGroupCustomer = "customer"
+	RateLimitGroupVendor   = "vendor"
+)
+
+type TakeRateLimitTokenOptions struct {
+	Group string
+	// StoreVendorID is used to apply store limits, default limits are used if it's empty.
+	StoreVendorID string
+	// Key identifies the client, e.g. "ip:127.0.0.1".
+	Key string
+}
+
+// WebhookService handles vendor webhooks.
+type WebhookService interface {
+	// HandleWebhook verifies a vendor webhook signature and queues it to be handled in background,
+	// redeliveries of already received webhooks are skipped.
+	HandleWebhook(c *gin.Context) error
+	// ProcessWebhooks is used to retry due webhooks which failed to be handled and to delete expired ones
+	// along with expired customer data exports.
+	ProcessWebhooks(ctx context.Context) error
+}
+
+var (
+	// ErrHandleWebhookInvalidRequest is returned by VendorAPI when webhook headers or payload are malformed.
+	ErrHandleWebhookInvalidRequest = errs.New("invalid webhook request", invalidWebhookErrCode)
+	// ErrHandleWebhookInvalidSignature happens when webhook isn't signed by the store credentials.
+	ErrHandleWebhookInvalidSignature = errs.New("invalid webhook signature", invalidWebhookSignatureErrCode)
+)
+
+// CustomerImportService imports existing vendor customers of stores, so they exist before their first login.
+type CustomerImportService interface {
+	// StartCustomerImport is used to create an import of the store customers,
+	// an unfinished import of the store is returned instead of creating a new one.
+	StartCustomerImport(ctx context.Context, opts StartCustomerImportOptions) (*entity.CustomerImport, error)
+	// RunCustomerImport is used to run the import until it's finished, it's resumed from the saved progress.
+	RunCustomerImport(ctx context.Context, id string) (*entity.CustomerImport, error)
+	// GetCustomerImport is used to get the import by id.
+	GetCustomerImport(ctx context.Context, id string) (*entity.CustomerImport, error)
+	// ResumeCustomerImports is used to run all unfinished imports, e.g. interrupted by a restart,
+	// imports run by other replicas are skipped.
+	ResumeCustomerImports(ctx context.Context) error
+}
+
+type StartCustomerImportOptions struct {
+	StoreVendorID string
+}
+
+var (
+	ErrStartCustomerImportStoreNotFound = errs.New("store not found", storeNotFoundErrCode)
+	ErrCustomerImportNotFound           = errs.New("customer import not found", customerImportNotFoundErrCode)
+)
+
+// StoreService manages stores on behalf of admins, stores are returned with masked secrets.
+type StoreService interface {
+	// CreateStore is used to onboard a store, the app has to be installed to it by the install link afterwards.
+	CreateStore(ctx context.Context, opts CreateStoreOptions) (*entity.Store, error)
+	// ListStores is used to list stores.
+	ListStores(ctx context.Context, opts ListStoresOptions) ([]entity.Store, error)
+	// GetStore is used to get the store by id, disabled stores are returned too.
+	GetStore(ctx context.Context, id string) (*entity.Store, error)
+	// UpdateStore is used to update set fields of the store.
+	UpdateStore(ctx context.Context, opts UpdateStoreOptions) (*entity.Store, error)
+	// DisableStore is used to disable the store, its data is kept and customers can't use it until it's enabled.
+	DisableStore(ctx context.Context, id string) (*entity.Store, error)
+	// EnableStore is used to enable the disabled store.
+	EnableStore(ctx context.Context, id string) (*entity.Store, error)
+	// DeleteStore is used to permanently delete the store and all data related to it.
+	DeleteStore(ctx context.Context, id string) error
+	// GetStoreInstallURL is used to get the link the merchant opens to install the app to the store.
+	GetStoreInstallURL(ctx context.Context, id string) (string, error)
+	// BindUnboundCustomers is used to bind customers created before customers were bound to stores
+	// to the store if they exist in its vendor.
+	BindUnboundCustomers(ctx context.Context, id string) (*BindUnboundCustomersOutput, error)
+	// ListCustomerDataExports is used to list customer data exported for data requests of the store, the data
+	// itself isn't returned.
+	ListCustomerDataExports(ctx context.Context, id string) ([]entity.CustomerDataExport, error)
+	// GetCustomerDataExport is used to retrieve customer data exported for a data request to hand it to the merchant.
+	GetCustomerDataExport(ctx context.Context, opts GetCustomerDataExportOptions) (*CustomerDataExport, error)
+}
+
+type GetCustomerDataExportOptions struct {
+	StoreID string
+	ID      string
+}
+
+// CustomerDataExport is a decrypted entity.CustomerDataExport.
+type CustomerDataExport struct {
+	entity.CustomerDataExport
+	Data json.RawMessage `json:"data"`
+}
+
+type BindUnboundCustomersOutput struct {
+	// Bound is the number of customers bound to the store.
+	Bound int64 `json:"bound"`
+	// Unbound is the number of customers still left without the store.
+	Unbound int64 `json:"unbound"`
+}
+
+type CreateStoreOptions struct {
+	VendorID string
+	// ClientID and ClientSecret are empty for stores of the public app.
+	ClientID     string
+	ClientSecret string
+	StoreSettings
+}
+
+type ListStoresOptions struct {
+	WithDisabled bool
+}
+
+// UpdateStoreOptions contains the store fields to update, nil fields are kept as is.
+type UpdateStoreOptions struct {
+	ID                 string
+	ClientID           *string
+	ClientSecret       *string
+	RateLimits         *string
+	CaptchaProvider    *string
+	CaptchaSecretKey   *string
+	CaptchaEndpoints   *string
+	CustomerMetafields *string
+	CustomerTagClaims  *string
+	CustomerCacheTTL   *string
+	Scopes             *string
+}
+
+// StoreSettings are optional store fields, see entity.Store for their format.
+type StoreSettings struct {
+	Scopes             string
+	RateLimits         string
+	CaptchaProvider    string
+	CaptchaSecretKey   string
+	CaptchaEndpoints   string
+	CustomerMetafields string
+	CustomerTagClaims  string
+	CustomerCacheTTL   string
+}
+
+var (
+	// ErrCreateStoreInvalidVendorID happens when vendor id has invalid format, e.g. it isn't a myshopify.com domain.
+	ErrCreateStoreInvalidVendorID = errs.New("invalid vendor id", invalidVendorIDErrCode)
+	// ErrCreateStoreAlreadyExists happens when a store with the same vendor id exists, including disabled ones.
+	ErrCreateStoreAlreadyExists = errs.New("store already exists", storeAlreadyExistsErrCode)
+	// ErrCreateStoreMissingCredentials happens when store has no client id and secret and there is no public app configured.
+	ErrCreateStoreMissingCredentials = errs.New("store client id and secret are required", missingStoreCredentialsErrCode)
+	// ErrCustomerDataExportNotFound happens when the export doesn't exist, e.g. it expired or the customer was redacted.
+	ErrCustomerDataExportNotFound = errs.New("customer data export not found", customerDataExportNotFoundErrCode)
 )
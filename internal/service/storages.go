@@ -1,26 +1,223 @@
 package service
 
 import (
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 )
 
 type Storages struct {
-	Customer CustomerStorage
-	Store    StoreStorage
+	Customer         CustomerStorage
+	CustomerIdentity CustomerIdentityStorage
+	Store            StoreStorage
+	OIDCProvider     OIDCProviderStorage
+	LoginAttempt     LoginAttemptStorage
+	RateLimit        RateLimitStorage
+	ComplianceLog    ComplianceLogStorage
+	// CustomerDataExport holds customer data exported for data requests.
+	CustomerDataExport CustomerDataExportStorage
+	CustomerCache      CustomerCacheStorage
+	CustomerImport     CustomerImportStorage
+	WebhookEvent       WebhookEventStorage
 }
 
 type CustomerStorage interface {
 	GetCustomer(filter GetCustomerFilter) (*entity.Customer, error)
 	CreateCustomer(user *entity.Customer) (*entity.Customer, error)
+	// UpsertCustomer atomically creates the customer or returns the existing one with the same store and vendor id.
+	UpsertCustomer(customer *entity.Customer) (*entity.Customer, error)
+	// UpsertCustomers creates given customers skipping the ones which already exist.
+	UpsertCustomers(customers []entity.Customer) error
 	UpdateCustomer(id string, user *entity.Customer) (*entity.Customer, error)
+	// DeleteCustomer deletes customer along with its identities.
+	DeleteCustomer(id string) error
+	// ListCustomers returns customers ordered by vendor access token expiration.
+	ListCustomers(filter ListCustomersFilter) ([]entity.Customer, error)
+	// ClearCustomerSession removes refresh token and vendor access token of the customer.
+	ClearCustomerSession(id string) error
+	// ClearExpiredCustomerSessions removes sessions with refresh tokens expired before given time and
+	// vendor access tokens expired before it, it returns the number of updated customers.
+	ClearExpiredCustomerSessions(expiredBefore time.Time) (int64, error)
+	// ListUnboundCustomers returns customers created before customers were bound to stores ordered by id,
+	// afterID is a cursor.
+	ListUnboundCustomers(afterID string, limit int) ([]entity.Customer, error)
+	CountUnboundCustomers() (int64, error)
+	// BindCustomerStore binds the unbound customer to the store, it's merged into the customer of the store
+	// with the same vendor id if there is one.
+	BindCustomerStore(id, storeID string) error
+	// Transaction runs fn with the storage bound to a single transaction, it's rolled back if fn fails.
+	Transaction(fn func(tx CustomerStorage) error) error
 }
 
 type GetCustomerFilter struct {
-	ID               *string
+	ID *string
+	// StoreID should be set along with VendorCustomerID, vendor ids are unique only within a store.
+	StoreID          *string
 	VendorCustomerID *string
 }
 
+// ListCustomersFilter lists customers ordered by vendor access token expiration and id.
+type ListCustomersFilter struct {
+	// VendorAccessTokenExpiresAfter and AfterID are a cursor, customers expiring at the same time
+	// are listed after AfterID then.
+	VendorAccessTokenExpiresAfter  *time.Time
+	AfterID                        string
+	VendorAccessTokenExpiresBefore *time.Time
+	// RefreshTokenExpiresAfter lists only customers with a session live after given time.
+	RefreshTokenExpiresAfter *time.Time
+	// Limit is ignored if it's zero.
+	Limit int
+}
+
+type CustomerIdentityStorage interface {
+	GetCustomerIdentity(filter GetCustomerIdentityFilter) (*entity.CustomerIdentity, error)
+	CreateCustomerIdentity(identity *entity.CustomerIdentity) (*entity.CustomerIdentity, error)
+	ListCustomerIdentities(customerID string) ([]entity.CustomerIdentity, error)
+}
+
+type GetCustomerIdentityFilter struct {
+	ProviderID *string
+	Subject    *string
+}
+
 type StoreStorage interface {
+	CreateStore(store *entity.Store) (*entity.Store, error)
+	// CreateStoreIfNotExists creates the store unless a store with its vendor id exists (disabled ones too),
+	// false is returned then.
+	CreateStoreIfNotExists(store *entity.Store) (bool, error)
+	// GetStore and GetStoreByID return nil for disabled stores.
 	GetStore(vendorID *string) (*entity.Store, error)
+	GetStoreByID(id string) (*entity.Store, error)
+	// GetStoreByFilter returns the store matching all set filter fields.
+	GetStoreByFilter(filter GetStoreFilter) (*entity.Store, error)
+	// ListStores returns stores ordered by creation time.
+	ListStores(filter ListStoresFilter) ([]entity.Store, error)
 	UpdateStore(id string, store *entity.Store) (*entity.Store, error)
+	// UpdateStoreFields updates given fields of the store even if they are empty, disabled stores are updated too.
+	UpdateStoreFields(id string, store *entity.Store, fields []string) error
+	// DisableStore disables the store by admins, it isn't enabled by install.
+	DisableStore(id string) error
+	// EnableStore enables the store disabled by admins unless it's uninstalled too.
+	EnableStore(id string) error
+	// UninstallStore disables the store, removes its vendor tokens and revokes sessions of all its customers.
+	UninstallStore(id string) error
+	// ReinstallStore enables the uninstalled store unless it's disabled by admins too, the store fields are reset
+	// as well, so it can be saved with UpdateStore.
+	ReinstallStore(store *entity.Store) error
+	// PurgeStore permanently deletes the store and all data related to it, compliance logs are kept as audit records.
+	PurgeStore(store *entity.Store) error
+}
+
+type GetStoreFilter struct {
+	ID       *string
+	VendorID *string
+	// WithDisabled includes disabled stores.
+	WithDisabled bool
+}
+
+type ListStoresFilter struct {
+	// WithDisabled includes disabled stores.
+	WithDisabled bool
+}
+
+type OIDCProviderStorage interface {
+	GetOIDCProvider(filter GetOIDCProviderFilter) (*entity.OIDCProvider, error)
+}
+
+type GetOIDCProviderFilter struct {
+	StoreID *string
+	Name    *string
+}
+
+type LoginAttemptStorage interface {
+	GetLoginAttempts(keys []string) ([]entity.LoginAttempt, error)
+	// RegisterFailedLoginAttempt atomically increments failures counter of given key and returns the counted
+	// attempt, counter is restarted if previous failure happened before windowStart.
+	RegisterFailedLoginAttempt(key string, windowStart time.Time) (*entity.LoginAttempt, error)
+	// LockLoginAttempt locks given key until given time, a longer lock set concurrently is kept.
+	LockLoginAttempt(key string, until time.Time) error
+	DeleteLoginAttempt(key string) error
+	// DeleteExpiredLoginAttempts deletes attempts failed before failedBefore which aren't locked after lockedBefore
+	// and returns their number.
+	DeleteExpiredLoginAttempts(failedBefore, lockedBefore time.Time) (int64, error)
+}
+
+type RateLimitStorage interface {
+	// TakeRateLimitToken atomically takes a token from the bucket of given key.
+	TakeRateLimitToken(key string, limit ratelimit.Limit) (ratelimit.Result, error)
+	// DeleteFullRateLimitBuckets deletes buckets full before given time and returns their number.
+	DeleteFullRateLimitBuckets(fullBefore time.Time) (int64, error)
+}
+
+type ComplianceLogStorage interface {
+	CreateComplianceLog(log *entity.ComplianceLog) (*entity.ComplianceLog, error)
+}
+
+type CustomerDataExportStorage interface {
+	CreateCustomerDataExport(export *entity.CustomerDataExport) (*entity.CustomerDataExport, error)
+	GetCustomerDataExport(storeID, id string) (*entity.CustomerDataExport, error)
+	// ListCustomerDataExports returns exports of the store without their data ordered by creation time.
+	ListCustomerDataExports(storeID string) ([]entity.CustomerDataExport, error)
+	// DeleteCustomerDataExports deletes exports matching all set filter fields and returns their number.
+	DeleteCustomerDataExports(filter DeleteCustomerDataExportsFilter) (int64, error)
+}
+
+type DeleteCustomerDataExportsFilter struct {
+	StoreID          *string
+	VendorCustomerID *string
+	ExpiredBefore    *time.Time
+}
+
+type CustomerCacheStorage interface {
+	// GetCachedCustomer returns cached customer and whether the entry exists,
+	// nil customer of an existing entry means customer is missing in vendor.
+	GetCachedCustomer(key string) (*entity.Customer, bool, error)
+	// SetCachedCustomer caches customer for given ttl, nil customer is cached as missing.
+	SetCachedCustomer(key string, customer *entity.Customer, ttl time.Duration) error
+	DeleteCachedCustomer(key string) error
+	// DeleteExpiredCachedCustomers deletes entries expired before given time and returns their number.
+	DeleteExpiredCachedCustomers(expiredBefore time.Time) (int64, error)
+}
+
+type CustomerImportStorage interface {
+	CreateCustomerImport(customerImport *entity.CustomerImport) (*entity.CustomerImport, error)
+	GetCustomerImport(id string) (*entity.CustomerImport, error)
+	ListCustomerImports(filter ListCustomerImportsFilter) ([]entity.CustomerImport, error)
+	UpdateCustomerImport(id string, customerImport *entity.CustomerImport) (*entity.CustomerImport, error)
+	// ClaimCustomerImport atomically leases the unfinished import to owner until leaseUntil, false is returned
+	// if the import is finished or leased to another owner at now. The owner renews its lease by claiming it again.
+	ClaimCustomerImport(id, owner string, now, leaseUntil time.Time) (bool, error)
+	// ReleaseCustomerImport removes the lease of owner, so the import can be resumed at once.
+	ReleaseCustomerImport(id, owner string) error
+}
+
+type ListCustomerImportsFilter struct {
+	StoreID *string
+	// Statuses are matched if it's not empty.
+	Statuses []string
+}
+
+type WebhookEventStorage interface {
+	// CreateWebhookEvent creates the event unless an event with the same vendor webhook id exists,
+	// false is returned for such duplicates.
+	CreateWebhookEvent(event *entity.WebhookEvent) (bool, error)
+	GetWebhookEvent(id string) (*entity.WebhookEvent, error)
+	// ClaimWebhookEvent atomically moves next attempt of the pending event due at now to leaseUntil and counts
+	// the attempt, false is returned if the event isn't due (e.g. it's claimed by another replica).
+	ClaimWebhookEvent(id string, now, leaseUntil time.Time) (bool, error)
+	// ListWebhookEvents returns events ordered by creation time.
+	ListWebhookEvents(filter ListWebhookEventsFilter) ([]entity.WebhookEvent, error)
+	UpdateWebhookEvent(id string, event *entity.WebhookEvent) (*entity.WebhookEvent, error)
+	// DeleteWebhookEvents deletes processed and failed events created before given time.
+	DeleteWebhookEvents(createdBefore time.Time) (int64, error)
+}
+
+type ListWebhookEventsFilter struct {
+	// Statuses are matched if it's not empty.
+	Statuses []string
+	// DueBefore matches events with next attempt not later than given time.
+	DueBefore *time.Time
+	Limit     int
 }
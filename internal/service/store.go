@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/secret"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
+)
+
+var _ StoreService = (*storeService)(nil)
+
+type storeService struct {
+	serviceContext
+}
+
+func NewStoreService(options Options) *storeService {
+	return &storeService{
+		serviceContext: serviceContext{
+			storages:   options.Storages,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("storeService"),
+			apis:       options.APIs,
+			background: options.Background,
+		},
+	}
+}
+
+func (s *storeService) CreateStore(ctx context.Context, opts CreateStoreOptions) (*entity.Store, error) {
+	logger := s.logger.
+		Named("CreateStore").
+		WithContext(ctx).
+		With("vendorID", opts.VendorID)
+
+	domain, err := shopdomain.Parse(opts.VendorID)
+	if err != nil {
+		logger.Info("invalid vendor id", "err", err)
+		return nil, ErrCreateStoreInvalidVendorID
+	}
+	vendorID := domain.String()
+
+	if (opts.ClientID == "") != (opts.ClientSecret == "") || (opts.ClientID == "" && !s.isPublicApp()) {
+		logger.Info("missing store credentials")
+		return nil, ErrCreateStoreMissingCredentials
+	}
+
+	existing, err := s.storages.Store.GetStoreByFilter(GetStoreFilter{
+		VendorID:     &vendorID,
+		WithDisabled: true,
+	})
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if existing != nil {
+		logger.Info("store already exists", "storeID", existing.ID)
+		return nil, ErrCreateStoreAlreadyExists
+	}
+
+	store, err := s.storages.Store.CreateStore(&entity.Store{
+		VendorID:           vendorID,
+		Scopes:             opts.Scopes,
+		ClientID:           opts.ClientID,
+		ClientSecret:       opts.ClientSecret,
+		RateLimits:         opts.RateLimits,
+		CaptchaProvider:    opts.CaptchaProvider,
+		CaptchaSecretKey:   opts.CaptchaSecretKey,
+		CaptchaEndpoints:   opts.CaptchaEndpoints,
+		CustomerMetafields: opts.CustomerMetafields,
+		CustomerTagClaims:  opts.CustomerTagClaims,
+		CustomerCacheTTL:   opts.CustomerCacheTTL,
+	})
+	if err != nil {
+		logger.Error("failed to create store", "err", err)
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	logger.Info("successfully created store", "storeID", store.ID)
+	return s.presentStore(store), nil
+}
+
+func (s *storeService) ListStores(ctx context.Context, opts ListStoresOptions) ([]entity.Store, error) {
+	logger := s.logger.
+		Named("ListStores").
+		WithContext(ctx).
+		With("opts", opts)
+
+	stores, err := s.storages.Store.ListStores(ListStoresFilter{
+		WithDisabled: opts.WithDisabled,
+	})
+	if err != nil {
+		logger.Error("failed to list stores", "err", err)
+		return nil, fmt.Errorf("failed to list stores: %w", err)
+	}
+	for i := range stores {
+		stores[i] = *s.presentStore(&stores[i])
+	}
+
+	logger.Info("successfully listed stores", "count", len(stores))
+	return stores, nil
+}
+
+func (s *storeService) GetStore(ctx context.Context, id string) (*entity.Store, error) {
+	store, err := s.getStore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.presentStore(store), nil
+}
+
+func (s *storeService) UpdateStore(ctx context.Context, opts UpdateStoreOptions) (*entity.Store, error) {
+	logger := s.logger.
+		Named("UpdateStore").
+		WithContext(ctx).
+		With("id", opts.ID)
+
+	store, err := s.getStore(ctx, opts.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+	set := func(field string, value *string, target *string) {
+		if value == nil {
+			return
+		}
+		*target = *value
+		fields = append(fields, field)
+	}
+	set("ClientID", opts.ClientID, &store.ClientID)
+	set("ClientSecret", opts.ClientSecret, &store.ClientSecret)
+	set("RateLimits", opts.RateLimits, &store.RateLimits)
+	set("CaptchaProvider", opts.CaptchaProvider, &store.CaptchaProvider)
+	set("CaptchaSecretKey", opts.CaptchaSecretKey, &store.CaptchaSecretKey)
+	set("CaptchaEndpoints", opts.CaptchaEndpoints, &store.CaptchaEndpoints)
+	set("CustomerMetafields", opts.CustomerMetafields, &store.CustomerMetafields)
+	set("CustomerTagClaims", opts.CustomerTagClaims, &store.CustomerTagClaims)
+	set("CustomerCacheTTL", opts.CustomerCacheTTL, &store.CustomerCacheTTL)
+	set("Scopes", opts.Scopes, &store.Scopes)
+	logger = logger.With("fields", fields)
+
+	if err := s.storages.Store.UpdateStoreFields(store.ID, store, fields); err != nil {
+		logger.Error("failed to update store", "err", err)
+		return nil, fmt.Errorf("failed to update store: %w", err)
+	}
+
+	logger.Info("successfully updated store")
+	return s.presentStore(store), nil
+}
+
+func (s *storeService) DisableStore(ctx context.Context, id string) (*entity.Store, error) {
+	logger := s.logger.
+		Named("DisableStore").
+		WithContext(ctx).
+		With("id", id)
+
+	if _, err := s.getStore(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.storages.Store.DisableStore(id); err != nil {
+		logger.Error("failed to disable store", "err", err)
+		return nil, fmt.Errorf("failed to disable store: %w", err)
+	}
+
+	logger.Info("successfully disabled store")
+	return s.GetStore(ctx, id)
+}
+
+func (s *storeService) EnableStore(ctx context.Context, id string) (*entity.Store, error) {
+	logger := s.logger.
+		Named("EnableStore").
+		WithContext(ctx).
+		With("id", id)
+
+	if _, err := s.getStore(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := s.storages.Store.EnableStore(id); err != nil {
+		logger.Error("failed to enable store", "err", err)
+		return nil, fmt.Errorf("failed to enable store: %w", err)
+	}
+
+	logger.Info("successfully enabled store")
+	return s.GetStore(ctx, id)
+}
+
+func (s *storeService) DeleteStore(ctx context.Context, id string) error {
+	logger := s.logger.
+		Named("DeleteStore").
+		WithContext(ctx).
+		With("id", id)
+
+	store, err := s.getStore(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.storages.Store.PurgeStore(store); err != nil {
+		logger.Error("failed to purge store", "err", err)
+		return fmt.Errorf("failed to purge store: %w", err)
+	}
+
+	logger.Info("successfully deleted store", "vendorID", store.VendorID)
+	return nil
+}
+
+func (s *storeService) GetStoreInstallURL(ctx context.Context, id string) (string, error) {
+	logger := s.logger.
+		Named("GetStoreInstallURL").
+		WithContext(ctx).
+		With("id", id)
+
+	store, err := s.getStore(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	installURL := s.installURL(store.VendorID)
+
+	logger.Info("successfully got store install url", "installURL", installURL)
+	return installURL, nil
+}
+
+// presentStore returns the store with masked secrets and missing scopes, so admins see whether it has to be reinstalled.
+func (s *storeService) presentStore(store *entity.Store) *entity.Store {
+	presented := store.Masked()
+	presented.MissingScopes = store.GetMissingScopes(s.cfg.Shopify.Scopes)
+	return presented
+}
+
+// getStore returns unmasked store by id including disabled ones.
+// bindUnboundCustomersPageSize is the number of unbound customers checked in vendor at a time.
+const bindUnboundCustomersPageSize = 100
+
+func (s *storeService) BindUnboundCustomers(ctx context.Context, id string) (*BindUnboundCustomersOutput, error) {
+	logger := s.logger.
+		Named("BindUnboundCustomers").
+		WithContext(ctx).
+		With("id", id)
+
+	store, err := s.getStore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// vendor customer ids are unique across stores, so the customer found in the store vendor belongs to the store
+	output := &BindUnboundCustomersOutput{}
+	var afterID string
+	for {
+		customers, err := s.storages.Customer.ListUnboundCustomers(afterID, bindUnboundCustomersPageSize)
+		if err != nil {
+			logger.Error("failed to list unbound customers", "err", err)
+			return nil, fmt.Errorf("failed to list unbound customers: %w", err)
+		}
+
+		for _, customer := range customers {
+			vendorCustomer, err := s.apis.VendorAPI.WithStore(store).GetCustomerByVendorID(ctx, customer.VendorCustomerID)
+			if err != nil {
+				logger.Error("failed to get vendor customer", "err", err, "customerID", customer.ID)
+				return nil, fmt.Errorf("failed to get vendor customer: %w", err)
+			}
+			if vendorCustomer == nil {
+				continue
+			}
+
+			if err := s.storages.Customer.BindCustomerStore(customer.ID, store.ID); err != nil {
+				logger.Error("failed to bind customer store", "err", err, "customerID", customer.ID)
+				return nil, fmt.Errorf("failed to bind customer store: %w", err)
+			}
+			output.Bound++
+		}
+
+		if len(customers) < bindUnboundCustomersPageSize {
+			break
+		}
+		afterID = customers[len(customers)-1].ID
+	}
+
+	output.Unbound, err = s.storages.Customer.CountUnboundCustomers()
+	if err != nil {
+		logger.Error("failed to count unbound customers", "err", err)
+		return nil, fmt.Errorf("failed to count unbound customers: %w", err)
+	}
+
+	logger.Info("successfully bound unbound customers", "bound", output.Bound, "unbound", output.Unbound)
+	return output, nil
+}
+
+func (s *storeService) ListCustomerDataExports(ctx context.Context, id string) ([]entity.CustomerDataExport, error) {
+	logger := s.logger.
+		Named("ListCustomerDataExports").
+		WithContext(ctx).
+		With("id", id)
+
+	store, err := s.getStore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	exports, err := s.storages.CustomerDataExport.ListCustomerDataExports(store.ID)
+	if err != nil {
+		logger.Error("failed to list customer data exports", "err", err)
+		return nil, fmt.Errorf("failed to list customer data exports: %w", err)
+	}
+
+	logger.Info("successfully listed customer data exports", "count", len(exports))
+	return exports, nil
+}
+
+func (s *storeService) GetCustomerDataExport(ctx context.Context, opts GetCustomerDataExportOptions) (*CustomerDataExport, error) {
+	logger := s.logger.
+		Named("GetCustomerDataExport").
+		WithContext(ctx).
+		With("opts", opts)
+
+	store, err := s.getStore(ctx, opts.StoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := s.storages.CustomerDataExport.GetCustomerDataExport(store.ID, opts.ID)
+	if err != nil {
+		logger.Error("failed to get customer data export", "err", err)
+		return nil, fmt.Errorf("failed to get customer data export: %w", err)
+	}
+	if export == nil || time.Now().After(export.ExpiresAt) {
+		logger.Info("customer data export not found")
+		return nil, ErrCustomerDataExportNotFound
+	}
+
+	data, err := secret.Decrypt(s.cfg.Auth.EncryptionKey, export.Data)
+	if err != nil {
+		logger.Error("failed to decrypt customer data export", "err", err)
+		return nil, fmt.Errorf("failed to decrypt customer data export: %w", err)
+	}
+
+	logger.Info("successfully got customer data export")
+	return &CustomerDataExport{CustomerDataExport: *export, Data: json.RawMessage(data)}, nil
+}
+
+func (s *storeService) getStore(ctx context.Context, id string) (*entity.Store, error) {
+	logger := s.logger.
+		Named("getStore").
+		WithContext(ctx).
+		With("id", id)
+
+	store, err := s.storages.Store.GetStoreByFilter(GetStoreFilter{
+		ID:           &id,
+		WithDisabled: true,
+	})
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return nil, ErrStoreNotFound
+	}
+
+	return store, nil
+}
@@ -0,0 +1,84 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// unboundCustomerStorage keeps unbound customers in memory, bound ones are removed from it.
+type unboundCustomerStorage struct {
+	service.CustomerStorage
+	unbound []entity.Customer
+	bound   map[string]string
+}
+
+func (f *unboundCustomerStorage) ListUnboundCustomers(afterID string, limit int) ([]entity.Customer, error) {
+	var customers []entity.Customer
+	for _, customer := range f.unbound {
+		if customer.ID > afterID && len(customers) < limit {
+			customers = append(customers, customer)
+		}
+	}
+	return customers, nil
+}
+
+func (f *unboundCustomerStorage) CountUnboundCustomers() (int64, error) {
+	return int64(len(f.unbound) - len(f.bound)), nil
+}
+
+func (f *unboundCustomerStorage) BindCustomerStore(id, storeID string) error {
+	f.bound[id] = storeID
+	return nil
+}
+
+// storeCustomersVendorAPI returns only customers of the store vendor.
+type storeCustomersVendorAPI struct {
+	service.VendorAPI
+	vendorCustomerIDs map[string]bool
+}
+
+func (f *storeCustomersVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *storeCustomersVendorAPI) GetCustomerByVendorID(_ context.Context, vendorCustomerID string) (*entity.Customer, error) {
+	if !f.vendorCustomerIDs[vendorCustomerID] {
+		return nil, nil
+	}
+	return &entity.Customer{VendorCustomerID: vendorCustomerID}, nil
+}
+
+func TestBindUnboundCustomers(t *testing.T) {
+	customers := &unboundCustomerStorage{
+		unbound: []entity.Customer{
+			{ID: "customer-1", VendorCustomerID: "1001"},
+			{ID: "customer-2", VendorCustomerID: "1002"},
+			{ID: "customer-3", VendorCustomerID: "1003"},
+		},
+		bound: map[string]string{},
+	}
+	storeService := service.NewStoreService(service.Options{
+		APIs: service.APIs{VendorAPI: &storeCustomersVendorAPI{vendorCustomerIDs: map[string]bool{"1001": true, "1003": true}}},
+		Storages: service.Storages{
+			Customer: customers,
+			Store:    &installStoreStorage{existing: &entity.Store{ID: "store"}, conflicted: true},
+		},
+		Config: &config.Config{},
+		Logger: logging.NewZapLogger("error"),
+	})
+
+	output, err := storeService.BindUnboundCustomers(context.Background(), "store")
+	require.NoError(t, err)
+	assert.Equal(t, &service.BindUnboundCustomersOutput{Bound: 2, Unbound: 1}, output)
+	// customers missing in the store vendor belong to another store and stay unbound
+	assert.Equal(t, map[string]string{"customer-1": "store", "customer-3": "store"}, customers.bound)
+}
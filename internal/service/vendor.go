@@ -1,12 +1,36 @@
 package service
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
+	"github.com/taraslis453/shopify-customer-auth/pkg/token"
+)
+
+const (
+	// installStateLifetime is how long the merchant has to approve the installation on vendor side.
+	installStateLifetime = 10 * time.Minute
+	// installStateCookieName is a name of the cookie holding the signed install state.
+	installStateCookieName = "vendor_install_state"
 )
 
+// installStateClaims is a payload of the signed install state cookie.
+type installStateClaims struct {
+	StoreVendorID string `json:"storeVendorId"`
+	Nonce         string `json:"nonce"`
+}
+
 type vendorService struct {
 	serviceContext
 }
@@ -16,10 +40,11 @@ var _ VendorService = (*vendorService)(nil)
 func NewVendorService(options Options) *vendorService {
 	return &vendorService{
 		serviceContext: serviceContext{
-			apis:     options.APIs,
-			cfg:      options.Config,
-			logger:   options.Logger.Named("Vendor"),
-			storages: options.Storages,
+			apis:       options.APIs,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("Vendor"),
+			storages:   options.Storages,
+			background: options.Background,
 		},
 	}
 }
@@ -29,17 +54,39 @@ func (s *vendorService) HandleInstall(c *gin.Context) (string, error) {
 		Named("HandleInstall").
 		WithContext(c)
 
-	vendorID := getVendorIDFromQuery(c)
+	vendorID, err := getVendorIDFromQuery(c)
+	if err != nil {
+		logger.Info("invalid vendorID", "err", err)
+		return "", ErrHandleInstallInvalidVendorID
+	}
 	if vendorID == "" {
 		logger.Info("vendorID not found")
 		return "", ErrHandleInstallVendorIDNotFound
 	}
 
-	store, err := s.storages.Store.GetStore(&vendorID)
+	store, err := s.getInstallableStore(vendorID)
 	if err != nil {
 		logger.Error("failed to get store", "err", err)
 		return "", fmt.Errorf("failed to get store: %w", err)
 	}
+	if store == nil && s.isPublicApp() {
+		// the call creates the store, so it has to be signed with the app credentials before
+		err := s.apis.VendorAPI.WithStore(&entity.Store{VendorID: vendorID}).VerifyInstallRequest(c)
+		if err != nil {
+			if errs.IsExpected(err) {
+				logger.Info(err.Error())
+				return "", err
+			}
+			logger.Error("failed to verify install request", "err", err)
+			return "", fmt.Errorf("failed to verify install request: %w", err)
+		}
+
+		store, err = s.createPublicAppStore(c, vendorID)
+		if err != nil {
+			logger.Error("failed to create public app store", "err", err)
+			return "", fmt.Errorf("failed to create public app store: %w", err)
+		}
+	}
 	if store == nil {
 		logger.Info("store not found")
 		return "", ErrHandleInstallStoreNotFound
@@ -49,7 +96,17 @@ func (s *vendorService) HandleInstall(c *gin.Context) (string, error) {
 
 	redirectURL := s.cfg.App.BaseURL + "/vendors/redirect"
 
-	newStore, redirectURL, err := s.apis.VendorAPI.WithStore(store).HandleInstall(c, redirectURL)
+	state, err := s.startInstallState(c, store)
+	if err != nil {
+		logger.Error("failed to start install state", "err", err)
+		return "", fmt.Errorf("failed to start install state: %w", err)
+	}
+
+	newStore, redirectURL, err := s.apis.VendorAPI.WithStore(store).HandleInstall(c, VendorInstallOptions{
+		RedirectURL: redirectURL,
+		State:       state,
+		Scopes:      store.RequiredScopes(s.cfg.Shopify.Scopes),
+	})
 	if err != nil {
 		logger.Error("failed to handle install", "err", err)
 		return "", fmt.Errorf("failed to handle install: %w", err)
@@ -72,7 +129,11 @@ func (s *vendorService) HandleRedirect(c *gin.Context) (string, error) {
 		Named("HandleRedirect").
 		WithContext(c)
 
-	vendorID := getVendorIDFromQuery(c)
+	vendorID, err := getVendorIDFromQuery(c)
+	if err != nil {
+		logger.Info("invalid vendorID", "err", err)
+		return "", ErrHandleRedirectInvalidVendorID
+	}
 	if vendorID == "" {
 		logger.Info("vendorID not found")
 		return "", ErrHandleRedirectVendorIDNotFound
@@ -80,7 +141,7 @@ func (s *vendorService) HandleRedirect(c *gin.Context) (string, error) {
 	logger = logger.With("vendorID", vendorID)
 	logger.Debug("got vendor id from query")
 
-	store, err := s.storages.Store.GetStore(&vendorID)
+	store, err := s.getInstallableStore(vendorID)
 	if err != nil {
 		logger.Error("failed to get store", "err", err)
 		return "", fmt.Errorf("failed to get store: %w", err)
@@ -92,6 +153,11 @@ func (s *vendorService) HandleRedirect(c *gin.Context) (string, error) {
 	logger = logger.With("store", store)
 	logger.Debug("got store")
 
+	if !s.verifyInstallState(c, store) {
+		logger.Info("invalid install state")
+		return "", ErrHandleRedirectInvalidState
+	}
+
 	newStore, err := s.apis.VendorAPI.WithStore(store).HandleRedirect(c)
 	if err != nil {
 		if errs.IsExpected(err) {
@@ -104,23 +170,331 @@ func (s *vendorService) HandleRedirect(c *gin.Context) (string, error) {
 	logger = logger.With("newVendorConfig", newStore)
 	logger.Debug("handled redirect")
 
-	updatedStore, err := s.storages.Store.UpdateStore(newStore.ID, newStore)
-	if err != nil {
-		logger.Error("failed to update store", "err", err)
-		return "", fmt.Errorf("failed to update store: %w", err)
+	// e.g. required scopes were changed while the merchant was approving the install
+	if err := s.completeInstall(c, newStore); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return "", err
+		}
+		logger.Error("failed to complete install", "err", err)
+		return "", fmt.Errorf("failed to complete install: %w", err)
 	}
-	logger = logger.With("updatedStore", updatedStore)
-	logger.Debug("updated store")
 
 	logger.Info("successfully handled redirect")
 	return "", nil
 }
 
-func getVendorIDFromQuery(c *gin.Context) string {
+func (s *vendorService) HandleTokenExchange(ctx context.Context, sessionToken string) error {
+	logger := s.logger.
+		Named("HandleTokenExchange").
+		WithContext(ctx)
+
+	parsed, err := s.apis.VendorAPI.ParseSessionToken(sessionToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to parse session token", "err", err)
+		return fmt.Errorf("failed to parse session token: %w", err)
+	}
+	vendorID := parsed.StoreVendorID
+	logger = logger.With("vendorID", vendorID)
+
+	store, err := s.getInstallableStore(vendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil && !s.isPublicApp() {
+		logger.Info("store not found")
+		return ErrHandleTokenExchangeStoreNotFound
+	}
+	// the session token is verified with the app credentials before the public app store is created for it
+	verifiedStore := store
+	if verifiedStore == nil {
+		verifiedStore = &entity.Store{VendorID: vendorID}
+	}
+	if _, err := s.apis.VendorAPI.WithStore(verifiedStore).VerifySessionToken(sessionToken); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to verify session token", "err", err)
+		return fmt.Errorf("failed to verify session token: %w", err)
+	}
+	if store == nil {
+		store, err = s.createPublicAppStore(ctx, vendorID)
+		if err != nil {
+			logger.Error("failed to create public app store", "err", err)
+			return fmt.Errorf("failed to create public app store: %w", err)
+		}
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return ErrHandleTokenExchangeStoreNotFound
+	}
+	logger = logger.With("storeID", store.ID)
+
+	newStore, err := s.apis.VendorAPI.WithStore(store).HandleTokenExchange(ctx, sessionToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to handle token exchange", "err", err)
+		return fmt.Errorf("failed to handle token exchange: %w", err)
+	}
+
+	// e.g. scopes of the app configuration managed by vendor miss required ones
+	if err := s.completeInstall(ctx, newStore); err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to complete install", "err", err)
+		return fmt.Errorf("failed to complete install: %w", err)
+	}
+
+	logger.Info("successfully handled token exchange")
+	return nil
+}
+
+// completeInstall saves new credentials of the installed store, enables it if it was uninstalled and subscribes it
+// to webhooks. ErrHandleRedirectReauthorizationRequired is returned if not all required scopes are granted.
+func (s *vendorService) completeInstall(ctx context.Context, newStore *entity.Store) error {
+	logger := s.logger.
+		Named("completeInstall").
+		WithContext(ctx).
+		With("storeID", newStore.ID)
+
+	if newStore.IsUninstalled() {
+		if err := s.storages.Store.ReinstallStore(newStore); err != nil {
+			return fmt.Errorf("failed to reinstall store: %w", err)
+		}
+		logger.Info("reinstalled store")
+	}
+
+	if _, err := s.storages.Store.UpdateStore(newStore.ID, newStore); err != nil {
+		return fmt.Errorf("failed to update store: %w", err)
+	}
+	logger.Debug("updated store")
+
+	if err := s.registerWebhooks(ctx, newStore); err != nil {
+		return fmt.Errorf("failed to register webhooks: %w", err)
+	}
+
+	if missingScopes := newStore.GetMissingScopes(s.cfg.Shopify.Scopes); len(missingScopes) > 0 {
+		logger.Info("required scopes aren't granted", "missingScopes", missingScopes)
+		return errs.WithDetails(ErrHandleRedirectReauthorizationRequired, ReauthorizationRequiredDetails{
+			MissingScopes: missingScopes,
+			InstallURL:    s.installURL(newStore.VendorID),
+		})
+	}
+
+	return nil
+}
+
+func (s *vendorService) VerifySessionToken(ctx context.Context, sessionToken string) (*VendorSession, error) {
+	logger := s.logger.
+		Named("VerifySessionToken").
+		WithContext(ctx)
+
+	parsed, err := s.apis.VendorAPI.ParseSessionToken(sessionToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to parse session token", "err", err)
+		return nil, fmt.Errorf("failed to parse session token: %w", err)
+	}
+	logger = logger.With("vendorID", parsed.StoreVendorID)
+
+	store, err := s.storages.Store.GetStore(&parsed.StoreVendorID)
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		logger.Info("store not found")
+		return nil, ErrVerifySessionTokenInvalid
+	}
+
+	verified, err := s.apis.VendorAPI.WithStore(store).VerifySessionToken(sessionToken)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, err
+		}
+		logger.Error("failed to verify session token", "err", err)
+		return nil, fmt.Errorf("failed to verify session token: %w", err)
+	}
+
+	logger.Info("successfully verified session token", "userID", verified.UserID)
+	return &VendorSession{
+		Store:  store,
+		UserID: verified.UserID,
+	}, nil
+}
+
+// registerWebhooks subscribes the installed store to subscribedWebhookTopics, e.g. the store is disabled once
+// the merchant uninstalls the app since its tokens are revoked then.
+func (s *vendorService) registerWebhooks(ctx context.Context, store *entity.Store) error {
+	vendorAPI := s.apis.VendorAPI.WithStore(store)
+	for _, topic := range subscribedWebhookTopics {
+		err := vendorAPI.RegisterWebhook(ctx, RegisterVendorWebhookOptions{
+			Topic:       topic,
+			CallbackURL: s.cfg.App.BaseURL + "/webhooks/shopify",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register %s webhook: %w", topic, err)
+		}
+	}
+
+	return nil
+}
+
+// getInstallableStore returns the store the app can be installed to, it's either enabled or uninstalled one.
+// Stores disabled by admins can't be installed.
+func (s *vendorService) getInstallableStore(vendorID string) (*entity.Store, error) {
+	store, err := s.storages.Store.GetStoreByFilter(GetStoreFilter{
+		VendorID:     &vendorID,
+		WithDisabled: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if store == nil || store.IsDisabledByAdmin() {
+		return nil, nil
+	}
+
+	return store, nil
+}
+
+// createPublicAppStore creates the store of the public app on its first install, the install has to be verified
+// before. Nil is returned if the app isn't public or the store is disabled.
+func (s *vendorService) createPublicAppStore(ctx context.Context, vendorID string) (*entity.Store, error) {
+	logger := s.logger.
+		Named("createPublicAppStore").
+		WithContext(ctx).
+		With("vendorID", vendorID)
+
+	if !s.isPublicApp() {
+		return nil, nil
+	}
+
+	// the store has no credentials of its own, so the app credentials from config are used
+	store := &entity.Store{VendorID: vendorID}
+	created, err := s.storages.Store.CreateStoreIfNotExists(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+	if !created {
+		// the store is disabled or created by a concurrent install
+		store, err = s.getInstallableStore(vendorID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get store: %w", err)
+		}
+		if store == nil {
+			logger.Info("store is disabled")
+			return nil, nil
+		}
+		logger.Info("store is already created", "storeID", store.ID)
+		return store, nil
+	}
+
+	logger.Info("successfully created public app store", "storeID", store.ID)
+	return store, nil
+}
+
+// installURL returns the link the merchant opens to install the app to the store or grant it new scopes.
+// It points to the install endpoint which binds the oauth2 state to the merchant browser.
+func (s *serviceContext) installURL(vendorID string) string {
+	return fmt.Sprintf("%s/vendors/install?%s", s.cfg.App.BaseURL, url.Values{"shop": {vendorID}}.Encode())
+}
+
+// isPublicApp checks whether app credentials are configured, so stores can go without their own credentials.
+func (s *serviceContext) isPublicApp() bool {
+	return s.cfg.Shopify.APIKey != "" && s.cfg.Shopify.APISecret != ""
+}
+
+// startInstallState generates a nonce passed through vendor as oauth2 state and binds it to the store and
+// the browser with a signed cookie, so the redirect can't be forged or replayed.
+func (s *vendorService) startInstallState(c *gin.Context, store *entity.Store) (string, error) {
+	nonce, err := generateNonce()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	t := time.Now()
+	cookie, err := token.SignJWTToken(
+		&token.UniversalClaims{
+			Iss:   s.installStateIssuer(),
+			ExpAt: t.Add(installStateLifetime),
+			NbfAt: t,
+			IssAt: t,
+			Payload: installStateClaims{
+				StoreVendorID: store.VendorID,
+				Nonce:         nonce,
+			},
+		},
+		s.cfg.Auth.TokenSecretKey,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign install state: %w", err)
+	}
+
+	s.setInstallStateCookie(c, cookie, int(installStateLifetime.Seconds()))
+	return nonce, nil
+}
+
+// verifyInstallState checks that redirect state is the nonce issued by install of the store in the same browser.
+// The cookie is removed, so every nonce is accepted once.
+func (s *vendorService) verifyInstallState(c *gin.Context, store *entity.Store) bool {
+	cookie, err := c.Cookie(installStateCookieName)
+	if err != nil {
+		return false
+	}
+	s.setInstallStateCookie(c, "", -1)
+
+	claims, err := token.VerifyJWTToken(token.VerifyJWTTokenOptions{
+		Token:  cookie,
+		Secret: s.cfg.Auth.TokenSecretKey,
+	})
+	if err != nil || claims.Iss != s.installStateIssuer() {
+		return false
+	}
+	var state installStateClaims
+	if err := mapstructure.Decode(claims.GetPayload(), &state); err != nil {
+		return false
+	}
+
+	return state.StoreVendorID == store.VendorID &&
+		subtle.ConstantTimeCompare([]byte(state.Nonce), []byte(c.Query("state"))) == 1
+}
+
+func (s *vendorService) setInstallStateCookie(c *gin.Context, value string, maxAge int) {
+	// lax cookies are sent on the top-level redirect back from vendor
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(installStateCookieName, value, maxAge, "/vendors", "", strings.HasPrefix(s.cfg.App.BaseURL, "https://"), true)
+}
+
+func (s *vendorService) installStateIssuer() string {
+	return s.cfg.Auth.TokenIssuer + "/install-state"
+}
+
+// getVendorIDFromQuery returns canonical store domain from the query, it's empty if the query has no store domain.
+func getVendorIDFromQuery(c *gin.Context) (string, error) {
 	// shopify
-	if c.Query("shop") != "" {
-		return c.Query("shop")
+	shop := c.Query("shop")
+	if shop == "" {
+		return "", nil
 	}
 
-	return ""
+	domain, err := shopdomain.Parse(shop)
+	if err != nil {
+		return "", err
+	}
+	return domain.String(), nil
 }
@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// installVendorAPI accepts install requests unless verifyErr is set, other methods aren't implemented.
+type installVendorAPI struct {
+	service.VendorAPI
+	verifyErr error
+}
+
+func (f *installVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *installVendorAPI) VerifyInstallRequest(*gin.Context) error {
+	return f.verifyErr
+}
+
+func (f *installVendorAPI) HandleInstall(_ *gin.Context, opts service.VendorInstallOptions) (*entity.Store, string, error) {
+	return &entity.Store{}, "https://test.myshopify.com/admin/oauth/authorize?state=" + opts.State, nil
+}
+
+// installStoreStorage keeps stores in memory, existing stores are returned only after a create conflict
+// to simulate a concurrent install.
+type installStoreStorage struct {
+	service.StoreStorage
+	existing *entity.Store
+	created  []*entity.Store
+	// conflicted is set once a create conflicts with the existing store.
+	conflicted bool
+}
+
+func (f *installStoreStorage) GetStoreByFilter(service.GetStoreFilter) (*entity.Store, error) {
+	if f.conflicted {
+		return f.existing, nil
+	}
+	return nil, nil
+}
+
+func (f *installStoreStorage) CreateStoreIfNotExists(store *entity.Store) (bool, error) {
+	if f.existing != nil {
+		f.conflicted = true
+		return false, nil
+	}
+	store.ID = "created"
+	f.created = append(f.created, store)
+	return true, nil
+}
+
+func (f *installStoreStorage) UpdateStore(_ string, store *entity.Store) (*entity.Store, error) {
+	return store, nil
+}
+
+func TestHandleInstallPublicApp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Auth.TokenSecretKey = "secret"
+	cfg.Shopify.APIKey = "client"
+	cfg.Shopify.APISecret = "secret"
+
+	testCases := []struct {
+		name            string
+		verifyErr       error
+		existing        *entity.Store
+		expectedError   error
+		expectedCreated int
+	}{
+		{
+			name:            "positive: signed first install creates the store",
+			expectedCreated: 1,
+		},
+		{
+			name:     "positive: concurrently created store is reused",
+			existing: &entity.Store{ID: "existing", VendorID: "test.myshopify.com"},
+		},
+		{
+			name:          "negative: unsigned install doesn't create the store",
+			verifyErr:     service.ErrHandleInstallInvalidHMAC,
+			expectedError: service.ErrHandleInstallInvalidHMAC,
+		},
+		{
+			name:          "negative: stale install doesn't create the store",
+			verifyErr:     service.ErrHandleInstallTimestampExpired,
+			expectedError: service.ErrHandleInstallTimestampExpired,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := &installStoreStorage{existing: tc.existing}
+			vendorService := service.NewVendorService(service.Options{
+				APIs:     service.APIs{VendorAPI: &installVendorAPI{verifyErr: tc.verifyErr}},
+				Storages: service.Storages{Store: stores},
+				Config:   cfg,
+				Logger:   logging.NewZapLogger("error"),
+			})
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/vendors/install?shop=test.myshopify.com", nil)
+
+			redirectURL, err := vendorService.HandleInstall(c)
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				assert.Empty(t, redirectURL)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, redirectURL)
+			}
+			assert.Len(t, stores.created, tc.expectedCreated)
+		})
+	}
+}
+
+// tokenExchangeVendorAPI verifies session tokens unless verifyErr is set, other methods aren't implemented.
+type tokenExchangeVendorAPI struct {
+	service.VendorAPI
+	verifyErr error
+	// exchanged is set once the session token is exchanged.
+	exchanged bool
+}
+
+func (f *tokenExchangeVendorAPI) WithStore(*entity.Store) service.VendorAPI {
+	return f
+}
+
+func (f *tokenExchangeVendorAPI) ParseSessionToken(string) (*service.VendorSessionToken, error) {
+	return &service.VendorSessionToken{StoreVendorID: "test.myshopify.com", UserID: "42"}, nil
+}
+
+func (f *tokenExchangeVendorAPI) VerifySessionToken(string) (*service.VendorSessionToken, error) {
+	if f.verifyErr != nil {
+		return nil, f.verifyErr
+	}
+	return &service.VendorSessionToken{StoreVendorID: "test.myshopify.com", UserID: "42"}, nil
+}
+
+func (f *tokenExchangeVendorAPI) HandleTokenExchange(context.Context, string) (*entity.Store, error) {
+	f.exchanged = true
+	return &entity.Store{ID: "created", VendorID: "test.myshopify.com", Scope: "read_customers"}, nil
+}
+
+func (f *tokenExchangeVendorAPI) RegisterWebhook(context.Context, service.RegisterVendorWebhookOptions) error {
+	return nil
+}
+
+func TestHandleTokenExchangePublicApp(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Shopify.APIKey = "client"
+	cfg.Shopify.APISecret = "secret"
+	cfg.Shopify.Scopes = "read_customers"
+
+	testCases := []struct {
+		name            string
+		verifyErr       error
+		expectedError   error
+		expectedCreated int
+	}{
+		{
+			name:            "positive: verified session token creates the store",
+			expectedCreated: 1,
+		},
+		{
+			name:          "negative: unverified session token doesn't create the store",
+			verifyErr:     service.ErrVerifySessionTokenInvalid,
+			expectedError: service.ErrVerifySessionTokenInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stores := &installStoreStorage{}
+			vendorAPI := &tokenExchangeVendorAPI{verifyErr: tc.verifyErr}
+			vendorService := service.NewVendorService(service.Options{
+				APIs:     service.APIs{VendorAPI: vendorAPI},
+				Storages: service.Storages{Store: stores},
+				Config:   cfg,
+				Logger:   logging.NewZapLogger("error"),
+			})
+
+			err := vendorService.HandleTokenExchange(context.Background(), "session-token")
+			assert.Equal(t, tc.expectedError, err)
+			assert.Len(t, stores.created, tc.expectedCreated)
+			assert.Equal(t, tc.expectedError == nil, vendorAPI.exchanged)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/pkg/errs"
+)
+
+type webhookService struct {
+	serviceContext
+	// handlers contains handlers of supported webhook topics, webhooks of other topics are skipped.
+	handlers map[string]webhookHandler
+}
+
+// webhookHandler handles a verified webhook of the store.
+type webhookHandler func(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error
+
+var _ WebhookService = (*webhookService)(nil)
+
+// subscribedWebhookTopics are topics subscribed on install. Privacy topics are subscribed in the app settings
+// since vendor doesn't allow to subscribe them through API.
+var subscribedWebhookTopics = []string{
+	WebhookTopicCustomersCreate,
+	WebhookTopicCustomersUpdate,
+	WebhookTopicCustomersDelete,
+	WebhookTopicAppUninstalled,
+}
+
+// processWebhooksBatchSize limits how many due webhooks are retried by one ProcessWebhooks call.
+const processWebhooksBatchSize = 100
+
+func NewWebhookService(options Options) *webhookService {
+	s := &webhookService{
+		serviceContext: serviceContext{
+			apis:       options.APIs,
+			cfg:        options.Config,
+			logger:     options.Logger.Named("webhookService"),
+			storages:   options.Storages,
+			background: options.Background,
+		},
+	}
+	s.handlers = map[string]webhookHandler{
+		WebhookTopicCustomersDataRequest: s.exportCustomerData,
+		WebhookTopicCustomersRedact:      s.redactCustomer,
+		WebhookTopicShopRedact:           s.redactStore,
+		WebhookTopicCustomersCreate:      s.syncCustomer,
+		WebhookTopicCustomersUpdate:      s.syncCustomer,
+		WebhookTopicCustomersDelete:      s.deleteCustomer,
+		WebhookTopicAppUninstalled:       s.uninstallStore,
+	}
+	return s
+}
+
+func (s *webhookService) HandleWebhook(c *gin.Context) error {
+	logger := s.logger.
+		Named("HandleWebhook").
+		WithContext(c)
+
+	webhook, store, err := s.receiveWebhook(c)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return err
+		}
+		logger.Error("failed to receive webhook", "err", err)
+		return fmt.Errorf("failed to receive webhook: %w", err)
+	}
+	if store == nil {
+		return nil
+	}
+	logger = logger.With("id", webhook.ID, "topic", webhook.Topic, "storeVendorID", webhook.StoreVendorID)
+
+	if _, ok := s.handlers[webhook.Topic]; !ok {
+		logger.Info("unsupported webhook topic")
+		return nil
+	}
+
+	// the event is due at once, the run below claims it and ProcessWebhooks retries it if this process stops
+	nextAttemptAt := time.Now()
+	event := &entity.WebhookEvent{
+		VendorWebhookID:  webhook.ID,
+		StoreVendorID:    store.VendorID,
+		Topic:            webhook.Topic,
+		VendorCustomerID: webhook.VendorCustomerID,
+		CustomerEmail:    webhook.CustomerEmail,
+		CustomerState:    webhook.CustomerState,
+		Status:           entity.WebhookEventStatusPending,
+		NextAttemptAt:    &nextAttemptAt,
+	}
+	created, err := s.storages.WebhookEvent.CreateWebhookEvent(event)
+	if err != nil {
+		logger.Error("failed to create webhook event", "err", err)
+		return fmt.Errorf("failed to create webhook event: %w", err)
+	}
+	if !created {
+		logger.Info("webhook is already received, skipping")
+		return nil
+	}
+	logger = logger.With("webhookEventID", event.ID)
+
+	// vendor expects a fast response and redelivers slow ones, so the webhook is handled after the response
+	s.background.Go(func(ctx context.Context) {
+		s.runWebhookEvent(ctx, event.ID)
+	})
+
+	logger.Info("successfully queued webhook")
+	return nil
+}
+
+func (s *webhookService) ProcessWebhooks(ctx context.Context) error {
+	logger := s.logger.
+		Named("ProcessWebhooks").
+		WithContext(ctx)
+
+	now := time.Now()
+	events, err := s.storages.WebhookEvent.ListWebhookEvents(ListWebhookEventsFilter{
+		Statuses:  []string{entity.WebhookEventStatusPending},
+		DueBefore: &now,
+		Limit:     processWebhooksBatchSize,
+	})
+	if err != nil {
+		logger.Error("failed to list due webhook events", "err", err)
+		return fmt.Errorf("failed to list due webhook events: %w", err)
+	}
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.runWebhookEvent(ctx, event.ID)
+	}
+
+	deleted, err := s.storages.WebhookEvent.DeleteWebhookEvents(now.Add(-s.cfg.Webhook.Retention))
+	if err != nil {
+		logger.Error("failed to delete expired webhook events", "err", err)
+		return fmt.Errorf("failed to delete expired webhook events: %w", err)
+	}
+
+	deletedExports, err := s.storages.CustomerDataExport.DeleteCustomerDataExports(DeleteCustomerDataExportsFilter{
+		ExpiredBefore: &now,
+	})
+	if err != nil {
+		logger.Error("failed to delete expired customer data exports", "err", err)
+		return fmt.Errorf("failed to delete expired customer data exports: %w", err)
+	}
+
+	logger.Info("successfully processed webhooks", "retried", len(events), "deleted", deleted, "deletedExports", deletedExports)
+	return nil
+}
+
+// runWebhookEvent claims the due webhook event and handles it with the handler of its topic, events claimed by
+// another run (e.g. of another replica) are skipped. Failed events are scheduled to be retried with exponential
+// backoff until they run out of attempts.
+func (s *webhookService) runWebhookEvent(ctx context.Context, id string) {
+	logger := s.logger.
+		Named("runWebhookEvent").
+		WithContext(ctx).
+		With("webhookEventID", id)
+
+	now := time.Now()
+	claimed, err := s.storages.WebhookEvent.ClaimWebhookEvent(id, now, now.Add(s.cfg.Webhook.Lease))
+	if err != nil {
+		logger.Error("failed to claim webhook event", "err", err)
+		return
+	}
+	if !claimed {
+		logger.Info("webhook event isn't due or is claimed by another run")
+		return
+	}
+
+	event, err := s.storages.WebhookEvent.GetWebhookEvent(id)
+	if err != nil {
+		logger.Error("failed to get webhook event", "err", err)
+		return
+	}
+	if event == nil {
+		logger.Info("webhook event not found")
+		return
+	}
+	logger = logger.With("vendorWebhookID", event.VendorWebhookID, "topic", event.Topic, "attempts", event.Attempts)
+
+	// the event can be claimed again once the lease is over, so it isn't handled longer
+	var handleErr error
+	if event.Attempts > s.cfg.Webhook.MaxAttempts {
+		// e.g. previous attempts were interrupted before they were saved
+		handleErr = fmt.Errorf("out of attempts")
+	} else {
+		leaseCtx, cancel := context.WithTimeout(ctx, s.cfg.Webhook.Lease)
+		handleErr = s.handleWebhookEvent(leaseCtx, event)
+		cancel()
+	}
+
+	now = time.Now()
+	update := &entity.WebhookEvent{Attempts: event.Attempts}
+	switch {
+	case handleErr == nil:
+		update.Status = entity.WebhookEventStatusProcessed
+		update.ProcessedAt = &now
+	case update.Attempts >= s.cfg.Webhook.MaxAttempts:
+		update.Status = entity.WebhookEventStatusFailed
+		update.Error = handleErr.Error()
+	default:
+		nextAttemptAt := now.Add(s.cfg.Webhook.RetryInterval << (update.Attempts - 1))
+		update.NextAttemptAt = &nextAttemptAt
+		update.Error = handleErr.Error()
+	}
+	if _, err := s.storages.WebhookEvent.UpdateWebhookEvent(event.ID, update); err != nil {
+		logger.Error("failed to update webhook event", "err", err)
+		return
+	}
+
+	if handleErr != nil {
+		logger.Error("failed to handle webhook event", "err", handleErr, "status", update.Status, "nextAttemptAt", update.NextAttemptAt)
+		return
+	}
+	logger.Info("successfully handled webhook event")
+}
+
+// handleWebhookEvent runs the handler of the event topic with the event store.
+func (s *webhookService) handleWebhookEvent(ctx context.Context, event *entity.WebhookEvent) error {
+	handler, ok := s.handlers[event.Topic]
+	if !ok {
+		return fmt.Errorf("unsupported webhook topic %q", event.Topic)
+	}
+
+	store, err := s.storages.Store.GetStoreByFilter(GetStoreFilter{
+		VendorID:     &event.StoreVendorID,
+		WithDisabled: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		// NOTE: the store is purged after the webhook was received, so there is nothing to handle
+		s.logger.Named("handleWebhookEvent").WithContext(ctx).Info("store not found, skipping webhook event", "webhookEventID", event.ID)
+		return nil
+	}
+
+	return handler(ctx, store, &VendorWebhook{
+		ID:               event.VendorWebhookID,
+		Topic:            event.Topic,
+		StoreVendorID:    event.StoreVendorID,
+		VendorCustomerID: event.VendorCustomerID,
+		CustomerEmail:    event.CustomerEmail,
+		CustomerState:    event.CustomerState,
+	})
+}
+
+// receiveWebhook parses the webhook and verifies its signature with credentials of the webhook store.
+// Nil store is returned for webhooks of unknown stores, they have to be skipped.
+func (s *webhookService) receiveWebhook(c *gin.Context) (*VendorWebhook, *entity.Store, error) {
+	logger := s.logger.
+		Named("receiveWebhook").
+		WithContext(c)
+
+	webhook, err := s.apis.VendorAPI.ParseWebhook(c)
+	if err != nil {
+		if errs.IsExpected(err) {
+			logger.Info(err.Error())
+			return nil, nil, err
+		}
+		logger.Error("failed to parse webhook", "err", err)
+		return nil, nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	logger = logger.With("id", webhook.ID, "topic", webhook.Topic, "storeVendorID", webhook.StoreVendorID)
+
+	// disabled stores still hold customer data, so their privacy webhooks have to be handled
+	store, err := s.storages.Store.GetStoreByFilter(GetStoreFilter{
+		VendorID:     &webhook.StoreVendorID,
+		WithDisabled: true,
+	})
+	if err != nil {
+		logger.Error("failed to get store", "err", err)
+		return nil, nil, fmt.Errorf("failed to get store: %w", err)
+	}
+	if store == nil {
+		// NOTE: we hold no data of unknown stores (e.g. already purged), so there is nothing to handle
+		logger.Info("store not found, skipping webhook")
+		return webhook, nil, nil
+	}
+
+	if !s.apis.VendorAPI.WithStore(store).VerifyWebhook(webhook) {
+		logger.Info("invalid webhook signature")
+		return nil, nil, ErrHandleWebhookInvalidSignature
+	}
+
+	return webhook, store, nil
+}
+
+// uninstallStore handles app/uninstalled webhook, vendor tokens of the store are revoked by then, so the store is
+// disabled and sessions of its customers are revoked until the app is installed again.
+func (s *webhookService) uninstallStore(ctx context.Context, store *entity.Store, webhook *VendorWebhook) error {
+	logger := s.logger.
+		Named("uninstallStore").
+		WithContext(ctx).
+		With("storeID", store.ID)
+
+	if store.IsUninstalled() {
+		logger.Info("store is already uninstalled")
+		return nil
+	}
+
+	if err := s.storages.Store.UninstallStore(store.ID); err != nil {
+		logger.Error("failed to uninstall store", "err", err)
+		return fmt.Errorf("failed to uninstall store: %w", err)
+	}
+
+	logger.Info("successfully uninstalled store")
+	return nil
+}
@@ -0,0 +1,192 @@
+package service_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/config"
+	"github.com/taraslis453/shopify-customer-auth/pkg/logging"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// memoryWebhookEventStorage keeps webhook events in memory, claims are atomic like the conditional update.
+type memoryWebhookEventStorage struct {
+	service.WebhookEventStorage
+	mu     sync.Mutex
+	events map[string]*entity.WebhookEvent
+}
+
+func (f *memoryWebhookEventStorage) GetWebhookEvent(id string) (*entity.WebhookEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	event, ok := f.events[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *event
+	return &copied, nil
+}
+
+func (f *memoryWebhookEventStorage) ClaimWebhookEvent(id string, now, leaseUntil time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	event, ok := f.events[id]
+	if !ok || event.Status != entity.WebhookEventStatusPending || event.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	event.NextAttemptAt = &leaseUntil
+	event.Attempts++
+	return true, nil
+}
+
+func (f *memoryWebhookEventStorage) ListWebhookEvents(filter service.ListWebhookEventsFilter) ([]entity.WebhookEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []entity.WebhookEvent
+	for _, event := range f.events {
+		if event.Status == entity.WebhookEventStatusPending && !event.NextAttemptAt.After(*filter.DueBefore) {
+			events = append(events, *event)
+		}
+	}
+	return events, nil
+}
+
+func (f *memoryWebhookEventStorage) UpdateWebhookEvent(id string, update *entity.WebhookEvent) (*entity.WebhookEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	event := f.events[id]
+	event.Attempts = update.Attempts
+	if update.Status != "" {
+		event.Status = update.Status
+	}
+	if update.NextAttemptAt != nil {
+		event.NextAttemptAt = update.NextAttemptAt
+	}
+	return event, nil
+}
+
+func (f *memoryWebhookEventStorage) DeleteWebhookEvents(time.Time) (int64, error) {
+	return 0, nil
+}
+
+// slowUninstallStoreStorage counts uninstalls, they take a while so concurrent runs overlap.
+type slowUninstallStoreStorage struct {
+	service.StoreStorage
+	store       *entity.Store
+	uninstalled atomic.Int32
+}
+
+func (f *slowUninstallStoreStorage) GetStoreByFilter(service.GetStoreFilter) (*entity.Store, error) {
+	return f.store, nil
+}
+
+func (f *slowUninstallStoreStorage) UninstallStore(string) error {
+	f.uninstalled.Add(1)
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func TestProcessWebhooksConcurrentReplicas(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Webhook.MaxAttempts = 5
+	cfg.Webhook.RetryInterval = time.Minute
+	cfg.Webhook.Lease = time.Minute
+
+	dueAt := time.Now().Add(-time.Second)
+	events := &memoryWebhookEventStorage{events: map[string]*entity.WebhookEvent{
+		"event": {
+			ID:              "event",
+			VendorWebhookID: "webhook",
+			StoreVendorID:   "test.myshopify.com",
+			Topic:           service.WebhookTopicAppUninstalled,
+			Status:          entity.WebhookEventStatusPending,
+			NextAttemptAt:   &dueAt,
+		},
+	}}
+	stores := &slowUninstallStoreStorage{store: &entity.Store{ID: "store", VendorID: "test.myshopify.com"}}
+
+	// every replica has its own service, so only the storage claim keeps them from handling the same event
+	const replicas = 5
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		webhookService := service.NewWebhookService(service.Options{
+			Storages: service.Storages{WebhookEvent: events, Store: stores, CustomerDataExport: &memoryCustomerDataExportStorage{}},
+			Config:   cfg,
+			Logger:   logging.NewZapLogger("error"),
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, webhookService.ProcessWebhooks(context.Background()))
+		}()
+	}
+	wg.Wait()
+
+	event, err := events.GetWebhookEvent("event")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), stores.uninstalled.Load())
+	assert.Equal(t, entity.WebhookEventStatusProcessed, event.Status)
+	assert.Equal(t, 1, event.Attempts)
+}
+
+// upsertCountingCustomerStorage holds no customers, it counts customers created by webhooks.
+type upsertCountingCustomerStorage struct {
+	service.CustomerStorage
+	upserted int
+}
+
+func (f *upsertCountingCustomerStorage) GetCustomer(service.GetCustomerFilter) (*entity.Customer, error) {
+	return nil, nil
+}
+
+func (f *upsertCountingCustomerStorage) UpsertCustomer(customer *entity.Customer) (*entity.Customer, error) {
+	f.upserted++
+	return customer, nil
+}
+
+func TestProcessWebhooksCustomerUpdateAfterDelete(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Webhook.MaxAttempts = 5
+	cfg.Webhook.RetryInterval = time.Minute
+	cfg.Webhook.Lease = time.Minute
+
+	dueAt := time.Now().Add(-time.Second)
+	events := &memoryWebhookEventStorage{events: map[string]*entity.WebhookEvent{
+		"event": {
+			ID:               "event",
+			VendorWebhookID:  "webhook",
+			StoreVendorID:    "test.myshopify.com",
+			Topic:            service.WebhookTopicCustomersUpdate,
+			VendorCustomerID: "1001",
+			Status:           entity.WebhookEventStatusPending,
+			NextAttemptAt:    &dueAt,
+		},
+	}}
+	customers := &upsertCountingCustomerStorage{}
+	webhookService := service.NewWebhookService(service.Options{
+		Storages: service.Storages{
+			WebhookEvent:       events,
+			Store:              &slowUninstallStoreStorage{store: &entity.Store{ID: "store", VendorID: "test.myshopify.com"}},
+			Customer:           customers,
+			CustomerDataExport: &memoryCustomerDataExportStorage{},
+		},
+		Config: cfg,
+		Logger: logging.NewZapLogger("error"),
+	})
+
+	require.NoError(t, webhookService.ProcessWebhooks(context.Background()))
+
+	// the update is delivered after the customer was deleted, so it's skipped instead of creating the customer again
+	event, err := events.GetWebhookEvent("event")
+	require.NoError(t, err)
+	assert.Equal(t, entity.WebhookEventStatusProcessed, event.Status)
+	assert.Equal(t, 0, customers.upserted)
+}
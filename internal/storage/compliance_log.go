@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.ComplianceLogStorage = (*complianceLogStorage)(nil)
+
+type complianceLogStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewComplianceLogStorage(postgresql *postgresql.PostgreSQLGorm) *complianceLogStorage {
+	return &complianceLogStorage{postgresql}
+}
+
+func (r *complianceLogStorage) CreateComplianceLog(log *entity.ComplianceLog) (*entity.ComplianceLog, error) {
+	err := r.DB.Create(log).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compliance log: %w", err)
+	}
+
+	return log, nil
+}
@@ -3,8 +3,10 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
 
@@ -27,6 +29,9 @@ func (r *customerStorage) GetCustomer(filter service.GetCustomerFilter) (*entity
 	if filter.ID != nil {
 		stmt = stmt.Where(entity.Customer{ID: *filter.ID})
 	}
+	if filter.StoreID != nil {
+		stmt = stmt.Where("store_id = ?", *filter.StoreID)
+	}
 	if filter.VendorCustomerID != nil {
 		stmt = stmt.Where(entity.Customer{VendorCustomerID: *filter.VendorCustomerID})
 	}
@@ -52,6 +57,43 @@ func (r *customerStorage) CreateCustomer(customer *entity.Customer) (*entity.Cus
 	return customer, nil
 }
 
+func (r *customerStorage) UpsertCustomer(customer *entity.Customer) (*entity.Customer, error) {
+	// customers without vendor id would all share one row of the store
+	if customer.VendorCustomerID == "" {
+		return nil, fmt.Errorf("failed to upsert customer: vendor customer id is empty")
+	}
+
+	// the no-op update on conflict makes postgres lock and return the existing row
+	err := r.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "store_id"}, {Name: "vendor_customer_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"vendor_customer_id"}),
+		},
+		clause.Returning{},
+	).Create(customer).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert customer: %w", err)
+	}
+
+	return customer, nil
+}
+
+func (r *customerStorage) UpsertCustomers(customers []entity.Customer) error {
+	if len(customers) == 0 {
+		return nil
+	}
+
+	err := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "store_id"}, {Name: "vendor_customer_id"}},
+		DoNothing: true,
+	}).Create(&customers).Error
+	if err != nil {
+		return fmt.Errorf("failed to upsert customers: %w", err)
+	}
+
+	return nil
+}
+
 func (r *customerStorage) UpdateCustomer(id string, customer *entity.Customer) (*entity.Customer, error) {
 	err := r.DB.Model(&entity.Customer{}).Where("id = ?", id).Updates(customer).Error
 	if err != nil {
@@ -60,3 +102,148 @@ func (r *customerStorage) UpdateCustomer(id string, customer *entity.Customer) (
 
 	return customer, nil
 }
+
+func (r *customerStorage) DeleteCustomer(id string) error {
+	// identities are deleted by the foreign key constraint
+	err := r.DB.Where("id = ?", id).Delete(&entity.Customer{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete customer: %w", err)
+	}
+
+	return nil
+}
+
+func (r *customerStorage) ListCustomers(filter service.ListCustomersFilter) ([]entity.Customer, error) {
+	stmt := r.DB
+	if filter.VendorAccessTokenExpiresAfter != nil {
+		if filter.AfterID != "" {
+			stmt = stmt.Where("(vendor_access_token_expires_at, id) > (?, ?)", *filter.VendorAccessTokenExpiresAfter, filter.AfterID)
+		} else {
+			stmt = stmt.Where("vendor_access_token_expires_at > ?", *filter.VendorAccessTokenExpiresAfter)
+		}
+	}
+	if filter.VendorAccessTokenExpiresBefore != nil {
+		stmt = stmt.Where("vendor_access_token_expires_at < ?", *filter.VendorAccessTokenExpiresBefore)
+	}
+	if filter.RefreshTokenExpiresAfter != nil {
+		stmt = stmt.Where("refresh_token <> '' AND refresh_token_expires_at > ?", *filter.RefreshTokenExpiresAfter)
+	}
+	if filter.Limit != 0 {
+		stmt = stmt.Limit(filter.Limit)
+	}
+
+	var customers []entity.Customer
+	err := stmt.Order("vendor_access_token_expires_at, id").Find(&customers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+
+	return customers, nil
+}
+
+func (r *customerStorage) ClearCustomerSession(id string) error {
+	// Updates with a struct skips zero values, so the fields are reset with a map
+	err := r.DB.Model(&entity.Customer{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"refresh_token":                  "",
+		"refresh_token_expires_at":       nil,
+		"vendor_access_token":            "",
+		"vendor_access_token_expires_at": nil,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clear customer session: %w", err)
+	}
+
+	return nil
+}
+
+func (r *customerStorage) ClearExpiredCustomerSessions(expiredBefore time.Time) (int64, error) {
+	sessions := r.DB.Model(&entity.Customer{}).Where("refresh_token_expires_at < ?", expiredBefore).Updates(map[string]interface{}{
+		"refresh_token":                  "",
+		"refresh_token_expires_at":       nil,
+		"vendor_access_token":            "",
+		"vendor_access_token_expires_at": nil,
+	})
+	if sessions.Error != nil {
+		return 0, fmt.Errorf("failed to clear expired customer sessions: %w", sessions.Error)
+	}
+
+	// sessions started before refresh token expiration was stored keep the refresh token, it's verified
+	// on its own, but their vendor access tokens aren't renewed anymore
+	vendorTokens := r.DB.Model(&entity.Customer{}).Where("vendor_access_token_expires_at < ?", expiredBefore).Updates(map[string]interface{}{
+		"vendor_access_token":            "",
+		"vendor_access_token_expires_at": nil,
+	})
+	if vendorTokens.Error != nil {
+		return 0, fmt.Errorf("failed to clear expired vendor access tokens: %w", vendorTokens.Error)
+	}
+
+	return sessions.RowsAffected + vendorTokens.RowsAffected, nil
+}
+
+func (r *customerStorage) ListUnboundCustomers(afterID string, limit int) ([]entity.Customer, error) {
+	stmt := r.DB.Where("store_id IS NULL")
+	if afterID != "" {
+		stmt = stmt.Where("id > ?", afterID)
+	}
+
+	var customers []entity.Customer
+	err := stmt.Order("id").Limit(limit).Find(&customers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unbound customers: %w", err)
+	}
+
+	return customers, nil
+}
+
+func (r *customerStorage) CountUnboundCustomers() (int64, error) {
+	var count int64
+	err := r.DB.Model(&entity.Customer{}).Where("store_id IS NULL").Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unbound customers: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *customerStorage) BindCustomerStore(id, storeID string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var customer entity.Customer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND store_id IS NULL", id).First(&customer).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// bound concurrently
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get unbound customer: %w", err)
+		}
+
+		var existing entity.Customer
+		err = tx.Where("store_id = ? AND vendor_customer_id = ?", storeID, customer.VendorCustomerID).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Model(&entity.Customer{}).Where("id = ?", id).Update("store_id", storeID).Error; err != nil {
+				return fmt.Errorf("failed to bind customer store: %w", err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get customer of the store: %w", err)
+		}
+
+		// the customer logged in again after the store binding, so the unbound one is merged into it
+		err = tx.Model(&entity.CustomerIdentity{}).Where("customer_id = ?", id).Update("customer_id", existing.ID).Error
+		if err != nil {
+			return fmt.Errorf("failed to move customer identities: %w", err)
+		}
+		if err := tx.Where("id = ?", id).Delete(&entity.Customer{}).Error; err != nil {
+			return fmt.Errorf("failed to delete merged customer: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *customerStorage) Transaction(fn func(tx service.CustomerStorage) error) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(NewCustomerStorage(&postgresql.PostgreSQLGorm{DB: tx}))
+	})
+}
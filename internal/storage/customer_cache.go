@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.CustomerCacheStorage = (*customerCacheStorage)(nil)
+
+// customerCacheStorage keeps cached customers in PostgreSQL so the cache is shared between application replicas.
+type customerCacheStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewCustomerCacheStorage(postgresql *postgresql.PostgreSQLGorm) *customerCacheStorage {
+	return &customerCacheStorage{postgresql}
+}
+
+func (r *customerCacheStorage) GetCachedCustomer(key string) (*entity.Customer, bool, error) {
+	var entry entity.CustomerCacheEntry
+	err := r.DB.Where("key = ? AND expires_at > ?", key, time.Now()).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get cached customer: %w", err)
+	}
+	if entry.Profile == "" {
+		return nil, true, nil
+	}
+
+	var customer entity.Customer
+	if err := json.Unmarshal([]byte(entry.Profile), &customer); err != nil {
+		return nil, false, fmt.Errorf("failed to decode cached customer: %w", err)
+	}
+
+	return &customer, true, nil
+}
+
+func (r *customerCacheStorage) SetCachedCustomer(key string, customer *entity.Customer, ttl time.Duration) error {
+	entry := entity.CustomerCacheEntry{
+		Key:       key,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if customer != nil {
+		profile, err := json.Marshal(customer)
+		if err != nil {
+			return fmt.Errorf("failed to encode customer: %w", err)
+		}
+		entry.Profile = string(profile)
+	}
+
+	err := r.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+	if err != nil {
+		return fmt.Errorf("failed to set cached customer: %w", err)
+	}
+
+	return nil
+}
+
+func (r *customerCacheStorage) DeleteCachedCustomer(key string) error {
+	err := r.DB.Where("key = ?", key).Delete(&entity.CustomerCacheEntry{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete cached customer: %w", err)
+	}
+
+	return nil
+}
+
+func (r *customerCacheStorage) DeleteExpiredCachedCustomers(expiredBefore time.Time) (int64, error) {
+	res := r.DB.Where("expires_at < ?", expiredBefore).Delete(&entity.CustomerCacheEntry{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired cached customers: %w", res.Error)
+	}
+
+	return res.RowsAffected, nil
+}
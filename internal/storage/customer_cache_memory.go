@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.CustomerCacheStorage = (*memoryCustomerCacheStorage)(nil)
+
+// memoryCustomerCacheStorage is an LRU cache in process memory, entries are not shared between replicas.
+type memoryCustomerCacheStorage struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	// lru has the most recently used entries in front.
+	lru *list.List
+}
+
+type memoryCustomerCacheEntry struct {
+	key       string
+	customer  *entity.Customer
+	expiresAt time.Time
+}
+
+func NewMemoryCustomerCacheStorage(size int) *memoryCustomerCacheStorage {
+	return &memoryCustomerCacheStorage{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (r *memoryCustomerCacheStorage) GetCachedCustomer(key string) (*entity.Customer, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCustomerCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		r.remove(element)
+		return nil, false, nil
+	}
+	r.lru.MoveToFront(element)
+
+	return copyCustomer(entry.customer), true, nil
+}
+
+func (r *memoryCustomerCacheStorage) SetCachedCustomer(key string, customer *entity.Customer, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := &memoryCustomerCacheEntry{
+		key:       key,
+		customer:  copyCustomer(customer),
+		expiresAt: time.Now().Add(ttl),
+	}
+	if element, ok := r.entries[key]; ok {
+		element.Value = entry
+		r.lru.MoveToFront(element)
+		return nil
+	}
+
+	r.entries[key] = r.lru.PushFront(entry)
+	for r.size > 0 && r.lru.Len() > r.size {
+		r.remove(r.lru.Back())
+	}
+
+	return nil
+}
+
+func (r *memoryCustomerCacheStorage) DeleteCachedCustomer(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.entries[key]; ok {
+		r.remove(element)
+	}
+
+	return nil
+}
+
+func (r *memoryCustomerCacheStorage) DeleteExpiredCachedCustomers(expiredBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for _, element := range r.entries {
+		if element.Value.(*memoryCustomerCacheEntry).expiresAt.Before(expiredBefore) {
+			r.remove(element)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryCustomerCacheStorage) remove(element *list.Element) {
+	r.lru.Remove(element)
+	delete(r.entries, element.Value.(*memoryCustomerCacheEntry).key)
+}
+
+// copyCustomer prevents callers from modifying cached customers, e.g. by Customer.SetProfile,
+// so pointer and slice fields are copied too.
+func copyCustomer(customer *entity.Customer) *entity.Customer {
+	if customer == nil {
+		return nil
+	}
+	c := *customer
+	if customer.Store != nil {
+		store := *customer.Store
+		c.Store = &store
+	}
+	if customer.DefaultAddress != nil {
+		address := *customer.DefaultAddress
+		c.DefaultAddress = &address
+	}
+	if customer.VendorAccessTokenExpiresAt != nil {
+		expiresAt := *customer.VendorAccessTokenExpiresAt
+		c.VendorAccessTokenExpiresAt = &expiresAt
+	}
+	if customer.Tags != nil {
+		c.Tags = append([]string{}, customer.Tags...)
+	}
+	if customer.Metafields != nil {
+		c.Metafields = append([]entity.CustomerMetafield{}, customer.Metafields...)
+	}
+	if customer.Identities != nil {
+		c.Identities = append([]entity.CustomerIdentity{}, customer.Identities...)
+	}
+	return &c
+}
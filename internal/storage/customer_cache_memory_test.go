@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+func TestMemoryCustomerCacheEviction(t *testing.T) {
+	cache := NewMemoryCustomerCacheStorage(2)
+	require.NoError(t, cache.SetCachedCustomer("first", &entity.Customer{ID: "first"}, time.Minute))
+	require.NoError(t, cache.SetCachedCustomer("second", &entity.Customer{ID: "second"}, time.Minute))
+
+	// reading the first entry makes the second one least recently used
+	_, ok, err := cache.GetCachedCustomer("first")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, cache.SetCachedCustomer("third", &entity.Customer{ID: "third"}, time.Minute))
+
+	testCases := []struct {
+		key      string
+		expected bool
+	}{
+		{key: "first", expected: true},
+		{key: "second", expected: false},
+		{key: "third", expected: true},
+	}
+	for _, tc := range testCases {
+		customer, ok, err := cache.GetCachedCustomer(tc.key)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, ok, tc.key)
+		if tc.expected {
+			assert.Equal(t, tc.key, customer.ID)
+		}
+	}
+}
+
+func TestMemoryCustomerCacheTTL(t *testing.T) {
+	cache := NewMemoryCustomerCacheStorage(10)
+	require.NoError(t, cache.SetCachedCustomer("expired", &entity.Customer{ID: "expired"}, -time.Second))
+	require.NoError(t, cache.SetCachedCustomer("fresh", &entity.Customer{ID: "fresh"}, time.Minute))
+
+	customer, ok, err := cache.GetCachedCustomer("expired")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, customer)
+
+	customer, ok, err = cache.GetCachedCustomer("fresh")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "fresh", customer.ID)
+}
+
+func TestMemoryCustomerCacheDeleteExpired(t *testing.T) {
+	cache := NewMemoryCustomerCacheStorage(10)
+	require.NoError(t, cache.SetCachedCustomer("expired", &entity.Customer{ID: "expired"}, -time.Second))
+	require.NoError(t, cache.SetCachedCustomer("fresh", &entity.Customer{ID: "fresh"}, time.Minute))
+
+	deleted, err := cache.DeleteExpiredCachedCustomers(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Equal(t, 1, cache.lru.Len())
+	assert.NotContains(t, cache.entries, "expired")
+}
+
+func TestMemoryCustomerCacheCopiesCustomer(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	customer := &entity.Customer{
+		ID:                         "customer",
+		Tags:                       []string{"vip"},
+		DefaultAddress:             &entity.CustomerAddress{City: "Kyiv"},
+		Metafields:                 []entity.CustomerMetafield{{Key: "level", Value: "gold"}},
+		Identities:                 []entity.CustomerIdentity{{ProviderID: "google"}},
+		Store:                      &entity.Store{ID: "store"},
+		VendorAccessTokenExpiresAt: &expiresAt,
+	}
+
+	cache := NewMemoryCustomerCacheStorage(10)
+	require.NoError(t, cache.SetCachedCustomer("customer", customer, time.Minute))
+
+	// neither the stored customer nor the returned one share memory with the cache
+	customer.Tags[0] = "changed"
+	cached, ok, err := cache.GetCachedCustomer("customer")
+	require.NoError(t, err)
+	require.True(t, ok)
+	cached.DefaultAddress.City = "changed"
+	cached.Metafields[0].Value = "changed"
+	cached.Identities[0].ProviderID = "changed"
+	cached.Store.ID = "changed"
+	*cached.VendorAccessTokenExpiresAt = time.Time{}
+
+	cached, ok, err = cache.GetCachedCustomer("customer")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"vip"}, cached.Tags)
+	assert.Equal(t, "Kyiv", cached.DefaultAddress.City)
+	assert.Equal(t, "gold", cached.Metafields[0].Value)
+	assert.Equal(t, "google", cached.Identities[0].ProviderID)
+	assert.Equal(t, "store", cached.Store.ID)
+	assert.Equal(t, expiresAt, *cached.VendorAccessTokenExpiresAt)
+}
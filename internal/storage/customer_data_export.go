@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.CustomerDataExportStorage = (*customerDataExportStorage)(nil)
+
+type customerDataExportStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewCustomerDataExportStorage(postgresql *postgresql.PostgreSQLGorm) *customerDataExportStorage {
+	return &customerDataExportStorage{postgresql}
+}
+
+func (r *customerDataExportStorage) CreateCustomerDataExport(export *entity.CustomerDataExport) (*entity.CustomerDataExport, error) {
+	err := r.DB.Create(export).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer data export: %w", err)
+	}
+
+	return export, nil
+}
+
+func (r *customerDataExportStorage) GetCustomerDataExport(storeID, id string) (*entity.CustomerDataExport, error) {
+	var export entity.CustomerDataExport
+	err := r.DB.Where("store_id = ? AND id = ?", storeID, id).First(&export).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer data export: %w", err)
+	}
+
+	return &export, nil
+}
+
+func (r *customerDataExportStorage) ListCustomerDataExports(storeID string) ([]entity.CustomerDataExport, error) {
+	var exports []entity.CustomerDataExport
+	err := r.DB.Omit("data").Where("store_id = ?", storeID).Order("created_at").Find(&exports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customer data exports: %w", err)
+	}
+
+	return exports, nil
+}
+
+func (r *customerDataExportStorage) DeleteCustomerDataExports(filter service.DeleteCustomerDataExportsFilter) (int64, error) {
+	stmt := r.DB
+	if filter.StoreID != nil {
+		stmt = stmt.Where("store_id = ?", *filter.StoreID)
+	}
+	if filter.VendorCustomerID != nil {
+		stmt = stmt.Where("vendor_customer_id = ?", *filter.VendorCustomerID)
+	}
+	if filter.ExpiredBefore != nil {
+		stmt = stmt.Where("expires_at < ?", *filter.ExpiredBefore)
+	}
+
+	// deleting without conditions is rejected by gorm, so an empty filter doesn't wipe all exports
+	res := stmt.Delete(&entity.CustomerDataExport{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete customer data exports: %w", res.Error)
+	}
+
+	return res.RowsAffected, nil
+}
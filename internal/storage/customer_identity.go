@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.CustomerIdentityStorage = (*customerIdentityStorage)(nil)
+
+type customerIdentityStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewCustomerIdentityStorage(postgresql *postgresql.PostgreSQLGorm) *customerIdentityStorage {
+	return &customerIdentityStorage{postgresql}
+}
+
+func (r *customerIdentityStorage) GetCustomerIdentity(filter service.GetCustomerIdentityFilter) (*entity.CustomerIdentity, error) {
+	stmt := r.DB
+	if filter.ProviderID != nil {
+		stmt = stmt.Where(entity.CustomerIdentity{ProviderID: *filter.ProviderID})
+	}
+	if filter.Subject != nil {
+		stmt = stmt.Where(entity.CustomerIdentity{Subject: *filter.Subject})
+	}
+
+	var identity entity.CustomerIdentity
+	err := stmt.First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func (r *customerIdentityStorage) CreateCustomerIdentity(identity *entity.CustomerIdentity) (*entity.CustomerIdentity, error) {
+	err := r.DB.Create(identity).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+func (r *customerIdentityStorage) ListCustomerIdentities(customerID string) ([]entity.CustomerIdentity, error) {
+	var identities []entity.CustomerIdentity
+	err := r.DB.Where(entity.CustomerIdentity{CustomerID: customerID}).Find(&identities).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customer identities: %w", err)
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.CustomerImportStorage = (*customerImportStorage)(nil)
+
+type customerImportStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewCustomerImportStorage(postgresql *postgresql.PostgreSQLGorm) *customerImportStorage {
+	return &customerImportStorage{postgresql}
+}
+
+func (r *customerImportStorage) CreateCustomerImport(customerImport *entity.CustomerImport) (*entity.CustomerImport, error) {
+	err := r.DB.Create(customerImport).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer import: %w", err)
+	}
+
+	return customerImport, nil
+}
+
+func (r *customerImportStorage) GetCustomerImport(id string) (*entity.CustomerImport, error) {
+	var customerImport entity.CustomerImport
+	err := r.DB.Where("id = ?", id).First(&customerImport).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer import: %w", err)
+	}
+
+	return &customerImport, nil
+}
+
+func (r *customerImportStorage) ListCustomerImports(filter service.ListCustomerImportsFilter) ([]entity.CustomerImport, error) {
+	stmt := r.DB
+	if filter.StoreID != nil {
+		stmt = stmt.Where("store_id = ?", *filter.StoreID)
+	}
+	if len(filter.Statuses) > 0 {
+		stmt = stmt.Where("status IN ?", filter.Statuses)
+	}
+
+	var customerImports []entity.CustomerImport
+	err := stmt.Order("created_at").Find(&customerImports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list customer imports: %w", err)
+	}
+
+	return customerImports, nil
+}
+
+func (r *customerImportStorage) UpdateCustomerImport(id string, customerImport *entity.CustomerImport) (*entity.CustomerImport, error) {
+	err := r.DB.Model(&entity.CustomerImport{}).Where("id = ?", id).Updates(customerImport).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to update customer import: %w", err)
+	}
+
+	return customerImport, nil
+}
+
+func (r *customerImportStorage) ClaimCustomerImport(id, owner string, now, leaseUntil time.Time) (bool, error) {
+	// the conditional update lets only one replica hold the import until its lease is over
+	res := r.DB.Model(&entity.CustomerImport{}).
+		Where("id = ? AND status NOT IN ?", id, []string{entity.CustomerImportStatusCompleted, entity.CustomerImportStatusFailed}).
+		Where("lease_owner = ? OR lease_until IS NULL OR lease_until <= ?", owner, now).
+		Updates(map[string]interface{}{
+			"lease_owner": owner,
+			"lease_until": leaseUntil,
+		})
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to claim customer import: %w", res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r *customerImportStorage) ReleaseCustomerImport(id, owner string) error {
+	err := r.DB.Model(&entity.CustomerImport{}).
+		Where("id = ? AND lease_owner = ?", id, owner).
+		Updates(map[string]interface{}{
+			"lease_owner": "",
+			"lease_until": nil,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release customer import: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.LoginAttemptStorage = (*loginAttemptStorage)(nil)
+
+type loginAttemptStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewLoginAttemptStorage(postgresql *postgresql.PostgreSQLGorm) *loginAttemptStorage {
+	return &loginAttemptStorage{postgresql}
+}
+
+func (r *loginAttemptStorage) GetLoginAttempts(keys []string) ([]entity.LoginAttempt, error) {
+	var attempts []entity.LoginAttempt
+	err := r.DB.Where("key IN ?", keys).Find(&attempts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+func (r *loginAttemptStorage) RegisterFailedLoginAttempt(key string, windowStart time.Time) (*entity.LoginAttempt, error) {
+	var attempt entity.LoginAttempt
+	err := r.DB.Raw(`
+		INSERT INTO login_attempts (key, failures, last_failed_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failed_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failed_at = EXCLUDED.last_failed_at
+		RETURNING *`,
+		key, time.Now(), windowStart,
+	).Scan(&attempt).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to register failed login attempt: %w", err)
+	}
+
+	return &attempt, nil
+}
+
+func (r *loginAttemptStorage) LockLoginAttempt(key string, until time.Time) error {
+	err := r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		// concurrent failures lock the key in any order, so a shorter delay must not lift a lockout
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"locked_until": gorm.Expr("GREATEST(login_attempts.locked_until, EXCLUDED.locked_until)"),
+		}),
+	}).Create(&entity.LoginAttempt{
+		Key:          key,
+		LastFailedAt: time.Now(),
+		LockedUntil:  &until,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to lock login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *loginAttemptStorage) DeleteLoginAttempt(key string) error {
+	err := r.DB.Delete(&entity.LoginAttempt{Key: key}).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func (r *loginAttemptStorage) DeleteExpiredLoginAttempts(failedBefore, lockedBefore time.Time) (int64, error) {
+	result := r.DB.
+		Where("last_failed_at < ?", failedBefore).
+		Where("locked_until IS NULL OR locked_until < ?", lockedBefore).
+		Delete(&entity.LoginAttempt{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired login attempts: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+)
+
+// customerStoreIndex is the unique index of customers by store and vendor customer id.
+const customerStoreIndex = "idx_customer_store_vendor_customer"
+
+// BackfillCustomerStores sets store of customers created before customers were bound to stores,
+// it's safe to run on every start. The store is taken from OIDC identities and then the only store
+// is used if there is just one.
+// Backfilled customers duplicating each other (e.g. the customer logged in again after the store binding)
+// are merged into the one with the latest vendor session. Customers left without the store (e.g. customers
+// without identities in multi-store deployments) are kept, admins bind them by StoreService.BindUnboundCustomers.
+func BackfillCustomerStores(postgresql *postgresql.PostgreSQLGorm) error {
+	return postgresql.DB.Transaction(func(tx *gorm.DB) error {
+		var unbound int64
+		if err := tx.Model(&entity.Customer{}).Where("store_id IS NULL").Count(&unbound).Error; err != nil {
+			return fmt.Errorf("failed to count customers without store: %w", err)
+		}
+		if unbound == 0 {
+			return nil
+		}
+
+		// backfilled customers may duplicate each other, so the unique index is recreated once they are merged
+		if tx.Migrator().HasIndex(&entity.Customer{}, customerStoreIndex) {
+			if err := tx.Migrator().DropIndex(&entity.Customer{}, customerStoreIndex); err != nil {
+				return fmt.Errorf("failed to drop customer store index: %w", err)
+			}
+		}
+
+		identityProvider := tx.Model(&entity.CustomerIdentity{}).Select("provider_id").Where("customer_id = customers.id").Limit(1)
+		providerStore := tx.Unscoped().Model(&entity.OIDCProvider{}).Select("store_id").Where("id = (?)", identityProvider)
+		identityCustomers := tx.Model(&entity.CustomerIdentity{}).Select("customer_id")
+		err := tx.Model(&entity.Customer{}).
+			Where("store_id IS NULL AND id IN (?)", identityCustomers).
+			Update("store_id", providerStore).Error
+		if err != nil {
+			return fmt.Errorf("failed to backfill stores from identities: %w", err)
+		}
+
+		var stores []entity.Store
+		if err := tx.Unscoped().Limit(2).Find(&stores).Error; err != nil {
+			return fmt.Errorf("failed to get stores: %w", err)
+		}
+		if len(stores) == 1 {
+			err := tx.Model(&entity.Customer{}).Where("store_id IS NULL").Update("store_id", stores[0].ID).Error
+			if err != nil {
+				return fmt.Errorf("failed to backfill the only store: %w", err)
+			}
+		}
+
+		if err := mergeDuplicatedCustomers(tx); err != nil {
+			return fmt.Errorf("failed to merge duplicated customers: %w", err)
+		}
+
+		if err := tx.Migrator().CreateIndex(&entity.Customer{}, customerStoreIndex); err != nil {
+			return fmt.Errorf("failed to create customer store index: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// mergeDuplicatedCustomers keeps one customer per store and vendor customer id, identities of the rest are moved
+// to it before they are deleted. The customer with the latest vendor session is kept.
+func mergeDuplicatedCustomers(tx *gorm.DB) error {
+	duplicates := `SELECT id, first_value(id) OVER (
+		PARTITION BY store_id, vendor_customer_id
+		ORDER BY vendor_access_token_expires_at DESC NULLS LAST, id
+	) AS kept_id FROM customers WHERE store_id IS NOT NULL`
+
+	err := tx.Exec(`UPDATE customer_identities SET customer_id = duplicates.kept_id
+		FROM (` + duplicates + `) AS duplicates
+		WHERE customer_identities.customer_id = duplicates.id AND duplicates.id <> duplicates.kept_id`).Error
+	if err != nil {
+		return fmt.Errorf("failed to move identities: %w", err)
+	}
+
+	err = tx.Exec(`DELETE FROM customers USING (` + duplicates + `) AS duplicates
+		WHERE customers.id = duplicates.id AND duplicates.id <> duplicates.kept_id`).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete duplicates: %w", err)
+	}
+
+	return nil
+}
+
+// RequireCustomerStores makes store of customers required once every customer is bound to a store
+// and returns the number of customers still left without the store otherwise. It's safe to run on every start.
+func RequireCustomerStores(postgresql *postgresql.PostgreSQLGorm) (int64, error) {
+	var unbound int64
+	if err := postgresql.DB.Model(&entity.Customer{}).Where("store_id IS NULL").Count(&unbound).Error; err != nil {
+		return 0, fmt.Errorf("failed to count customers without store: %w", err)
+	}
+	if unbound > 0 {
+		return unbound, nil
+	}
+
+	if err := postgresql.DB.Exec("ALTER TABLE customers ALTER COLUMN store_id SET NOT NULL").Error; err != nil {
+		return 0, fmt.Errorf("failed to require customer store: %w", err)
+	}
+
+	return 0, nil
+}
+
+// DropComplianceLogData drops exported customer data stored in compliance logs before it was moved to
+// customer data exports, so compliance logs hold audit records only. It's safe to run on every start.
+func DropComplianceLogData(postgresql *postgresql.PostgreSQLGorm) error {
+	if !postgresql.DB.Migrator().HasColumn(&entity.ComplianceLog{}, "data") {
+		return nil
+	}
+	if err := postgresql.DB.Migrator().DropColumn(&entity.ComplianceLog{}, "data"); err != nil {
+		return fmt.Errorf("failed to drop compliance log data: %w", err)
+	}
+
+	return nil
+}
+
+// CanonicalizeStoreVendorIDs lowercases vendor ids of stores created before they were canonicalized,
+// so lookups by canonical store domain find them. It's safe to run on every start.
+func CanonicalizeStoreVendorIDs(postgresql *postgresql.PostgreSQLGorm) error {
+	err := postgresql.DB.Unscoped().Model(&entity.Store{}).
+		Where("vendor_id <> lower(trim(vendor_id))").
+		Update("vendor_id", gorm.Expr("lower(trim(vendor_id))")).Error
+	if err != nil {
+		return fmt.Errorf("failed to canonicalize store vendor ids: %w", err)
+	}
+
+	return nil
+}
+
+// BackfillStoreDisabledAt marks stores disabled by admins before the disable time was stored separately from
+// the uninstall time, so they stay disabled when the app is installed again. It's safe to run on every start.
+func BackfillStoreDisabledAt(postgresql *postgresql.PostgreSQLGorm) error {
+	err := postgresql.DB.Unscoped().Model(&entity.Store{}).
+		Where("deleted_at IS NOT NULL AND uninstalled_at IS NULL AND disabled_at IS NULL").
+		Update("disabled_at", gorm.Expr("deleted_at")).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill store disabled at: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.OIDCProviderStorage = (*oidcProviderStorage)(nil)
+
+type oidcProviderStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewOIDCProviderStorage(postgresql *postgresql.PostgreSQLGorm) *oidcProviderStorage {
+	return &oidcProviderStorage{postgresql}
+}
+
+func (r *oidcProviderStorage) GetOIDCProvider(filter service.GetOIDCProviderFilter) (*entity.OIDCProvider, error) {
+	stmt := r.DB
+	if filter.StoreID != nil {
+		stmt = stmt.Where(entity.OIDCProvider{StoreID: *filter.StoreID})
+	}
+	if filter.Name != nil {
+		stmt = stmt.Where(entity.OIDCProvider{Name: *filter.Name})
+	}
+
+	var provider entity.OIDCProvider
+	err := stmt.First(&provider).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oidc provider: %w", err)
+	}
+
+	return &provider, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.RateLimitStorage = (*rateLimitStorage)(nil)
+
+// rateLimitStorage keeps buckets in PostgreSQL so limits are shared between application replicas.
+type rateLimitStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewRateLimitStorage(postgresql *postgresql.PostgreSQLGorm) *rateLimitStorage {
+	return &rateLimitStorage{postgresql}
+}
+
+func (r *rateLimitStorage) TakeRateLimitToken(key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	var result ratelimit.Result
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.RateLimitBucket{
+			Key:       key,
+			Tokens:    float64(limit.Burst),
+			UpdatedAt: now,
+			FullAt:    now,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to create bucket: %w", err)
+		}
+
+		var bucket entity.RateLimitBucket
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&bucket).Error
+		if err != nil {
+			return fmt.Errorf("failed to lock bucket: %w", err)
+		}
+
+		b := ratelimit.Bucket{Tokens: bucket.Tokens, UpdatedAt: bucket.UpdatedAt}
+		result = b.Take(limit, now)
+
+		err = tx.Model(&entity.RateLimitBucket{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"tokens":     b.Tokens,
+			"updated_at": b.UpdatedAt,
+			"full_at":    now.Add(result.Reset),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update bucket: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *rateLimitStorage) DeleteFullRateLimitBuckets(fullBefore time.Time) (int64, error) {
+	// buckets created before full_at was stored have no value, they are treated as full
+	result := r.DB.Where("full_at < ? OR full_at IS NULL", fullBefore).Delete(&entity.RateLimitBucket{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete full rate limit buckets: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
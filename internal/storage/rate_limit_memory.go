@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+// memoryRateLimitMaxBuckets bounds memory used by clients with many keys,
+// the least recently used buckets are evicted when it's reached.
+const memoryRateLimitMaxBuckets = 100000
+
+var _ service.RateLimitStorage = (*memoryRateLimitStorage)(nil)
+
+// memoryRateLimitStorage keeps buckets in process memory, limits are not shared between replicas.
+// Full buckets are deleted in background by DeleteFullRateLimitBuckets.
+type memoryRateLimitStorage struct {
+	mu         sync.Mutex
+	maxBuckets int
+	buckets    map[string]*list.Element
+	// lru has the most recently used buckets in front.
+	lru *list.List
+}
+
+type memoryRateLimitBucket struct {
+	ratelimit.Bucket
+	key string
+	// fullAt is a time when bucket is full again and can be forgotten.
+	fullAt time.Time
+}
+
+func NewMemoryRateLimitStorage() *memoryRateLimitStorage {
+	return &memoryRateLimitStorage{
+		maxBuckets: memoryRateLimitMaxBuckets,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (r *memoryRateLimitStorage) TakeRateLimitToken(key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	element, ok := r.buckets[key]
+	if ok {
+		r.lru.MoveToFront(element)
+	} else {
+		element = r.lru.PushFront(&memoryRateLimitBucket{Bucket: ratelimit.NewBucket(limit, now), key: key})
+		r.buckets[key] = element
+		for r.lru.Len() > r.maxBuckets {
+			r.remove(r.lru.Back())
+		}
+	}
+
+	bucket := element.Value.(*memoryRateLimitBucket)
+	result := bucket.Take(limit, now)
+	bucket.fullAt = now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (r *memoryRateLimitStorage) DeleteFullRateLimitBuckets(fullBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for _, element := range r.buckets {
+		if element.Value.(*memoryRateLimitBucket).fullAt.Before(fullBefore) {
+			r.remove(element)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (r *memoryRateLimitStorage) remove(element *list.Element) {
+	r.lru.Remove(element)
+	delete(r.buckets, element.Value.(*memoryRateLimitBucket).key)
+}
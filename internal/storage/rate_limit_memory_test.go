@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/ratelimit"
+)
+
+func TestMemoryRateLimitEviction(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 2, Period: time.Minute}
+	storage := NewMemoryRateLimitStorage()
+	storage.maxBuckets = 2
+
+	_, err := storage.TakeRateLimitToken("first", limit)
+	require.NoError(t, err)
+	_, err = storage.TakeRateLimitToken("second", limit)
+	require.NoError(t, err)
+	// taking from the first bucket makes the second one least recently used
+	_, err = storage.TakeRateLimitToken("first", limit)
+	require.NoError(t, err)
+	_, err = storage.TakeRateLimitToken("third", limit)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, storage.lru.Len())
+	assert.Contains(t, storage.buckets, "first")
+	assert.NotContains(t, storage.buckets, "second")
+	assert.Contains(t, storage.buckets, "third")
+
+	// the first bucket is empty now, evicted buckets start full again
+	result, err := storage.TakeRateLimitToken("first", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryRateLimitDeleteFull(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 2, Period: time.Minute}
+	storage := NewMemoryRateLimitStorage()
+
+	_, err := storage.TakeRateLimitToken("key", limit)
+	require.NoError(t, err)
+
+	// the bucket is full again in half a period
+	deleted, err := storage.DeleteFullRateLimitBuckets(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	deleted, err = storage.DeleteFullRateLimitBuckets(time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.Equal(t, 0, storage.lru.Len())
+	assert.NotContains(t, storage.buckets, "key")
+}
@@ -1,7 +1,15 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+	"github.com/taraslis453/shopify-customer-auth/pkg/shopdomain"
 
 	"github.com/taraslis453/shopify-customer-auth/internal/entity"
 	"github.com/taraslis453/shopify-customer-auth/internal/service"
@@ -17,9 +25,53 @@ func NewStoreStorage(postgresql *postgresql.PostgreSQLGorm) *storeStorage {
 	return &storeStorage{postgresql}
 }
 
+func (s *storeStorage) CreateStore(store *entity.Store) (*entity.Store, error) {
+	err := s.DB.Create(store).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *storeStorage) CreateStoreIfNotExists(store *entity.Store) (bool, error) {
+	// concurrent first installs race, so the unique vendor id decides which one creates the store
+	res := s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vendor_id"}},
+		DoNothing: true,
+	}).Create(store)
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to create store: %w", res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
 func (s *storeStorage) GetStore(vendorID *string) (*entity.Store, error) {
+	// vendor ids are stored canonical, so a malformed one can't belong to any store
+	domain, err := shopdomain.Parse(*vendorID)
+	if err != nil {
+		return nil, nil
+	}
+
+	store := &entity.Store{}
+	err = s.DB.Where("vendor_id = ?", domain.String()).First(store).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (s *storeStorage) GetStoreByID(id string) (*entity.Store, error) {
 	store := &entity.Store{}
-	err := s.DB.Where("vendor_id = ?", vendorID).First(store).Error
+	err := s.DB.Where("id = ?", id).First(store).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -27,6 +79,49 @@ func (s *storeStorage) GetStore(vendorID *string) (*entity.Store, error) {
 	return store, nil
 }
 
+func (s *storeStorage) GetStoreByFilter(filter service.GetStoreFilter) (*entity.Store, error) {
+	stmt := s.DB
+	if filter.WithDisabled {
+		stmt = stmt.Unscoped()
+	}
+	if filter.ID != nil {
+		stmt = stmt.Where("id = ?", *filter.ID)
+	}
+	if filter.VendorID != nil {
+		domain, err := shopdomain.Parse(*filter.VendorID)
+		if err != nil {
+			return nil, nil
+		}
+		stmt = stmt.Where("vendor_id = ?", domain.String())
+	}
+
+	store := &entity.Store{}
+	err := stmt.First(store).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get store: %w", err)
+	}
+
+	return store, nil
+}
+
+func (s *storeStorage) ListStores(filter service.ListStoresFilter) ([]entity.Store, error) {
+	stmt := s.DB
+	if filter.WithDisabled {
+		stmt = stmt.Unscoped()
+	}
+
+	var stores []entity.Store
+	err := stmt.Order("created_at").Find(&stores).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stores: %w", err)
+	}
+
+	return stores, nil
+}
+
 func (s *storeStorage) UpdateStore(id string, store *entity.Store) (*entity.Store, error) {
 	err := s.DB.Model(&entity.Store{}).Where("id = ?", id).Updates(store).Error
 	if err != nil {
@@ -35,3 +130,127 @@ func (s *storeStorage) UpdateStore(id string, store *entity.Store) (*entity.Stor
 
 	return store, nil
 }
+
+func (s *storeStorage) UpdateStoreFields(id string, store *entity.Store, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Select makes Updates save zero values of the selected fields
+	err := s.DB.Unscoped().Model(&entity.Store{}).Where("id = ?", id).Select(fields).Updates(store).Error
+	if err != nil {
+		return fmt.Errorf("failed to update store fields: %w", err)
+	}
+
+	return nil
+}
+
+func (s *storeStorage) DisableStore(id string) error {
+	// stores are soft deleted, so disabled stores keep their data and can be enabled again,
+	// uninstalled stores keep their uninstall time
+	err := s.DB.Unscoped().Model(&entity.Store{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"disabled_at": time.Now(),
+		"deleted_at":  gorm.Expr("COALESCE(deleted_at, ?)", time.Now()),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to disable store: %w", err)
+	}
+
+	return nil
+}
+
+func (s *storeStorage) EnableStore(id string) error {
+	// uninstalled stores stay disabled until the app is installed again
+	err := s.DB.Unscoped().Model(&entity.Store{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"disabled_at": nil,
+		"deleted_at":  gorm.Expr("CASE WHEN uninstalled_at IS NULL THEN NULL ELSE deleted_at END"),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to enable store: %w", err)
+	}
+
+	return nil
+}
+
+func (s *storeStorage) UninstallStore(id string) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Updates with a struct skips zero values, so the fields are reset with a map
+		err := tx.Unscoped().Model(&entity.Store{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"access_token":             "",
+			"store_front_access_token": "",
+			"scope":                    "",
+			"uninstalled_at":           now,
+			// stores disabled by admins keep their disable time
+			"deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", now),
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update store: %w", err)
+		}
+		err = tx.Model(&entity.Customer{}).Where("store_id = ?", id).Updates(map[string]interface{}{
+			"refresh_token":                  "",
+			"vendor_access_token":            "",
+			"vendor_access_token_expires_at": nil,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to clear customer sessions: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *storeStorage) ReinstallStore(store *entity.Store) error {
+	// stores disabled by admins stay disabled
+	err := s.DB.Unscoped().Model(&entity.Store{}).Where("id = ?", store.ID).Updates(map[string]interface{}{
+		"uninstalled_at": nil,
+		"deleted_at":     gorm.Expr("CASE WHEN disabled_at IS NULL THEN NULL ELSE deleted_at END"),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to reinstall store: %w", err)
+	}
+	store.UninstalledAt = nil
+	if store.DisabledAt == nil {
+		store.DeletedAt = gorm.DeletedAt{}
+	}
+
+	return nil
+}
+
+func (s *storeStorage) PurgeStore(store *entity.Store) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		// customers which weren't backfilled with the store are still linked to it through identities of the store providers
+		providers := tx.Unscoped().Model(&entity.OIDCProvider{}).Select("id").Where("store_id = ?", store.ID)
+		customers := tx.Model(&entity.CustomerIdentity{}).Select("customer_id").Where("provider_id IN (?)", providers)
+		if err := tx.Where("store_id = ? OR id IN (?)", store.ID, customers).Delete(&entity.Customer{}).Error; err != nil {
+			return fmt.Errorf("failed to delete customers: %w", err)
+		}
+		if err := tx.Unscoped().Where("store_id = ?", store.ID).Delete(&entity.OIDCProvider{}).Error; err != nil {
+			return fmt.Errorf("failed to delete oidc providers: %w", err)
+		}
+		err := tx.Where("key LIKE ? OR key = ?", "email:"+store.ID+":%", "store:"+store.ID).Delete(&entity.LoginAttempt{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete login attempts: %w", err)
+		}
+		if err := tx.Where("key LIKE ?", "%:"+store.VendorID+":%").Delete(&entity.RateLimitBucket{}).Error; err != nil {
+			return fmt.Errorf("failed to delete rate limit buckets: %w", err)
+		}
+		if err := tx.Where("key LIKE ?", store.VendorID+":%").Delete(&entity.CustomerCacheEntry{}).Error; err != nil {
+			return fmt.Errorf("failed to delete cached customers: %w", err)
+		}
+		// webhook events hold customer emails, the event being handled is deleted too, so its redelivery is skipped
+		// as the store is gone
+		if err := tx.Where("store_vendor_id = ?", store.VendorID).Delete(&entity.WebhookEvent{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook events: %w", err)
+		}
+		if err := tx.Where("store_id = ?", store.ID).Delete(&entity.CustomerImport{}).Error; err != nil {
+			return fmt.Errorf("failed to delete customer imports: %w", err)
+		}
+		if err := tx.Where("store_id = ?", store.ID).Delete(&entity.CustomerDataExport{}).Error; err != nil {
+			return fmt.Errorf("failed to delete customer data exports: %w", err)
+		}
+		if err := tx.Unscoped().Where("id = ?", store.ID).Delete(&entity.Store{}).Error; err != nil {
+			return fmt.Errorf("failed to delete store: %w", err)
+		}
+		return nil
+	})
+}
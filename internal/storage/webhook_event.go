@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/taraslis453/shopify-customer-auth/pkg/postgresql"
+
+	"github.com/taraslis453/shopify-customer-auth/internal/entity"
+	"github.com/taraslis453/shopify-customer-auth/internal/service"
+)
+
+var _ service.WebhookEventStorage = (*webhookEventStorage)(nil)
+
+type webhookEventStorage struct {
+	*postgresql.PostgreSQLGorm
+}
+
+func NewWebhookEventStorage(postgresql *postgresql.PostgreSQLGorm) *webhookEventStorage {
+	return &webhookEventStorage{postgresql}
+}
+
+func (r *webhookEventStorage) CreateWebhookEvent(event *entity.WebhookEvent) (bool, error) {
+	// redeliveries race with the first delivery, so the unique vendor webhook id decides which one is created
+	res := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "vendor_webhook_id"}},
+		DoNothing: true,
+	}).Create(event)
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to create webhook event: %w", res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r *webhookEventStorage) GetWebhookEvent(id string) (*entity.WebhookEvent, error) {
+	var event entity.WebhookEvent
+	err := r.DB.Where("id = ?", id).First(&event).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook event: %w", err)
+	}
+
+	return &event, nil
+}
+
+func (r *webhookEventStorage) ClaimWebhookEvent(id string, now, leaseUntil time.Time) (bool, error) {
+	// the conditional update lets only one replica claim the event until the lease is over
+	res := r.DB.Model(&entity.WebhookEvent{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, entity.WebhookEventStatusPending, now).
+		Updates(map[string]interface{}{
+			"next_attempt_at": leaseUntil,
+			"attempts":        gorm.Expr("attempts + 1"),
+		})
+	if res.Error != nil {
+		return false, fmt.Errorf("failed to claim webhook event: %w", res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r *webhookEventStorage) ListWebhookEvents(filter service.ListWebhookEventsFilter) ([]entity.WebhookEvent, error) {
+	stmt := r.DB
+	if len(filter.Statuses) > 0 {
+		stmt = stmt.Where("status IN ?", filter.Statuses)
+	}
+	if filter.DueBefore != nil {
+		stmt = stmt.Where("next_attempt_at <= ?", *filter.DueBefore)
+	}
+	if filter.Limit > 0 {
+		stmt = stmt.Limit(filter.Limit)
+	}
+
+	var events []entity.WebhookEvent
+	err := stmt.Order("created_at").Find(&events).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *webhookEventStorage) UpdateWebhookEvent(id string, event *entity.WebhookEvent) (*entity.WebhookEvent, error) {
+	err := r.DB.Model(&entity.WebhookEvent{}).Where("id = ?", id).Updates(event).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to update webhook event: %w", err)
+	}
+
+	return event, nil
+}
+
+func (r *webhookEventStorage) DeleteWebhookEvents(createdBefore time.Time) (int64, error) {
+	res := r.DB.
+		Where("status IN ?", []string{entity.WebhookEventStatusProcessed, entity.WebhookEventStatusFailed}).
+		Where("created_at < ?", createdBefore).
+		Delete(&entity.WebhookEvent{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to delete webhook events: %w", res.Error)
+	}
+
+	return res.RowsAffected, nil
+}
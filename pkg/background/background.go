@@ -0,0 +1,32 @@
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs tasks which outlive the request that started them, e.g. webhook handling.
+// Tasks get the group context, so they are cancelled with it and Wait lets shutdown wait for them.
+type Group struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+// New creates a group of tasks bound to given ctx.
+func New(ctx context.Context) *Group {
+	return &Group{ctx: ctx}
+}
+
+// Go runs fn in a new goroutine with the group context.
+func (g *Group) Go(fn func(ctx context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn(g.ctx)
+	}()
+}
+
+// Wait blocks until all tasks started by Go are finished.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
@@ -0,0 +1,29 @@
+package background
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	group := New(ctx)
+
+	var finished atomic.Int32
+	for i := 0; i < 3; i++ {
+		group.Go(func(ctx context.Context) {
+			// tasks run until the group context is cancelled
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			finished.Add(1)
+		})
+	}
+
+	cancel()
+	group.Wait()
+	assert.Equal(t, int32(3), finished.Load())
+}
@@ -2,8 +2,9 @@ package errs
 
 // Err implements the Error interface with error marshaling.
 type Err struct {
-	Message string `json:"message"`
-	Code    string `json:"code"`
+	Message string      `json:"message"`
+	Code    string      `json:"code"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 func New(message, code string) error {
@@ -31,3 +32,25 @@ func GetCode(err error) string {
 	}
 	return v.Code
 }
+
+// WithDetails returns a copy of given custom error with attached details, not custom errors are returned as is.
+func WithDetails(err error, details interface{}) error {
+	v, ok := err.(*Err)
+	if !ok {
+		return err
+	}
+	return &Err{
+		Message: v.Message,
+		Code:    v.Code,
+		Details: details,
+	}
+}
+
+// GetDetails returns details of given error or nil if error is not custom
+func GetDetails(err error) interface{} {
+	v, ok := err.(*Err)
+	if !ok {
+		return nil
+	}
+	return v.Details
+}
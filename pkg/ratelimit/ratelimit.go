@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit describes a token bucket which holds up to Burst tokens and is fully refilled over Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// ParseLimit parses limit in "<burst>/<period>" format, e.g. "60/1m".
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 {
+		return Limit{}, fmt.Errorf("invalid limit %q: expected <burst>/<period>", s)
+	}
+
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: burst must be a positive number", s)
+	}
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: period must be a positive duration", s)
+	}
+
+	return Limit{Burst: burst, Period: period}, nil
+}
+
+// IsZero reports whether limit is not set, zero limit means unlimited.
+func (l Limit) IsZero() bool {
+	return l.Burst == 0
+}
+
+// Bucket is a token bucket state.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(limit Limit, now time.Time) Bucket {
+	return Bucket{Tokens: float64(limit.Burst), UpdatedAt: now}
+}
+
+// Result describes a bucket state after taking a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is a time left until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is a time left until the next token is available, zero if request is allowed.
+	RetryAfter time.Duration
+}
+
+// Take refills the bucket for the time passed since the last update and takes one token if it is available.
+func (b *Bucket) Take(limit Limit, now time.Time) Result {
+	rate := float64(limit.Burst) / float64(limit.Period) // tokens per nanosecond
+
+	if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens += float64(elapsed) * rate
+	}
+	if b.Tokens > float64(limit.Burst) {
+		b.Tokens = float64(limit.Burst)
+	}
+	b.UpdatedAt = now
+
+	result := Result{Limit: limit.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - b.Tokens) / rate))
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = time.Duration(math.Ceil((float64(limit.Burst) - b.Tokens) / rate))
+
+	return result
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedLimit Limit
+		expectedError bool
+	}{
+		{
+			name:          "positive: minutes",
+			input:         "60/1m",
+			expectedLimit: Limit{Burst: 60, Period: time.Minute},
+		},
+		{
+			name:          "positive: with spaces",
+			input:         " 5/30s ",
+			expectedLimit: Limit{Burst: 5, Period: 30 * time.Second},
+		},
+		{
+			name:          "negative: no period",
+			input:         "60",
+			expectedError: true,
+		},
+		{
+			name:          "negative: zero burst",
+			input:         "0/1m",
+			expectedError: true,
+		},
+		{
+			name:          "negative: invalid period",
+			input:         "10/minute",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		limit, err := ParseLimit(tc.input)
+		if tc.expectedError {
+			assert.Errorf(t, err, tc.name)
+			continue
+		}
+		require.NoErrorf(t, err, tc.name)
+		assert.Equalf(t, tc.expectedLimit, limit, tc.name)
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	limit := Limit{Burst: 2, Period: 2 * time.Second}
+	now := time.Now()
+	bucket := NewBucket(limit, now)
+
+	result := bucket.Take(limit, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+	assert.Equal(t, 2, result.Limit)
+
+	result = bucket.Take(limit, now)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 2*time.Second, result.Reset)
+
+	result = bucket.Take(limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	// one token is refilled per second
+	result = bucket.Take(limit, now.Add(time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// bucket never holds more than burst
+	result = bucket.Take(limit, now.Add(time.Hour))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
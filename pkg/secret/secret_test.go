@@ -0,0 +1,28 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	ciphertext, err := Encrypt("secret", "token")
+	require.NoError(t, err)
+	assert.NotContains(t, ciphertext, "token")
+
+	other, err := Encrypt("secret", "token")
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, other, "nonce must be random")
+
+	plaintext, err := Decrypt("secret", ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "token", plaintext)
+
+	_, err = Decrypt("other secret", ciphertext)
+	assert.Error(t, err)
+
+	_, err = Decrypt("secret", "token")
+	assert.Error(t, err)
+}
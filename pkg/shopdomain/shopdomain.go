@@ -0,0 +1,36 @@
+// Package shopdomain validates and canonicalizes permanent Shopify store domains.
+package shopdomain
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalid is returned for values which aren't permanent store domains.
+var ErrInvalid = errors.New("invalid shop domain")
+
+var domainRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*\.myshopify\.com$`)
+
+// Domain is a valid permanent store domain in lowercase, e.g. example.myshopify.com.
+// It's safe to use as a host of store API URLs.
+type Domain string
+
+// Parse validates given store domain, surrounding spaces and case are ignored.
+func Parse(value string) (Domain, error) {
+	domain := strings.ToLower(strings.TrimSpace(value))
+	if !domainRegexp.MatchString(domain) {
+		return "", ErrInvalid
+	}
+	return Domain(domain), nil
+}
+
+// String returns the domain, e.g. example.myshopify.com.
+func (d Domain) String() string {
+	return string(d)
+}
+
+// URL returns https URL of the store with given path, e.g. https://example.myshopify.com/admin/oauth/access_token.
+func (d Domain) URL(path string) string {
+	return "https://" + string(d) + path
+}
@@ -0,0 +1,65 @@
+package shopdomain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected Domain
+		err      error
+	}{
+		{
+			name:     "positive: valid domain",
+			value:    "example-store1.myshopify.com",
+			expected: "example-store1.myshopify.com",
+		},
+		{
+			name:     "positive: case and spaces are normalized",
+			value:    " Example.MyShopify.com ",
+			expected: "example.myshopify.com",
+		},
+		{
+			name:  "negative: another host",
+			value: "example.com",
+			err:   ErrInvalid,
+		},
+		{
+			name:  "negative: host with myshopify.com prefix",
+			value: "example.myshopify.com.attacker.com",
+			err:   ErrInvalid,
+		},
+		{
+			name:  "negative: path after domain",
+			value: "attacker.com/x.myshopify.com",
+			err:   ErrInvalid,
+		},
+		{
+			name:  "negative: subdomain",
+			value: "a.example.myshopify.com",
+			err:   ErrInvalid,
+		},
+		{
+			name:  "negative: leading dash",
+			value: "-example.myshopify.com",
+			err:   ErrInvalid,
+		},
+		{
+			name:  "negative: empty",
+			value: "",
+			err:   ErrInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			domain, err := Parse(tc.value)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.expected, domain)
+		})
+	}
+}
@@ -23,6 +23,9 @@ type UniversalClaims struct {
 type UserDataClaims struct {
 	// UserID is the ID of the token owner.
 	UserID string `json:"userId"`
+	// Roles and Scopes are permissions of the token owner, they are set only in access tokens.
+	Roles  []string `json:"roles,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 func (claims UniversalClaims) GetIssuer() string {
@@ -111,3 +111,37 @@ func parseJWTClaims(claims jwt.MapClaims) (*UniversalClaims, error) {
 
 	return uniClaims, nil
 }
+
+type ParseJWTTokenOptions struct {
+	Token  string
+	Secret string
+	// Audience is required in aud claim if it's set.
+	Audience string
+	// Leeway tolerates clock skew when exp and nbf claims are checked.
+	Leeway time.Duration
+}
+
+// ParseJWTToken verifies HS256 JWT token signature, exp, nbf and aud claims and decodes its claims into given claims.
+// Unlike VerifyJWTToken it works with tokens issued by third parties which have their own claims.
+func ParseJWTToken(opt ParseJWTTokenOptions, claims jwt.Claims) error {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithLeeway(opt.Leeway),
+	}
+	if opt.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(opt.Audience))
+	}
+
+	_, err := jwt.ParseWithClaims(opt.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(opt.Secret), nil
+	}, parserOptions...)
+	if err != nil {
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+	// the parser checks exp only if it's present, while tokens without expiration are never accepted
+	if expAt, err := claims.GetExpirationTime(); err != nil || expAt == nil {
+		return fmt.Errorf("token has no expiration time")
+	}
+
+	return nil
+}